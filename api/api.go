@@ -1,18 +1,74 @@
 package api
 
 import (
-	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+const internalFailureMessage = "Unexpected error occurred. Please try again later."
+
+// mailFailureMessages are shown when the email could not be sent, by response
+// status code. The cause is logged instead.
+var mailFailureMessages = map[int]string{
+	http.StatusBadGateway:         "Your message could not be sent. Please check your email address, or try again later.",
+	http.StatusServiceUnavailable: "Our email service is busy. Please try again in a few minutes.",
+	http.StatusGatewayTimeout:     "Our email service did not respond in time, so your message may not have been sent. Please try again later.",
+}
+
 type EmailFormRequest struct {
 	Name    string `json:"name"`
 	Email   string `json:"email"`
 	Message string `json:"message"`
+	// FormID identifies the form on the website, when there are several.
+	FormID string `json:"formId,omitempty"`
+	// Fields are additional form fields, passed to the email template.
+	Fields map[string]string `json:"fields,omitempty"`
+	// Attachments are files sent with the email, eg. reference photos.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// APIVersion optionally selects the response version ("1" or "2").
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Headers are the incoming HTTP headers, as supplied to web functions.
+	Headers map[string]string `json:"__ow_headers,omitempty"`
+}
+
+// Attachment is a file attached to a request. In JSON, its content is base64
+// encoded.
+type Attachment struct {
+	Filename string `json:"filename"`
+	// ContentType is the type given by the client. It is not trusted: the type
+	// of the content is sniffed instead.
+	ContentType string `json:"contentType,omitempty"`
+	Content     []byte `json:"content"`
+	// ContentID shows the file inline in the HTML email, at cid:<ContentID>.
+	// It is only set by attachment processing, eg. for thumbnails.
+	ContentID string `json:"contentId,omitempty"`
+}
+
+// Header returns the named incoming header, matched case-insensitively.
+func (r *EmailFormRequest) Header(name string) string {
+	for key, value := range r.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// Response is implemented by every versioned response envelope.
+type Response interface {
+	Status() int
 }
 
 type ResponseHeaders struct {
 	ContentType string `json:"Content-Type"`
+	RequestID   string `json:"X-Request-Id,omitempty"`
+	// MailMode is set when email is not sent for real, eg. "sandbox".
+	MailMode string `json:"X-Mail-Mode,omitempty"`
+	// RetryAfter is the number of seconds to wait before submitting again.
+	RetryAfter string `json:"Retry-After,omitempty"`
 }
 
 type FieldError struct {
@@ -24,6 +80,8 @@ type ResponseBody struct {
 	Message            string       `json:"message"`
 	GlobalErrorMessage string       `json:"globalErrorMessage"`
 	FieldErrors        []FieldError `json:"fieldErrors"`
+	RequestID          string       `json:"requestId,omitempty"`
+	MailMode           string       `json:"mailMode,omitempty"`
 }
 
 type EmailFormResponse struct {
@@ -32,16 +90,53 @@ type EmailFormResponse struct {
 	Headers    ResponseHeaders `json:"headers"`
 }
 
+func (r EmailFormResponse) Status() int {
+	return r.StatusCode
+}
+
+// InternalFailureResponse returns the V1 internal failure.
+//
+// Deprecated: errorMessage is ignored, neither shown nor logged. Log the cause
+// with your own logger, as contactform does, so it is redacted by the
+// configured policy, and use a Responder's InternalFailure.
 func InternalFailureResponse(errorMessage string) EmailFormResponse {
-	fmt.Printf("Internal Error: [%v]", errorMessage)
+	return internalFailureResponse()
+}
+
+func internalFailureResponse() EmailFormResponse {
 	res := baseResponse(http.StatusInternalServerError)
 	res.Body = ResponseBody{
-		GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
+		GlobalErrorMessage: internalFailureMessage,
+		Message:            "error",
+	}
+	return res
+}
+
+// mailFailureResponse responds to an email that could not be sent, with a 502,
+// 503 or 504 statusCode. Other status codes respond as an internal failure.
+func mailFailureResponse(statusCode int, retryAfter time.Duration) EmailFormResponse {
+	message, ok := mailFailureMessages[statusCode]
+	if !ok {
+		return internalFailureResponse()
+	}
+	res := baseResponse(statusCode)
+	res.Headers.RetryAfter = retryAfterSeconds(retryAfter)
+	res.Body = ResponseBody{
+		GlobalErrorMessage: message,
 		Message:            "error",
 	}
 	return res
 }
 
+// retryAfterSeconds formats a positive retryAfter as a Retry-After value, in
+// whole seconds rounded up. It is empty otherwise.
+func retryAfterSeconds(retryAfter time.Duration) string {
+	if retryAfter <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(int64((retryAfter+time.Second-1)/time.Second), 10)
+}
+
 func ValidationFailureResponse(globalError string, fieldErrors map[string]string) EmailFormResponse {
 	res := baseResponse(http.StatusBadRequest)
 	res.Body = ResponseBody{
@@ -60,15 +155,29 @@ func SuccessResponse() EmailFormResponse {
 	return res
 }
 
+// AcceptedResponse is returned when the email will be sent later.
+func AcceptedResponse() EmailFormResponse {
+	res := baseResponse(http.StatusAccepted)
+	res.Body = ResponseBody{
+		Message: "accepted",
+	}
+	return res
+}
+
 func baseResponse(statusCode int) EmailFormResponse {
 	return EmailFormResponse{
 		StatusCode: statusCode,
 		Headers: ResponseHeaders{
-			ContentType: "application/json",
+			ContentType: JSONMediaType,
 		},
 	}
 }
 
+func withRequestID(res EmailFormResponse, requestID string) EmailFormResponse {
+	res.Headers.RequestID = requestID
+	return res
+}
+
 func toFieldErrors(errors map[string]string) []FieldError {
 	var fieldErrors []FieldError
 	for field, errorMessage := range errors {
@@ -77,5 +186,8 @@ func toFieldErrors(errors map[string]string) []FieldError {
 			ErrorMessage: errorMessage,
 		})
 	}
+	sort.Slice(fieldErrors, func(i, j int) bool {
+		return fieldErrors[i].Field < fieldErrors[j].Field
+	})
 	return fieldErrors
 }
@@ -1,8 +1,10 @@
 package api_test
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
 )
@@ -23,6 +25,22 @@ func TestSuccessResponse(t *testing.T) {
 	}
 }
 
+func TestAcceptedResponse(t *testing.T) {
+	actual := api.AcceptedResponse()
+	expected := api.EmailFormResponse{
+		StatusCode: 202,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/json",
+		},
+		Body: api.ResponseBody{
+			Message: "accepted",
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("AcceptedResponse() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
 func TestValidationFailureResponse(t *testing.T) {
 	fieldErrors := map[string]string{
 		"field1": "error message 1",
@@ -70,3 +88,78 @@ func TestInternalFailureResponse(t *testing.T) {
 		t.Errorf("SuccessResponse() actual[%v], does not match expected[%v]", actual, expected)
 	}
 }
+
+func TestResponseV1JSONContract(t *testing.T) {
+	type testSpec struct {
+		response api.EmailFormResponse
+		expected string
+	}
+
+	testSpecs := []testSpec{
+		{
+			response: api.SuccessResponse(),
+			expected: `{"body":{"message":"success","globalErrorMessage":"","fieldErrors":null},"statusCode":200,"headers":{"Content-Type":"application/json"}}`,
+		},
+		{
+			response: api.ValidationFailureResponse("", map[string]string{"name": "name must be between 1 and 100 characters"}),
+			expected: `{"body":{"message":"error","globalErrorMessage":"","fieldErrors":[{"field":"name","errorMessage":"name must be between 1 and 100 characters"}]},"statusCode":400,"headers":{"Content-Type":"application/json"}}`,
+		},
+		{
+			response: api.InternalFailureResponse("Internal error message"),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Unexpected error occurred. Please try again later.","fieldErrors":null},"statusCode":500,"headers":{"Content-Type":"application/json"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123", api.WithMailMode("sandbox")).Success().(api.EmailFormResponse),
+			expected: `{"body":{"message":"success","globalErrorMessage":"","fieldErrors":null,"mailMode":"sandbox"},"statusCode":200,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123","X-Mail-Mode":"sandbox"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123", api.WithMailMode("log-only")).InternalFailure().(api.EmailFormResponse),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Unexpected error occurred. Please try again later.","fieldErrors":null,"requestId":"req-123"},"statusCode":500,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123","X-Mail-Mode":"log-only"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123").MailFailure(502, 0).(api.EmailFormResponse),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Your message could not be sent. Please check your email address, or try again later.","fieldErrors":null,"requestId":"req-123"},"statusCode":502,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123").MailFailure(503, 29500*time.Millisecond).(api.EmailFormResponse),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Our email service is busy. Please try again in a few minutes.","fieldErrors":null,"requestId":"req-123"},"statusCode":503,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123","Retry-After":"30"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123").MailFailure(504, 0).(api.EmailFormResponse),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Our email service did not respond in time, so your message may not have been sent. Please try again later.","fieldErrors":null,"requestId":"req-123"},"statusCode":504,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V1, "req-123").MailFailure(500, 0).(api.EmailFormResponse),
+			expected: `{"body":{"message":"error","globalErrorMessage":"Unexpected error occurred. Please try again later.","fieldErrors":null,"requestId":"req-123"},"statusCode":500,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123"}}`,
+		},
+	}
+
+	for _, test := range testSpecs {
+		actual, err := json.Marshal(test.response)
+		if err != nil {
+			t.Fatalf("json.Marshal() returned error [%v]", err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("json.Marshal() actual[%s], does not match expected[%s]", actual, test.expected)
+		}
+	}
+}
+
+func TestV1ResponderIncludesRequestID(t *testing.T) {
+	actual := api.NewResponder(api.V1, "req-123").InternalFailure()
+	expected := api.EmailFormResponse{
+		StatusCode: 500,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/json",
+			RequestID:   "req-123",
+		},
+		Body: api.ResponseBody{
+			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
+			Message:            "error",
+			RequestID:          "req-123",
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("InternalFailure() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
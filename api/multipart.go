@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+)
+
+// Form field names of multipart/form-data requests. Custom fields are named
+// "fields[<name>]", and every file part is an attachment, whatever its name.
+const (
+	MultipartNameField       = "name"
+	MultipartEmailField      = "email"
+	MultipartMessageField    = "message"
+	MultipartFormIDField     = "formId"
+	MultipartAPIVersionField = "apiVersion"
+	MultipartFieldsPrefix    = "fields["
+)
+
+// ReadMultipartRequest reads a multipart/form-data request, as posted by an
+// HTML form with file inputs. boundary is the boundary parameter of its
+// Content-Type. The caller limits the size of r.
+func ReadMultipartRequest(r io.Reader, boundary string) (*EmailFormRequest, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart request has no boundary")
+	}
+	request := &EmailFormRequest{}
+	reader := multipart.NewReader(r, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return request, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading multipart request: %w", err)
+		}
+		content, err := io.ReadAll(part)
+		part.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading multipart request: %w", err)
+		}
+		if filename := part.FileName(); filename != "" {
+			request.Attachments = append(request.Attachments, Attachment{
+				Filename:    filename,
+				ContentType: part.Header.Get("Content-Type"),
+				Content:     content,
+			})
+			continue
+		}
+		request.setFormField(part.FormName(), string(content))
+	}
+}
+
+// setFormField sets the request field named name. Unknown fields are ignored.
+func (r *EmailFormRequest) setFormField(name, value string) {
+	switch name {
+	case MultipartNameField:
+		r.Name = value
+	case MultipartEmailField:
+		r.Email = value
+	case MultipartMessageField:
+		r.Message = value
+	case MultipartFormIDField:
+		r.FormID = value
+	case MultipartAPIVersionField:
+		r.APIVersion = value
+	default:
+		if field, ok := strings.CutPrefix(name, MultipartFieldsPrefix); ok && strings.HasSuffix(field, "]") {
+			if r.Fields == nil {
+				r.Fields = map[string]string{}
+			}
+			r.Fields[strings.TrimSuffix(field, "]")] = value
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package api_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+)
+
+func TestReadMultipartRequest(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("name", "Gavin Thomas")
+	writer.WriteField("email", "test@example.com")
+	writer.WriteField("message", "This is a test message.")
+	writer.WriteField("formId", "wedding-enquiry")
+	writer.WriteField("apiVersion", "2")
+	writer.WriteField("fields[venue]", "Kyoto")
+	writer.WriteField("unknown", "ignored")
+	file, _ := writer.CreateFormFile("attachments", "venue.jpg")
+	file.Write([]byte("\xff\xd8\xff\xe0"))
+	file, _ = writer.CreateFormFile("brief", "brief.pdf")
+	file.Write([]byte("%PDF-1.7\n"))
+	writer.Close()
+
+	actual, err := api.ReadMultipartRequest(&body, writer.Boundary())
+	if err != nil {
+		t.Fatalf("ReadMultipartRequest() returned error [%v]", err)
+	}
+	expected := &api.EmailFormRequest{
+		Name:       "Gavin Thomas",
+		Email:      "test@example.com",
+		Message:    "This is a test message.",
+		FormID:     "wedding-enquiry",
+		APIVersion: "2",
+		Fields:     map[string]string{"venue": "Kyoto"},
+		Attachments: []api.Attachment{
+			{Filename: "venue.jpg", ContentType: "application/octet-stream", Content: []byte("\xff\xd8\xff\xe0")},
+			{Filename: "brief.pdf", ContentType: "application/octet-stream", Content: []byte("%PDF-1.7\n")},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("ReadMultipartRequest() actual[%+v], does not match expected[%+v]", actual, expected)
+	}
+}
+
+func TestReadMultipartRequestErrors(t *testing.T) {
+	type testSpec struct {
+		name     string
+		body     string
+		boundary string
+	}
+
+	testSpecs := []testSpec{
+		{name: "no boundary", body: "", boundary: ""},
+		{name: "truncated", body: "--b\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\nGavin", boundary: "b"},
+	}
+
+	for _, test := range testSpecs {
+		if _, err := api.ReadMultipartRequest(strings.NewReader(test.body), test.boundary); err == nil {
+			t.Errorf("%s: ReadMultipartRequest() SHOULD return an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+const problemTypeBaseUrl = "https://ippoippophotography.com/problems/"
+
+var (
+	ValidationProblemType      = problemTypeBaseUrl + "validation-error"
+	InternalProblemType        = problemTypeBaseUrl + "internal-error"
+	MailRejectedProblemType    = problemTypeBaseUrl + "mail-rejected"
+	MailUnavailableProblemType = problemTypeBaseUrl + "mail-unavailable"
+	MailTimeoutProblemType     = problemTypeBaseUrl + "mail-timeout"
+)
+
+// mailFailureProblems are the problem types and titles of mail failures, by status code.
+var mailFailureProblems = map[int]ProblemDetails{
+	http.StatusBadGateway:         {Type: MailRejectedProblemType, Title: "Message not sent"},
+	http.StatusServiceUnavailable: {Type: MailUnavailableProblemType, Title: "Email service unavailable"},
+	http.StatusGatewayTimeout:     {Type: MailTimeoutProblemType, Title: "Email service timed out"},
+}
+
+// ProblemDetails is an RFC 7807 problem, extended with the field level errors
+// and the request ID.
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+type SuccessBody struct {
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	MailMode string `json:"mailMode,omitempty"`
+}
+
+// ResponseV2 is the V2 envelope. Body is a ProblemDetails for errors, and a
+// SuccessBody otherwise.
+type ResponseV2 struct {
+	Body       any             `json:"body"`
+	StatusCode int             `json:"statusCode"`
+	Headers    ResponseHeaders `json:"headers"`
+}
+
+func (r ResponseV2) Status() int {
+	return r.StatusCode
+}
+
+// InternalFailureProblem returns the V2 internal failure. Callers log the
+// cause with their own logger, as contactform does.
+func InternalFailureProblem() ResponseV2 {
+	return problemResponse(ProblemDetails{
+		Type:   InternalProblemType,
+		Title:  "Internal error",
+		Status: http.StatusInternalServerError,
+		Detail: internalFailureMessage,
+	})
+}
+
+func mailFailureProblem(statusCode int, retryAfter time.Duration) ResponseV2 {
+	problem, ok := mailFailureProblems[statusCode]
+	if !ok {
+		return InternalFailureProblem()
+	}
+	problem.Status = statusCode
+	problem.Detail = mailFailureMessages[statusCode]
+	res := problemResponse(problem)
+	res.Headers.RetryAfter = retryAfterSeconds(retryAfter)
+	return res
+}
+
+func ValidationFailureProblem(globalError string, fieldErrors map[string]string) ResponseV2 {
+	detail := globalError
+	if detail == "" {
+		detail = "One or more fields are invalid."
+	}
+	return problemResponse(ProblemDetails{
+		Type:   ValidationProblemType,
+		Title:  "Validation failed",
+		Status: http.StatusBadRequest,
+		Detail: detail,
+		Errors: toFieldErrors(fieldErrors),
+	})
+}
+
+func SuccessResponseV2() ResponseV2 {
+	return ResponseV2{
+		StatusCode: http.StatusOK,
+		Headers: ResponseHeaders{
+			ContentType: JSONMediaType,
+		},
+		Body: SuccessBody{
+			Title:  "Message sent",
+			Status: http.StatusOK,
+		},
+	}
+}
+
+func AcceptedResponseV2() ResponseV2 {
+	return ResponseV2{
+		StatusCode: http.StatusAccepted,
+		Headers: ResponseHeaders{
+			ContentType: JSONMediaType,
+		},
+		Body: SuccessBody{
+			Title:  "Message accepted",
+			Status: http.StatusAccepted,
+		},
+	}
+}
+
+func problemResponse(problem ProblemDetails) ResponseV2 {
+	return ResponseV2{
+		StatusCode: problem.Status,
+		Headers: ResponseHeaders{
+			ContentType: ProblemMediaType,
+		},
+		Body: problem,
+	}
+}
+
+// withProblemRequestID sets the request ID header, and identifies the problem
+// occurrence by the request ID.
+func withProblemRequestID(res ResponseV2, requestID string) ResponseV2 {
+	res.Headers.RequestID = requestID
+	if problem, ok := res.Body.(ProblemDetails); ok && requestID != "" {
+		problem.Instance = "urn:request:" + requestID
+		problem.RequestID = requestID
+		res.Body = problem
+	}
+	return res
+}
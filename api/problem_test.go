@@ -0,0 +1,126 @@
+package api_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+)
+
+func TestValidationFailureProblem(t *testing.T) {
+	fieldErrors := map[string]string{
+		"field2": "error message 2",
+		"field1": "error message 1",
+	}
+	actual := api.ValidationFailureProblem("", fieldErrors)
+	expected := api.ResponseV2{
+		StatusCode: 400,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/problem+json",
+		},
+		Body: api.ProblemDetails{
+			Type:   "https://ippoippophotography.com/problems/validation-error",
+			Title:  "Validation failed",
+			Status: 400,
+			Detail: "One or more fields are invalid.",
+			Errors: []api.FieldError{
+				{
+					Field:        "field1",
+					ErrorMessage: "error message 1",
+				},
+				{
+					Field:        "field2",
+					ErrorMessage: "error message 2",
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("ValidationFailureProblem() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
+func TestInternalFailureProblem(t *testing.T) {
+	actual := api.InternalFailureProblem()
+	expected := api.ResponseV2{
+		StatusCode: 500,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/problem+json",
+		},
+		Body: api.ProblemDetails{
+			Type:   "https://ippoippophotography.com/problems/internal-error",
+			Title:  "Internal error",
+			Status: 500,
+			Detail: "Unexpected error occurred. Please try again later.",
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("InternalFailureProblem() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
+func TestResponseV2JSONContract(t *testing.T) {
+	type testSpec struct {
+		response api.Response
+		expected string
+	}
+
+	testSpecs := []testSpec{
+		{
+			response: api.NewResponder(api.V2, "req-123").Success(),
+			expected: `{"body":{"title":"Message sent","status":200},"statusCode":200,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").Accepted(),
+			expected: `{"body":{"title":"Message accepted","status":202},"statusCode":202,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").ValidationFailure("invalid request type", nil),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/validation-error","title":"Validation failed","status":400,"detail":"invalid request type","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":400,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").ValidationFailure("", map[string]string{"email": "email must be a valid email address"}),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/validation-error","title":"Validation failed","status":400,"detail":"One or more fields are invalid.","instance":"urn:request:req-123","errors":[{"field":"email","errorMessage":"email must be a valid email address"}],"requestId":"req-123"},"statusCode":400,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").InternalFailure(),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/internal-error","title":"Internal error","status":500,"detail":"Unexpected error occurred. Please try again later.","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":500,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").MailFailure(502, 0),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/mail-rejected","title":"Message not sent","status":502,"detail":"Your message could not be sent. Please check your email address, or try again later.","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":502,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").MailFailure(503, 30*time.Second),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/mail-unavailable","title":"Email service unavailable","status":503,"detail":"Our email service is busy. Please try again in a few minutes.","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":503,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123","Retry-After":"30"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").MailFailure(504, 0),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/mail-timeout","title":"Email service timed out","status":504,"detail":"Our email service did not respond in time, so your message may not have been sent. Please try again later.","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":504,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123").MailFailure(418, 0),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/internal-error","title":"Internal error","status":500,"detail":"Unexpected error occurred. Please try again later.","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":500,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123", api.WithMailMode("sandbox")).Accepted(),
+			expected: `{"body":{"title":"Message accepted","status":202,"mailMode":"sandbox"},"statusCode":202,"headers":{"Content-Type":"application/json","X-Request-Id":"req-123","X-Mail-Mode":"sandbox"}}`,
+		},
+		{
+			response: api.NewResponder(api.V2, "req-123", api.WithMailMode("sandbox")).ValidationFailure("invalid request type", nil),
+			expected: `{"body":{"type":"https://ippoippophotography.com/problems/validation-error","title":"Validation failed","status":400,"detail":"invalid request type","instance":"urn:request:req-123","requestId":"req-123"},"statusCode":400,"headers":{"Content-Type":"application/problem+json","X-Request-Id":"req-123","X-Mail-Mode":"sandbox"}}`,
+		},
+	}
+
+	for _, test := range testSpecs {
+		actual, err := json.Marshal(test.response)
+		if err != nil {
+			t.Fatalf("json.Marshal() returned error [%v]", err)
+		}
+		if string(actual) != test.expected {
+			t.Errorf("json.Marshal() actual[%s], does not match expected[%s]", actual, test.expected)
+		}
+	}
+}
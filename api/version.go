@@ -0,0 +1,181 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version identifies the response envelope returned to the caller.
+type Version int
+
+const (
+	// V1 is the original envelope: EmailFormResponse with a "success"/"error" message.
+	V1 Version = iota + 1
+	// V2 uses RFC 7807 problem details (application/problem+json) for errors.
+	V2
+)
+
+const (
+	JSONMediaType    = "application/json"
+	ProblemMediaType = "application/problem+json"
+	V2MediaType      = "application/vnd.ippoippo.contact.v2+json"
+)
+
+// NegotiateVersion selects the response version. An explicit request field wins,
+// then the Accept header, whose media ranges with q=0 are refused. Anything
+// unrecognised falls back to V1.
+func NegotiateVersion(accept, requested string) Version {
+	switch strings.ToLower(strings.TrimPrefix(strings.TrimSpace(requested), "v")) {
+	case "1":
+		return V1
+	case "2":
+		return V2
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		params := strings.Split(mediaRange, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if (mediaType == ProblemMediaType || mediaType == V2MediaType) && acceptable(params[1:]) {
+			return V2
+		}
+	}
+	return V1
+}
+
+// acceptable reports whether the parameters of a media range accept it: unless
+// its q value is 0, or not a number.
+func acceptable(params []string) bool {
+	for _, param := range params {
+		name, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(name), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q > 0
+		}
+	}
+	return true
+}
+
+// Responder builds responses for a single negotiated version.
+type Responder interface {
+	Success() Response
+	// Accepted is returned when the email is queued, to be sent later.
+	Accepted() Response
+	ValidationFailure(globalError string, fieldErrors map[string]string) Response
+	// InternalFailure hides the cause from the caller, so it is logged by the caller instead.
+	InternalFailure() Response
+	// MailFailure responds to an email that could not be sent, with statusCode
+	// 502, 503 or 504. As for InternalFailure, the cause is hidden. Other status
+	// codes respond as InternalFailure. A positive retryAfter is sent in the
+	// Retry-After header.
+	MailFailure(statusCode int, retryAfter time.Duration) Response
+}
+
+// ResponderOption adds details to every response of a Responder.
+type ResponderOption func(*responseMeta)
+
+type responseMeta struct {
+	requestID string
+	mailMode  string
+}
+
+// WithMailMode shows that email is not sent for real, eg. "sandbox", in the
+// X-Mail-Mode header and in success bodies. An empty mode is omitted.
+func WithMailMode(mode string) ResponderOption {
+	return func(m *responseMeta) {
+		m.mailMode = mode
+	}
+}
+
+// NewResponder returns the Responder for version. requestID is echoed in the
+// response headers and in error bodies so failures can be traced in the logs.
+func NewResponder(version Version, requestID string, opts ...ResponderOption) Responder {
+	meta := responseMeta{requestID: requestID}
+	for _, opt := range opts {
+		opt(&meta)
+	}
+	if version == V2 {
+		return v2Responder{meta}
+	}
+	return v1Responder{meta}
+}
+
+type v1Responder struct {
+	responseMeta
+}
+
+func (r v1Responder) Success() Response {
+	res := r.headers(SuccessResponse())
+	res.Body.MailMode = r.mailMode
+	return res
+}
+
+func (r v1Responder) Accepted() Response {
+	res := r.headers(AcceptedResponse())
+	res.Body.MailMode = r.mailMode
+	return res
+}
+
+func (r v1Responder) ValidationFailure(globalError string, fieldErrors map[string]string) Response {
+	res := r.headers(ValidationFailureResponse(globalError, fieldErrors))
+	res.Body.RequestID = r.requestID
+	return res
+}
+
+func (r v1Responder) InternalFailure() Response {
+	res := r.headers(internalFailureResponse())
+	res.Body.RequestID = r.requestID
+	return res
+}
+
+func (r v1Responder) MailFailure(statusCode int, retryAfter time.Duration) Response {
+	res := r.headers(mailFailureResponse(statusCode, retryAfter))
+	res.Body.RequestID = r.requestID
+	return res
+}
+
+func (r v1Responder) headers(res EmailFormResponse) EmailFormResponse {
+	res = withRequestID(res, r.requestID)
+	res.Headers.MailMode = r.mailMode
+	return res
+}
+
+type v2Responder struct {
+	responseMeta
+}
+
+func (r v2Responder) Success() Response {
+	return r.success(SuccessResponseV2())
+}
+
+func (r v2Responder) Accepted() Response {
+	return r.success(AcceptedResponseV2())
+}
+
+func (r v2Responder) ValidationFailure(globalError string, fieldErrors map[string]string) Response {
+	return r.problem(ValidationFailureProblem(globalError, fieldErrors))
+}
+
+func (r v2Responder) InternalFailure() Response {
+	return r.problem(InternalFailureProblem())
+}
+
+func (r v2Responder) MailFailure(statusCode int, retryAfter time.Duration) Response {
+	return r.problem(mailFailureProblem(statusCode, retryAfter))
+}
+
+func (r v2Responder) success(res ResponseV2) ResponseV2 {
+	res.Headers.RequestID = r.requestID
+	res.Headers.MailMode = r.mailMode
+	if body, ok := res.Body.(SuccessBody); ok {
+		body.MailMode = r.mailMode
+		res.Body = body
+	}
+	return res
+}
+
+func (r v2Responder) problem(res ResponseV2) ResponseV2 {
+	res = withProblemRequestID(res, r.requestID)
+	res.Headers.MailMode = r.mailMode
+	return res
+}
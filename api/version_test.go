@@ -0,0 +1,52 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	type testSpec struct {
+		accept    string
+		requested string
+		expected  api.Version
+	}
+
+	testSpecs := []testSpec{
+		{accept: "", requested: "", expected: api.V1},
+		{accept: "application/json", requested: "", expected: api.V1},
+		{accept: "*/*", requested: "", expected: api.V1},
+		{accept: "application/problem+json", requested: "", expected: api.V2},
+		{accept: "application/json;q=0.9, Application/Problem+JSON", requested: "", expected: api.V2},
+		{accept: "application/vnd.ippoippo.contact.v2+json", requested: "", expected: api.V2},
+		{accept: "application/problem+json;q=0", requested: "", expected: api.V1},
+		{accept: "application/json, application/problem+json; q=0.000", requested: "", expected: api.V1},
+		{accept: "application/vnd.ippoippo.contact.v2+json;Q=0", requested: "", expected: api.V1},
+		{accept: "application/problem+json;q=0, application/vnd.ippoippo.contact.v2+json", requested: "", expected: api.V2},
+		{accept: "application/problem+json;charset=utf-8;q=0.5", requested: "", expected: api.V2},
+		{accept: "application/problem+json;q=high", requested: "", expected: api.V1},
+		{accept: "", requested: "2", expected: api.V2},
+		{accept: "", requested: "v2", expected: api.V2},
+		{accept: "application/problem+json", requested: "1", expected: api.V1},
+		{accept: "", requested: "3", expected: api.V1},
+	}
+
+	for _, test := range testSpecs {
+		if actual := api.NegotiateVersion(test.accept, test.requested); actual != test.expected {
+			t.Errorf("NegotiateVersion(%q, %q) actual[%v], does not match expected[%v]", test.accept, test.requested, actual, test.expected)
+		}
+	}
+}
+
+func TestEmailFormRequestHeader(t *testing.T) {
+	request := api.EmailFormRequest{
+		Headers: map[string]string{"accept": "application/problem+json"},
+	}
+	if actual := request.Header("Accept"); actual != "application/problem+json" {
+		t.Errorf("Header() actual[%s], does not match expected[%s]", actual, "application/problem+json")
+	}
+	if actual := request.Header("X-Missing"); actual != "" {
+		t.Errorf("Header() actual[%s], expected empty", actual)
+	}
+}
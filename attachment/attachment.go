@@ -0,0 +1,166 @@
+// Package attachment recognises the files attached to contact form requests,
+// by sniffing their content rather than trusting the client, and gives them
+// filenames safe to send in an email.
+package attachment
+
+import (
+	"encoding/binary"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+)
+
+// Content types of the allowed attachments.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	HEIC = "image/heic"
+	PDF  = "application/pdf"
+)
+
+// MaxFilenameLength limits sanitised filenames, in characters.
+const MaxFilenameLength = 100
+
+// defaultFilename names attachments without a usable filename.
+const defaultFilename = "attachment"
+
+// extensions are the filename extensions of each allowed content type. The
+// first is added to filenames without one of them.
+var extensions = map[string][]string{
+	JPEG: {".jpg", ".jpeg"},
+	PNG:  {".png"},
+	HEIC: {".heic", ".heif"},
+	PDF:  {".pdf"},
+}
+
+// heicBrands are the ISO base media file brands of HEIC images, as written by
+// phone cameras. Other HEIF brands, such as AVIF's, are not HEIC.
+var heicBrands = map[string]bool{"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true}
+
+// Sniff returns the content type of content, eg. "image/png". Unrecognised
+// content is "application/octet-stream", or a text type.
+func Sniff(content []byte) string {
+	if isHEIC(content) {
+		return HEIC
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(content), ";")
+	return contentType
+}
+
+// Allowed reports whether contentType may be attached.
+func Allowed(contentType string) bool {
+	_, ok := extensions[contentType]
+	return ok
+}
+
+// IsImage reports whether contentType is an image.
+func IsImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// isHEIC reports whether content starts with an ISO base media file type box
+// of a HEIC brand, as its major brand or a compatible one.
+func isHEIC(content []byte) bool {
+	if len(content) < 16 || string(content[4:8]) != "ftyp" {
+		return false
+	}
+	size := int(binary.BigEndian.Uint32(content[0:4]))
+	if size < 16 || size > len(content) {
+		size = len(content)
+	}
+	if heicBrands[string(content[8:12])] {
+		return true
+	}
+	// Compatible brands follow the major brand and its minor version.
+	for i := 16; i+4 <= size; i += 4 {
+		if heicBrands[string(content[i:i+4])] {
+			return true
+		}
+	}
+	return false
+}
+
+// SanitizeFilename returns name without directories, control characters or
+// characters reserved by common file systems, with its extension matching
+// contentType, and at most MaxFilenameLength characters long. Names left empty
+// become "attachment".
+func SanitizeFilename(name, contentType string) string {
+	// Either separator, as the client may run Windows.
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.ToValidUTF8(name, "")
+	var b strings.Builder
+	space := false
+	for _, r := range name {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Cf, r), strings.ContainsRune(`<>:"|?*`, r):
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	// Leading dots hide files, and trailing dots are dropped by Windows.
+	name = strings.Trim(b.String(), ". ")
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimRight(strings.TrimSuffix(name, ext), " ")
+	if allowed, ok := extensions[contentType]; ok && !containsFold(allowed, ext) {
+		// Eg. "invoice.pdf.exe", sniffed as a PDF, becomes "invoice.pdf.exe.pdf".
+		stem, ext = name, allowed[0]
+	}
+	if stem == "" {
+		stem = defaultFilename
+	}
+	if max := MaxFilenameLength - utf8.RuneCountInString(ext); utf8.RuneCountInString(stem) > max {
+		stem = strings.TrimRight(string([]rune(stem)[:max]), ". ")
+	}
+	return stem + ext
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepare returns files as they are sent: with their sniffed content type, and
+// sanitised filenames. Inline files keep their ContentID.
+func Prepare(files []api.Attachment) []api.Attachment {
+	if len(files) == 0 {
+		return nil
+	}
+	prepared := make([]api.Attachment, len(files))
+	for i, file := range files {
+		contentType := Sniff(file.Content)
+		prepared[i] = api.Attachment{
+			Filename:    SanitizeFilename(file.Filename, contentType),
+			ContentType: contentType,
+			Content:     file.Content,
+			ContentID:   file.ContentID,
+		}
+	}
+	return prepared
+}
+
+// TotalSize returns the size of files, in bytes.
+func TotalSize(files []api.Attachment) int {
+	total := 0
+	for _, file := range files {
+		total += len(file.Content)
+	}
+	return total
+}
@@ -0,0 +1,102 @@
+package attachment_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
+)
+
+var (
+	jpegContent = []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	pngContent  = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdfContent  = []byte("%PDF-1.7\n")
+	heicContent = []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+)
+
+func TestSniff(t *testing.T) {
+	type testSpec struct {
+		name            string
+		content         []byte
+		expectedType    string
+		expectedAllowed bool
+	}
+
+	testSpecs := []testSpec{
+		{name: "jpeg", content: jpegContent, expectedType: attachment.JPEG, expectedAllowed: true},
+		{name: "png", content: pngContent, expectedType: attachment.PNG, expectedAllowed: true},
+		{name: "pdf", content: pdfContent, expectedType: attachment.PDF, expectedAllowed: true},
+		{name: "heic", content: heicContent, expectedType: attachment.HEIC, expectedAllowed: true},
+		{name: "heif with a compatible heic brand", content: []byte("\x00\x00\x00\x18ftypmif1\x00\x00\x00\x00mif1heic"),
+			expectedType: attachment.HEIC, expectedAllowed: true},
+		{name: "avif", content: []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"), expectedAllowed: false},
+		{name: "gif", content: []byte("GIF89a\x01\x00\x01\x00"), expectedType: "image/gif", expectedAllowed: false},
+		{name: "html", content: []byte("<html><script>alert(1)</script>"), expectedType: "text/html", expectedAllowed: false},
+		{name: "executable", content: []byte("MZ\x90\x00\x03\x00\x00\x00"), expectedType: "application/octet-stream", expectedAllowed: false},
+		{name: "empty", content: nil, expectedType: "text/plain", expectedAllowed: false},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			actual := attachment.Sniff(test.content)
+			if test.expectedType != "" && actual != test.expectedType {
+				t.Errorf("Sniff() actual[%s], does not match expected[%s]", actual, test.expectedType)
+			}
+			if allowed := attachment.Allowed(actual); allowed != test.expectedAllowed {
+				t.Errorf("Allowed(%s) actual[%v], does not match expected[%v]", actual, allowed, test.expectedAllowed)
+			}
+		})
+	}
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	type testSpec struct {
+		name        string
+		contentType string
+		expected    string
+	}
+
+	testSpecs := []testSpec{
+		{name: "venue.jpg", contentType: attachment.JPEG, expected: "venue.jpg"},
+		{name: "Venue.JPEG", contentType: attachment.JPEG, expected: "Venue.JPEG"},
+		{name: "IMG_0001.HEIC", contentType: attachment.HEIC, expected: "IMG_0001.HEIC"},
+		{name: "../../etc/passwd", contentType: attachment.PDF, expected: "passwd.pdf"},
+		{name: `C:\Users\me\Desktop\brief.pdf`, contentType: attachment.PDF, expected: "brief.pdf"},
+		{name: "invoice.pdf.exe", contentType: attachment.PDF, expected: "invoice.pdf.exe.pdf"},
+		{name: "photo.png", contentType: attachment.JPEG, expected: "photo.png.jpg"},
+		{name: ".hidden.png", contentType: attachment.PNG, expected: "hidden.png"},
+		{name: "  wedding \t  shot\r\n.png  ", contentType: attachment.PNG, expected: "wedding shot.png"},
+		{name: "a<b>c:d\"e|f?g*h.png", contentType: attachment.PNG, expected: "abcdefgh.png"},
+		{name: "evil\u202egnp.exe", contentType: attachment.PNG, expected: "evilgnp.exe.png"},
+		{name: "bad\xffutf8.png", contentType: attachment.PNG, expected: "badutf8.png"},
+		{name: "", contentType: attachment.PDF, expected: "attachment.pdf"},
+		{name: "...", contentType: attachment.PNG, expected: "attachment.png"},
+		{name: "notes.txt", contentType: "text/plain", expected: "notes.txt"},
+		{name: strings.Repeat("写", 150) + ".jpg", contentType: attachment.JPEG, expected: strings.Repeat("写", 96) + ".jpg"},
+	}
+
+	for _, test := range testSpecs {
+		if actual := attachment.SanitizeFilename(test.name, test.contentType); actual != test.expected {
+			t.Errorf("SanitizeFilename(%q) actual[%s], does not match expected[%s]", test.name, actual, test.expected)
+		}
+	}
+}
+
+func TestPrepare(t *testing.T) {
+	files := []api.Attachment{
+		{Filename: "../venue", ContentType: "application/pdf", Content: jpegContent},
+		{Filename: "brief.pdf", Content: pdfContent},
+	}
+	expected := []api.Attachment{
+		{Filename: "venue.jpg", ContentType: attachment.JPEG, Content: jpegContent},
+		{Filename: "brief.pdf", ContentType: attachment.PDF, Content: pdfContent},
+	}
+	if actual := attachment.Prepare(files); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Prepare() actual[%+v], does not match expected[%+v]", actual, expected)
+	}
+	if actual := attachment.TotalSize(files); actual != len(jpegContent)+len(pdfContent) {
+		t.Errorf("TotalSize() actual[%d], does not match expected[%d]", actual, len(jpegContent)+len(pdfContent))
+	}
+}
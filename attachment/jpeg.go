@@ -0,0 +1,154 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// JPEG markers, see ITU T.81 Table B.1.
+const (
+	markerSOI   = 0xd8
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP2  = 0xe2
+	markerAPP14 = 0xee
+	markerAPP15 = 0xef
+	markerCOM   = 0xfe
+)
+
+var (
+	errInvalidJPEG = errors.New("invalid JPEG")
+	exifHeader     = []byte("Exif\x00\x00")
+	iccHeader      = []byte("ICC_PROFILE\x00")
+)
+
+// keepJPEGSegment reports whether a segment is needed to show the image. APP1
+// (Exif, XMP), APP13 (IPTC), comments, and the other application segments are
+// not, except JFIF, ICC profiles and Adobe's colour transform. APP2 also holds
+// the Multi-Picture Format index of embedded previews, which are dropped.
+func keepJPEGSegment(marker byte, data []byte) bool {
+	switch {
+	case marker == markerAPP0, marker == markerAPP14:
+		return true
+	case marker == markerAPP2:
+		return bytes.HasPrefix(data, iccHeader)
+	case marker >= markerAPP0 && marker <= markerAPP15, marker == markerCOM:
+		return false
+	default:
+		return true
+	}
+}
+
+// stripJPEG returns content without its metadata segments, or anything after
+// the end of the image, such as embedded previews. The image data is copied
+// as it is, so the image is not re-encoded.
+func stripJPEG(content []byte) ([]byte, error) {
+	if len(content) < 4 || content[0] != 0xff || content[1] != markerSOI {
+		return nil, errInvalidJPEG
+	}
+	stripped := make([]byte, 0, len(content))
+	stripped = append(stripped, content[:2]...)
+	i := 2
+	for {
+		if i+2 > len(content) || content[i] != 0xff {
+			return nil, errInvalidJPEG
+		}
+		marker := content[i+1]
+		if marker == 0xff {
+			// Fill byte before a marker.
+			i++
+			continue
+		}
+		if marker == markerEOI {
+			return append(stripped, content[i:i+2]...), nil
+		}
+		if i+4 > len(content) {
+			return nil, errInvalidJPEG
+		}
+		length := int(binary.BigEndian.Uint16(content[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(content) {
+			return nil, errInvalidJPEG
+		}
+		if keepJPEGSegment(marker, content[i+4:end]) {
+			stripped = append(stripped, content[i:end]...)
+		}
+		i = end
+		if marker == markerSOS {
+			// Entropy-coded data runs to the next marker, other than stuffed
+			// bytes (0xff00), restarts (0xffd0 to 0xffd7) and fill bytes.
+			scanEnd := i
+			for scanEnd+1 < len(content) {
+				if content[scanEnd] == 0xff {
+					next := content[scanEnd+1]
+					if next != 0x00 && next != 0xff && (next < 0xd0 || next > 0xd7) {
+						break
+					}
+				}
+				scanEnd++
+			}
+			if scanEnd+1 >= len(content) {
+				return nil, errInvalidJPEG
+			}
+			stripped = append(stripped, content[i:scanEnd]...)
+			i = scanEnd
+		}
+	}
+}
+
+// jpegOrientation returns the Exif orientation of content, from 1 to 8, or 1
+// when it has none. See the TIFF 6.0 Orientation tag.
+func jpegOrientation(content []byte) int {
+	for i := 2; i+4 <= len(content) && content[i] == 0xff; {
+		marker := content[i+1]
+		length := int(binary.BigEndian.Uint16(content[i+2 : i+4]))
+		end := i + 2 + length
+		if marker == markerSOS || length < 2 || end > len(content) {
+			return 1
+		}
+		data := content[i+4 : end]
+		if marker == markerAPP1 && bytes.HasPrefix(data, exifHeader) {
+			return exifOrientation(data[len(exifHeader):])
+		}
+		i = end
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF header.
+func exifOrientation(tiff []byte) int {
+	const orientationTag = 0x0112
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == orientationTag {
+			if orientation := int(order.Uint16(tiff[entry+8 : entry+10])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
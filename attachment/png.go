@@ -0,0 +1,45 @@
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	errInvalidPNG = errors.New("invalid PNG")
+	pngSignature  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// metadataPNGChunks hold text, Exif (with GPS) and XMP (in iTXt) metadata, and
+// the modification time. No other chunk is needed to show the image.
+var metadataPNGChunks = map[string]bool{"tEXt": true, "zTXt": true, "iTXt": true, "eXIf": true, "tIME": true}
+
+// stripPNG returns content without its metadata chunks, or anything after the
+// IEND chunk. The other chunks are copied as they are, with their checksums.
+func stripPNG(content []byte) ([]byte, error) {
+	if !bytes.HasPrefix(content, pngSignature) {
+		return nil, errInvalidPNG
+	}
+	stripped := make([]byte, 0, len(content))
+	stripped = append(stripped, pngSignature...)
+	for i := len(pngSignature); ; {
+		if i+8 > len(content) {
+			return nil, errInvalidPNG
+		}
+		length := int(binary.BigEndian.Uint32(content[i : i+4]))
+		chunkType := string(content[i+4 : i+8])
+		// Length, type, data and CRC.
+		end := i + 12 + length
+		if length < 0 || end > len(content) || end < i {
+			return nil, errInvalidPNG
+		}
+		if !metadataPNGChunks[chunkType] {
+			stripped = append(stripped, content[i:end]...)
+		}
+		if chunkType == "IEND" {
+			return stripped, nil
+		}
+		i = end
+	}
+}
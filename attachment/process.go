@@ -0,0 +1,217 @@
+package attachment
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// maxDecodePixels bounds the images decoded to turn, resize or thumbnail them,
+// so a small but highly compressed file cannot exhaust the function's memory.
+// Larger images only have their metadata removed.
+const maxDecodePixels = 40_000_000
+
+const (
+	jpegQuality      = 85
+	thumbnailQuality = 75
+)
+
+// Processor removes the metadata of JPEG and PNG attachments, such as their
+// GPS location, and downsizes them and adds their thumbnails, as configured.
+// HEIC images and PDFs are sent as they are.
+type Processor struct {
+	maxDimension int
+	// thumbnailSize is zero when thumbnails are off.
+	thumbnailSize int
+}
+
+func NewProcessor(cfg *configuration.ContactFormConfiguration) *Processor {
+	p := &Processor{maxDimension: cfg.AttachmentMaxDimension}
+	if cfg.AttachmentThumbnails {
+		p.thumbnailSize = cfg.AttachmentThumbnailSize
+	}
+	return p
+}
+
+// Process returns files prepared to send, followed by their inline thumbnails.
+// Images are only re-encoded when they are turned upright or downsized, so the
+// others keep their quality. Files that cannot be read return an error.
+func (p *Processor) Process(files []api.Attachment) ([]api.Attachment, error) {
+	var processed, thumbnails []api.Attachment
+	for _, file := range Prepare(files) {
+		// Only thumbnails are inline.
+		file.ContentID = ""
+		var img image.Image
+		var err error
+		switch file.ContentType {
+		case JPEG:
+			img, err = p.processJPEG(&file)
+		case PNG:
+			img, err = p.processPNG(&file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("processing attachment %s: %w", file.Filename, err)
+		}
+		processed = append(processed, file)
+		if img != nil && p.thumbnailSize > 0 {
+			thumbnail, err := p.thumbnail(file, img, len(thumbnails)+1)
+			if err != nil {
+				return nil, fmt.Errorf("making thumbnail of %s: %w", file.Filename, err)
+			}
+			thumbnails = append(thumbnails, thumbnail)
+		}
+	}
+	return append(processed, thumbnails...), nil
+}
+
+// processJPEG removes the metadata of file, turning it upright by its Exif
+// orientation first. It returns the decoded image, or nil when not needed.
+func (p *Processor) processJPEG(file *api.Attachment) (image.Image, error) {
+	orientation := jpegOrientation(file.Content)
+	stripped, err := stripJPEG(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	file.Content = stripped
+	img, resize, err := p.decode(stripped, jpeg.DecodeConfig, jpeg.Decode, orientation != 1)
+	if img == nil || err != nil {
+		return nil, err
+	}
+	img = orient(img, orientation)
+	if !resize && orientation == 1 {
+		return img, nil
+	}
+	if resize {
+		img = fit(img, p.maxDimension)
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	file.Content = encoded.Bytes()
+	return img, nil
+}
+
+// processPNG removes the metadata of file. It returns the decoded image, or
+// nil when not needed.
+func (p *Processor) processPNG(file *api.Attachment) (image.Image, error) {
+	stripped, err := stripPNG(file.Content)
+	if err != nil {
+		return nil, err
+	}
+	file.Content = stripped
+	img, resize, err := p.decode(stripped, png.DecodeConfig, png.Decode, false)
+	if img == nil || err != nil || !resize {
+		return img, err
+	}
+	img = fit(img, p.maxDimension)
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return nil, err
+	}
+	file.Content = encoded.Bytes()
+	return img, nil
+}
+
+// decode decodes content when it is to be turned, resized or thumbnailed, and
+// is within maxDecodePixels. resize reports whether it is larger than the
+// maximum dimension.
+func (p *Processor) decode(content []byte, decodeConfig func(r io.Reader) (image.Config, error),
+	decode func(r io.Reader) (image.Image, error), turn bool) (img image.Image, resize bool, err error) {
+	config, err := decodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, false, err
+	}
+	if config.Width*config.Height > maxDecodePixels {
+		return nil, false, nil
+	}
+	resize = p.maxDimension > 0 && max(config.Width, config.Height) > p.maxDimension
+	if !resize && !turn && p.thumbnailSize == 0 {
+		return nil, false, nil
+	}
+	img, err = decode(bytes.NewReader(content))
+	return img, resize, err
+}
+
+// thumbnail returns the nth thumbnail, of img, shown inline in the HTML email.
+// It has the format of file, and its filename is also its content ID.
+func (p *Processor) thumbnail(file api.Attachment, img image.Image, n int) (api.Attachment, error) {
+	var encoded bytes.Buffer
+	var err error
+	small := fit(img, p.thumbnailSize)
+	if file.ContentType == PNG {
+		err = png.Encode(&encoded, small)
+	} else {
+		err = jpeg.Encode(&encoded, small, &jpeg.Options{Quality: thumbnailQuality})
+	}
+	if err != nil {
+		return api.Attachment{}, err
+	}
+	name := SanitizeFilename(fmt.Sprintf("thumbnail-%d-%s", n, file.Filename), file.ContentType)
+	return api.Attachment{Filename: name, ContentType: file.ContentType, Content: encoded.Bytes(), ContentID: name}, nil
+}
+
+// fit returns img scaled down to at most size pixels wide and high, keeping its
+// aspect ratio. Smaller images are returned as they are.
+func fit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+	if width >= height {
+		width, height = size, max(1, height*size/width)
+	} else {
+		width, height = max(1, width*size/height), size
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	return scaled
+}
+
+// orient returns img turned upright, by its Exif orientation. Orientations 2
+// to 8 are mirrored or rotated, as the TIFF 6.0 Orientation tag describes.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	width, height := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if orientation >= 5 {
+		dst = image.NewRGBA(image.Rect(0, 0, height, width))
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored horizontally.
+				dx, dy = width-1-x, y
+			case 3: // Rotated 180°.
+				dx, dy = width-1-x, height-1-y
+			case 4: // Mirrored vertically.
+				dx, dy = x, height-1-y
+			case 5: // Transposed.
+				dx, dy = y, x
+			case 6: // Rotated 90° clockwise.
+				dx, dy = height-1-y, x
+			case 7: // Transversed.
+				dx, dy = height-1-y, width-1-x
+			case 8: // Rotated 90° counter-clockwise.
+				dx, dy = y, width-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,291 @@
+package attachment_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// gpsMarker stands in for the GPS coordinates of a photo, in its metadata.
+const gpsMarker = "GPS 35.6586N 139.7454E"
+
+// testImage is 16x8 pixels, red on the left and blue on the right.
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			if x < 8 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("jpeg.Encode() returned error [%v]", err)
+	}
+	return encoded.Bytes()
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatalf("png.Encode() returned error [%v]", err)
+	}
+	return encoded.Bytes()
+}
+
+// withExif returns plain with an Exif segment of the given orientation, and a
+// comment, after its start of image marker.
+func withExif(plain []byte, orientation uint16) []byte {
+	tiff := []byte("II*\x00\x08\x00\x00\x00")
+	tiff = binary.LittleEndian.AppendUint16(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.LittleEndian.AppendUint16(tiff, 3)
+	tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+	tiff = binary.LittleEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, gpsMarker...)
+	exif := append([]byte("Exif\x00\x00"), tiff...)
+
+	content := append([]byte{}, plain[:2]...)
+	content = append(content, 0xff, 0xe1)
+	content = binary.BigEndian.AppendUint16(content, uint16(len(exif)+2))
+	content = append(content, exif...)
+	content = append(content, 0xff, 0xfe, 0x00, byte(len(gpsMarker)+2))
+	content = append(content, gpsMarker...)
+	return append(content, plain[2:]...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// withPNGMetadata returns plain with text and Exif chunks after its header.
+func withPNGMetadata(plain []byte) []byte {
+	// Signature and IHDR.
+	headerEnd := 8 + 12 + 13
+	content := append([]byte{}, plain[:headerEnd]...)
+	content = append(content, pngChunk("tEXt", []byte("Location\x00"+gpsMarker))...)
+	content = append(content, pngChunk("eXIf", []byte("II*\x00"+gpsMarker))...)
+	return append(content, plain[headerEnd:]...)
+}
+
+func newProcessor(maxDimension int, thumbnailSize int) *attachment.Processor {
+	return attachment.NewProcessor(&configuration.ContactFormConfiguration{
+		AttachmentMaxDimension:  maxDimension,
+		AttachmentThumbnails:    thumbnailSize > 0,
+		AttachmentThumbnailSize: thumbnailSize,
+	})
+}
+
+func decodedSize(t *testing.T, content []byte) image.Point {
+	t.Helper()
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("image.DecodeConfig() returned error [%v]", err)
+	}
+	return image.Pt(config.Width, config.Height)
+}
+
+func TestProcessStripsMetadata(t *testing.T) {
+	plainJPEG := encodeJPEG(t, testImage())
+	plainPNG := encodePNG(t, testImage())
+	type testSpec struct {
+		name     string
+		file     api.Attachment
+		expected []byte
+	}
+
+	testSpecs := []testSpec{
+		{name: "jpeg", file: api.Attachment{Filename: "venue.jpg", Content: withExif(plainJPEG, 1)}, expected: plainJPEG},
+		{name: "jpeg with trailing preview", file: api.Attachment{Filename: "venue.jpg", Content: append(withExif(plainJPEG, 1), plainJPEG...)},
+			expected: plainJPEG},
+		{name: "png", file: api.Attachment{Filename: "venue.png", Content: withPNGMetadata(plainPNG)}, expected: plainPNG},
+		{name: "pdf", file: api.Attachment{Filename: "brief.pdf", Content: []byte("%PDF-1.7\n" + gpsMarker)},
+			expected: []byte("%PDF-1.7\n" + gpsMarker)},
+		{name: "heic", file: api.Attachment{Filename: "venue.heic", Content: heicContent}, expected: heicContent},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := newProcessor(0, 0).Process([]api.Attachment{test.file})
+			if err != nil {
+				t.Fatalf("Process() returned error [%v]", err)
+			}
+			if len(actual) != 1 {
+				t.Fatalf("Process() attachments actual[%d], does not match expected[1]", len(actual))
+			}
+			// Images are not re-encoded, so they are the images without their metadata.
+			if !bytes.Equal(actual[0].Content, test.expected) {
+				t.Errorf("Process() content SHOULD be unchanged apart from metadata, actual[%d bytes], expected[%d bytes]",
+					len(actual[0].Content), len(test.expected))
+			}
+		})
+	}
+}
+
+func TestProcessTurnsImagesUpright(t *testing.T) {
+	plain := encodeJPEG(t, testImage())
+	type testSpec struct {
+		orientation  uint16
+		expectedSize image.Point
+		// expectedRed is a point in the red half of the upright image.
+		expectedRed image.Point
+	}
+
+	testSpecs := []testSpec{
+		{orientation: 1, expectedSize: image.Pt(16, 8), expectedRed: image.Pt(2, 4)},
+		{orientation: 3, expectedSize: image.Pt(16, 8), expectedRed: image.Pt(13, 4)},
+		{orientation: 6, expectedSize: image.Pt(8, 16), expectedRed: image.Pt(4, 2)},
+		{orientation: 8, expectedSize: image.Pt(8, 16), expectedRed: image.Pt(4, 13)},
+	}
+
+	for _, test := range testSpecs {
+		actual, err := newProcessor(0, 0).Process([]api.Attachment{{Filename: "venue.jpg", Content: withExif(plain, test.orientation)}})
+		if err != nil {
+			t.Fatalf("Process() with orientation %d returned error [%v]", test.orientation, err)
+		}
+		if bytes.Contains(actual[0].Content, []byte(gpsMarker)) {
+			t.Errorf("Process() with orientation %d SHOULD NOT keep the metadata", test.orientation)
+		}
+		img, err := jpeg.Decode(bytes.NewReader(actual[0].Content))
+		if err != nil {
+			t.Fatalf("jpeg.Decode() returned error [%v]", err)
+		}
+		if size := img.Bounds().Size(); size != test.expectedSize {
+			t.Errorf("orientation %d: size actual[%v], does not match expected[%v]", test.orientation, size, test.expectedSize)
+		}
+		if r, _, b, _ := img.At(test.expectedRed.X, test.expectedRed.Y).RGBA(); r>>8 < 200 || b>>8 > 60 {
+			t.Errorf("orientation %d: pixel at %v SHOULD be red, actual[r=%d b=%d]", test.orientation, test.expectedRed, r>>8, b>>8)
+		}
+	}
+}
+
+func TestProcessDownsizesImages(t *testing.T) {
+	type testSpec struct {
+		name         string
+		file         api.Attachment
+		maxDimension int
+		expectedSize image.Point
+	}
+
+	testSpecs := []testSpec{
+		{name: "jpeg", file: api.Attachment{Filename: "venue.jpg", Content: withExif(encodeJPEG(t, testImage()), 1)},
+			maxDimension: 8, expectedSize: image.Pt(8, 4)},
+		{name: "png", file: api.Attachment{Filename: "venue.png", Content: withPNGMetadata(encodePNG(t, testImage()))},
+			maxDimension: 4, expectedSize: image.Pt(4, 2)},
+		{name: "smaller", file: api.Attachment{Filename: "venue.png", Content: encodePNG(t, testImage())},
+			maxDimension: 32, expectedSize: image.Pt(16, 8)},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := newProcessor(test.maxDimension, 0).Process([]api.Attachment{test.file})
+			if err != nil {
+				t.Fatalf("Process() returned error [%v]", err)
+			}
+			if size := decodedSize(t, actual[0].Content); size != test.expectedSize {
+				t.Errorf("size actual[%v], does not match expected[%v]", size, test.expectedSize)
+			}
+			if bytes.Contains(actual[0].Content, []byte(gpsMarker)) {
+				t.Errorf("Process() SHOULD NOT keep the metadata")
+			}
+		})
+	}
+}
+
+func TestProcessAddsThumbnails(t *testing.T) {
+	files := []api.Attachment{
+		{Filename: "venue.jpg", Content: withExif(encodeJPEG(t, testImage()), 6), ContentID: "client-supplied"},
+		{Filename: "brief.pdf", Content: pdfContent},
+		{Filename: "plan", Content: encodePNG(t, testImage())},
+	}
+	actual, err := newProcessor(0, 4).Process(files)
+	if err != nil {
+		t.Fatalf("Process() returned error [%v]", err)
+	}
+
+	type expectedFile struct {
+		filename    string
+		contentType string
+		contentID   string
+		size        image.Point
+	}
+	expected := []expectedFile{
+		{filename: "venue.jpg", contentType: attachment.JPEG, size: image.Pt(8, 16)},
+		{filename: "brief.pdf", contentType: attachment.PDF},
+		{filename: "plan.png", contentType: attachment.PNG, size: image.Pt(16, 8)},
+		{filename: "thumbnail-1-venue.jpg", contentType: attachment.JPEG, contentID: "thumbnail-1-venue.jpg", size: image.Pt(2, 4)},
+		{filename: "thumbnail-2-plan.png", contentType: attachment.PNG, contentID: "thumbnail-2-plan.png", size: image.Pt(4, 2)},
+	}
+	if len(actual) != len(expected) {
+		t.Fatalf("Process() attachments actual[%d], does not match expected[%d]", len(actual), len(expected))
+	}
+	for i, file := range actual {
+		if file.Filename != expected[i].filename || file.ContentType != expected[i].contentType || file.ContentID != expected[i].contentID {
+			t.Errorf("attachment %d actual[%s, %s, %q], does not match expected[%s, %s, %q]", i,
+				file.Filename, file.ContentType, file.ContentID, expected[i].filename, expected[i].contentType, expected[i].contentID)
+		}
+		if expected[i].size != (image.Point{}) {
+			if size := decodedSize(t, file.Content); size != expected[i].size {
+				t.Errorf("attachment %d size actual[%v], does not match expected[%v]", i, size, expected[i].size)
+			}
+		}
+	}
+}
+
+func TestProcessSkipsDecodingLargeImages(t *testing.T) {
+	// A 10000x10000 PNG header, without image data, decodes to 100 megapixels.
+	header := binary.BigEndian.AppendUint32(nil, 10000)
+	header = binary.BigEndian.AppendUint32(header, 10000)
+	header = append(header, 8, 2, 0, 0, 0)
+	content := append([]byte("\x89PNG\r\n\x1a\n"), pngChunk("IHDR", header)...)
+	content = append(content, pngChunk("tEXt", []byte("Location\x00"+gpsMarker))...)
+	content = append(content, pngChunk("IEND", nil)...)
+
+	actual, err := newProcessor(2048, 320).Process([]api.Attachment{{Filename: "bomb.png", Content: content}})
+	if err != nil {
+		t.Fatalf("Process() returned error [%v]", err)
+	}
+	if len(actual) != 1 {
+		t.Fatalf("Process() attachments actual[%d], does not match expected[1], without a thumbnail", len(actual))
+	}
+	if bytes.Contains(actual[0].Content, []byte(gpsMarker)) {
+		t.Errorf("Process() SHOULD NOT keep the metadata of large images")
+	}
+}
+
+func TestProcessRejectsInvalidImages(t *testing.T) {
+	plain := encodeJPEG(t, testImage())
+	testSpecs := map[string][]byte{
+		"truncated jpeg":   plain[:len(plain)/2],
+		"jpeg header only": jpegContent,
+		"png header only":  pngContent,
+	}
+
+	for name, content := range testSpecs {
+		if _, err := newProcessor(0, 320).Process([]api.Attachment{{Filename: "venue", Content: content}}); err == nil {
+			t.Errorf("Process() of %s SHOULD return an error", name)
+		}
+	}
+}
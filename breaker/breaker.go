@@ -0,0 +1,251 @@
+// Package breaker wraps a mailer.Mailer in a circuit breaker, so that during
+// a provider outage emails fail fast, instead of every submission waiting on
+// failing calls.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+)
+
+const logStageBreaker = "breaker"
+
+// recordTimeout bounds recording the result of an email. It is not bound by
+// the request, whose deadline passing is often the provider timeout to record.
+const recordTimeout = 5 * time.Second
+
+// State is the state of a circuit.
+type State string
+
+const (
+	// StateClosed sends every email.
+	StateClosed State = "closed"
+	// StateOpen fails every email fast, until MailBreakerOpenFor has passed.
+	StateOpen State = "open"
+	// StateHalfOpen lets a single probe through. It closes the circuit if the
+	// provider answers, and opens it again otherwise.
+	StateHalfOpen State = "half_open"
+)
+
+// stateGaugeValues are the values of the MailBreakerState gauge.
+var stateGaugeValues = map[State]float64{StateClosed: 0, StateHalfOpen: 1, StateOpen: 2}
+
+// ErrOpen is returned, without calling the provider, while the circuit is open.
+var ErrOpen = errors.New("mail circuit breaker is open")
+
+// OpenError is returned while the circuit is open. It is an ErrOpen, and a
+// mailer.ErrProviderUnavailable, so callers retry it and respond 503.
+type OpenError struct {
+	retryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", ErrOpen, e.retryAfter)
+}
+
+func (e *OpenError) Unwrap() []error {
+	return []error{ErrOpen, mailer.ErrProviderUnavailable}
+}
+
+// RetryAfter is how long until the circuit lets a probe through.
+func (e *OpenError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// Circuit is the state of a breaker, as kept in a Store.
+type Circuit struct {
+	State State `json:"state"`
+	// Failures are the times of the outages counted while closed, within the window.
+	Failures []time.Time `json:"failures,omitempty"`
+	// OpenedAt is when the circuit last opened.
+	OpenedAt time.Time `json:"openedAt"`
+	// ProbeAt is when the half-open circuit last let a probe through.
+	ProbeAt time.Time `json:"probeAt"`
+}
+
+// Breaker is a mailer.Mailer sending through another, unless its circuit is open.
+type Breaker struct {
+	mailer           mailer.Mailer
+	name             string
+	failureThreshold int
+	window           time.Duration
+	openFor          time.Duration
+	store            Store
+	logger           *slog.Logger
+	meter            metrics.Meter
+	now              func() time.Time
+}
+
+type Option func(*Breaker)
+
+// WithStore sets the store of the circuit, eg. a PostgresStore shared between
+// instances. Without it, each Breaker keeps its circuit in memory.
+func WithStore(store Store) Option {
+	return func(b *Breaker) {
+		b.store = store
+	}
+}
+
+// WithLogger sets the logger. Without it, a default logger redacting by the
+// configured LogPIIPolicy is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *Breaker) {
+		b.logger = logger
+	}
+}
+
+// WithMeter sets the meter for the circuit state and rejections. Without it,
+// metrics are discarded.
+func WithMeter(meter metrics.Meter) Option {
+	return func(b *Breaker) {
+		b.meter = meter
+	}
+}
+
+// WithClock sets the clock used to count failures and time the open circuit.
+func WithClock(now func() time.Time) Option {
+	return func(b *Breaker) {
+		b.now = now
+	}
+}
+
+// New returns a Breaker around m, opening after the configured
+// MailBreakerFailures within MailBreakerWindow. Its circuit is named by the
+// configured MailProvider.
+func New(m mailer.Mailer, cfg *configuration.ContactFormConfiguration, opts ...Option) *Breaker {
+	b := &Breaker{
+		mailer:           m,
+		name:             cfg.MailProvider,
+		failureThreshold: cfg.MailBreakerFailures,
+		window:           cfg.MailBreakerWindow,
+		openFor:          cfg.MailBreakerOpenFor,
+		logger:           logging.ForPolicy(cfg.LogPIIPolicy),
+		meter:            metrics.Noop{},
+		now:              time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.store == nil {
+		b.store = NewMemoryStore()
+	}
+	return b
+}
+
+// SendEmail sends request, unless the circuit is open. Should the store fail,
+// the email is sent anyway: an unavailable store must not stop email.
+func (b *Breaker) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	retryAfter, err := b.allow(ctx)
+	if err != nil {
+		b.logger.ErrorContext(ctx, "error reading mail circuit, sending anyway",
+			logging.KeyStage, logStageBreaker, logging.KeyProvider, b.name, logging.KeyError, err.Error())
+	} else if retryAfter > 0 {
+		b.meter.IncCounter(ctx, metrics.MailBreakerRejectionsTotal, metrics.Labels{metrics.LabelProvider: b.name})
+		return &OpenError{retryAfter: retryAfter}
+	}
+
+	sendErr := b.mailer.SendEmail(ctx, request)
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+	if err := b.record(recordCtx, sendErr); err != nil {
+		b.logger.ErrorContext(ctx, "error recording mail circuit result",
+			logging.KeyStage, logStageBreaker, logging.KeyProvider, b.name, logging.KeyError, err.Error())
+	}
+	return sendErr
+}
+
+// allow reports how long to wait while the circuit is open. It is zero when
+// the email may be sent: while closed, or as the probe of a half-open circuit.
+func (b *Breaker) allow(ctx context.Context) (time.Duration, error) {
+	var retryAfter time.Duration
+	err := b.update(ctx, func(circuit *Circuit, now time.Time) {
+		switch circuit.State {
+		case StateOpen:
+			if retryAfter = circuit.OpenedAt.Add(b.openFor).Sub(now); retryAfter <= 0 {
+				circuit.State, circuit.ProbeAt = StateHalfOpen, now
+			}
+		case StateHalfOpen:
+			// A single probe at a time. A probe not recorded within openFor, eg.
+			// because its instance stopped, is replaced.
+			if retryAfter = circuit.ProbeAt.Add(b.openFor).Sub(now); retryAfter <= 0 {
+				circuit.ProbeAt = now
+			}
+		}
+	})
+	return retryAfter, err
+}
+
+// record counts an outage, opening the circuit at the threshold, or closes
+// a half-open circuit once the provider answers. A probe that never reached
+// the provider, eg. a request refused for header injection, lets the next
+// email probe instead.
+func (b *Breaker) record(ctx context.Context, sendErr error) error {
+	outage, answered := isOutage(sendErr), isAnswer(sendErr)
+	return b.update(ctx, func(circuit *Circuit, now time.Time) {
+		switch {
+		case circuit.State == StateHalfOpen && outage:
+			circuit.State, circuit.OpenedAt = StateOpen, now
+		case circuit.State == StateHalfOpen && answered:
+			*circuit = Circuit{State: StateClosed}
+		case circuit.State == StateHalfOpen:
+			circuit.ProbeAt = time.Time{}
+		case circuit.State == StateClosed && outage:
+			failures := []time.Time{now}
+			for _, failure := range circuit.Failures {
+				if now.Sub(failure) < b.window {
+					failures = append(failures, failure)
+				}
+			}
+			circuit.Failures = failures
+			if len(failures) >= b.failureThreshold {
+				*circuit = Circuit{State: StateOpen, OpenedAt: now}
+			}
+		}
+	})
+}
+
+// update applies fn to the circuit in the store, logging and measuring its state.
+func (b *Breaker) update(ctx context.Context, fn func(circuit *Circuit, now time.Time)) error {
+	var from, to State
+	err := b.store.Update(ctx, b.name, func(circuit *Circuit) {
+		if circuit.State == "" {
+			circuit.State = StateClosed
+		}
+		from = circuit.State
+		fn(circuit, b.now())
+		to = circuit.State
+	})
+	if err != nil {
+		return err
+	}
+	b.meter.SetGauge(ctx, metrics.MailBreakerState, stateGaugeValues[to], metrics.Labels{metrics.LabelProvider: b.name})
+	if from != to {
+		b.logger.WarnContext(ctx, "mail circuit "+string(to),
+			logging.KeyStage, logStageBreaker, logging.KeyProvider, b.name, "from", from, "to", to)
+	}
+	return nil
+}
+
+// isOutage reports whether err shows the provider is down or overloaded.
+// Rejections, such as an invalid recipient, show it is answering.
+func isOutage(err error) bool {
+	return errors.Is(err, mailer.ErrProviderUnavailable) || errors.Is(err, mailer.ErrProviderTimeout) ||
+		errors.Is(err, mailer.ErrProviderRateLimited)
+}
+
+// isAnswer reports whether err, unless an outage, came from the provider:
+// nil, or its rejection. Other errors, such as a cancelled request, may never
+// have reached it.
+func isAnswer(err error) bool {
+	var providerErr *mailer.ProviderError
+	return err == nil || errors.As(err, &providerErr)
+}
@@ -0,0 +1,294 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/breaker"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+)
+
+var (
+	outage    = &mailer.ProviderError{Provider: "sendgrid", StatusCode: 503, Err: mailer.ErrProviderUnavailable}
+	rejection = &mailer.ProviderError{Provider: "sendgrid", StatusCode: 400, Err: mailer.ErrInvalidRecipient}
+	labels    = metrics.Labels{metrics.LabelProvider: "sendgrid"}
+)
+
+func TestBreakerOpensAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+	mockedMailer := &MockMailer{Results: []error{outage, outage, outage}}
+	registry := metrics.NewRegistry()
+	b := setupBreaker(mockedMailer, breaker.NewMemoryStore(), clock, breaker.WithMeter(registry))
+
+	for i := 0; i < 3; i++ {
+		if err := b.SendEmail(ctx, &api.EmailFormRequest{}); !errors.Is(err, outage) {
+			t.Fatalf("SendEmail() %d actual[%v], does not match expected[%v]", i+1, err, outage)
+		}
+		clock.now = clock.now.Add(10 * time.Second)
+	}
+
+	err := b.SendEmail(ctx, &api.EmailFormRequest{})
+	if !errors.Is(err, breaker.ErrOpen) || !errors.Is(err, mailer.ErrProviderUnavailable) {
+		t.Errorf("SendEmail() actual[%v], SHOULD be breaker.ErrOpen and mailer.ErrProviderUnavailable", err)
+	}
+	if actual := mailer.RetryAfter(err); actual != 20*time.Second {
+		t.Errorf("RetryAfter() actual[%v], does not match expected[20s]", actual)
+	}
+	if mockedMailer.Calls != 3 {
+		t.Errorf("SendEmail() calls actual[%d], SHOULD NOT call the provider while open", mockedMailer.Calls)
+	}
+	if actual := registry.Gauge(metrics.MailBreakerState, labels); actual != 2 {
+		t.Errorf("state gauge actual[%v], does not match expected[2]", actual)
+	}
+	if actual := registry.Counter(metrics.MailBreakerRejectionsTotal, labels); actual != 1 {
+		t.Errorf("rejections actual[%v], does not match expected[1]", actual)
+	}
+}
+
+func TestBreakerCountsOutagesWithinWindow(t *testing.T) {
+	type testSpec struct {
+		name         string
+		results      []error
+		interval     time.Duration
+		expectedOpen bool
+	}
+
+	testSpecs := []testSpec{
+		{name: "outages within window", results: []error{outage, outage, outage}, interval: 20 * time.Second, expectedOpen: true},
+		{name: "outages spread over windows", results: []error{outage, outage, outage}, interval: 40 * time.Second},
+		{name: "rejections", results: []error{rejection, rejection, rejection}, interval: time.Second},
+		{name: "unclassified errors", results: []error{errors.New("mailer error"), errors.New("mailer error"), errors.New("mailer error")}, interval: time.Second},
+		{name: "successes between outages", results: []error{outage, nil, outage, nil, outage}, interval: time.Second, expectedOpen: true},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &testClock{now: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+			b := setupBreaker(&MockMailer{Results: test.results}, breaker.NewMemoryStore(), clock)
+			for range test.results {
+				_ = b.SendEmail(ctx, &api.EmailFormRequest{})
+				clock.now = clock.now.Add(test.interval)
+			}
+			err := b.SendEmail(ctx, &api.EmailFormRequest{})
+			if actual := errors.Is(err, breaker.ErrOpen); actual != test.expectedOpen {
+				t.Errorf("open actual[%v], does not match expected[%v]", actual, test.expectedOpen)
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpens(t *testing.T) {
+	type testSpec struct {
+		name          string
+		probeResult   error
+		expectedState float64
+		expectedOpen  bool
+		// expectedProbe is whether the next email probes again, as a half-open circuit.
+		expectedProbe bool
+	}
+
+	testSpecs := []testSpec{
+		{name: "probe succeeds", expectedState: 0},
+		{name: "probe rejected", probeResult: rejection, expectedState: 0},
+		{name: "probe fails", probeResult: outage, expectedState: 2, expectedOpen: true},
+		{name: "probe cancelled", probeResult: context.Canceled, expectedState: 1, expectedProbe: true},
+		{name: "probe refused for header injection", probeResult: &mailer.HeaderInjectionError{Field: "name"},
+			expectedState: 1, expectedProbe: true},
+		{name: "probe fails unclassified", probeResult: errors.New("mailer error"), expectedState: 1, expectedProbe: true},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			clock := &testClock{now: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+			registry := metrics.NewRegistry()
+			mockedMailer := &MockMailer{Results: []error{outage, outage, outage}}
+			b := setupBreaker(mockedMailer, breaker.NewMemoryStore(), clock, breaker.WithMeter(registry))
+			for i := 0; i < 3; i++ {
+				_ = b.SendEmail(ctx, &api.EmailFormRequest{})
+			}
+			clock.now = clock.now.Add(30 * time.Second)
+
+			// The probe is in flight while another email arrives.
+			mockedMailer.During = func() {
+				if actual := registry.Gauge(metrics.MailBreakerState, labels); actual != 1 {
+					t.Errorf("state gauge during probe actual[%v], does not match expected[1]", actual)
+				}
+				if err := b.SendEmail(ctx, &api.EmailFormRequest{}); !errors.Is(err, breaker.ErrOpen) {
+					t.Errorf("SendEmail() during probe actual[%v], SHOULD be breaker.ErrOpen", err)
+				}
+			}
+			mockedMailer.Results = append(mockedMailer.Results, test.probeResult)
+			if err := b.SendEmail(ctx, &api.EmailFormRequest{}); !errors.Is(err, test.probeResult) {
+				t.Errorf("probe SendEmail() actual[%v], does not match expected[%v]", err, test.probeResult)
+			}
+			mockedMailer.During = nil
+
+			if actual := registry.Gauge(metrics.MailBreakerState, labels); actual != test.expectedState {
+				t.Errorf("state gauge actual[%v], does not match expected[%v]", actual, test.expectedState)
+			}
+			calls := mockedMailer.Calls
+			err := b.SendEmail(ctx, &api.EmailFormRequest{})
+			if actual := errors.Is(err, breaker.ErrOpen); actual != test.expectedOpen {
+				t.Errorf("open after probe actual[%v], does not match expected[%v]", actual, test.expectedOpen)
+			}
+			if test.expectedProbe {
+				if actual := registry.Gauge(metrics.MailBreakerState, labels); actual != 0 || mockedMailer.Calls != calls+1 {
+					t.Errorf("next email actual[state %v, calls %d], SHOULD probe and close the circuit", actual, mockedMailer.Calls-calls)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerReplacesLostProbe(t *testing.T) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+	store := breaker.NewMemoryStore()
+	_ = store.Update(ctx, "sendgrid", func(circuit *breaker.Circuit) {
+		*circuit = breaker.Circuit{State: breaker.StateHalfOpen, ProbeAt: clock.now}
+	})
+	b := setupBreaker(&MockMailer{}, store, clock)
+
+	clock.now = clock.now.Add(29 * time.Second)
+	if err := b.SendEmail(ctx, &api.EmailFormRequest{}); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("SendEmail() while probing actual[%v], SHOULD be breaker.ErrOpen", err)
+	}
+	clock.now = clock.now.Add(time.Second)
+	if err := b.SendEmail(ctx, &api.EmailFormRequest{}); err != nil {
+		t.Errorf("SendEmail() after a lost probe actual[%v], SHOULD probe again", err)
+	}
+}
+
+func TestBreakerSharesStore(t *testing.T) {
+	testSharedStore(t, breaker.NewMemoryStore())
+}
+
+func TestBreakerSendsWhenStoreFails(t *testing.T) {
+	mockedMailer := &MockMailer{}
+	b := setupBreaker(mockedMailer, FailingStore{}, &testClock{now: time.Now()})
+	if err := b.SendEmail(context.Background(), &api.EmailFormRequest{}); err != nil {
+		t.Errorf("SendEmail() returned error [%v]", err)
+	}
+	if mockedMailer.Calls != 1 {
+		t.Errorf("SendEmail() calls actual[%d], does not match expected[1]", mockedMailer.Calls)
+	}
+}
+
+func TestBreakerRecordsOutagesAfterDeadline(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	clock := &testClock{now: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)}
+	timeout := fmt.Errorf("error sending email: sendgrid: %w: %w", mailer.ErrProviderTimeout, context.DeadlineExceeded)
+	store := &ContextStore{Store: breaker.NewMemoryStore()}
+	b := setupBreaker(&MockMailer{Results: []error{timeout, timeout, timeout}}, store, clock)
+
+	for i := 0; i < 3; i++ {
+		_ = b.SendEmail(ctx, &api.EmailFormRequest{})
+	}
+	if err := b.SendEmail(context.Background(), &api.EmailFormRequest{}); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("SendEmail() after timeouts actual[%v], SHOULD be breaker.ErrOpen", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	cfg := &configuration.ContactFormConfiguration{MailBreakerStore: configuration.MailBreakerStoreMemory}
+	if store, err := breaker.Open(context.Background(), cfg); err != nil || store == nil {
+		t.Errorf("Open() actual[%v, %v], SHOULD return a MemoryStore", store, err)
+	}
+	cfg.MailBreakerStore = "redis"
+	if _, err := breaker.Open(context.Background(), cfg); err == nil {
+		t.Errorf("Open() of an unknown store SHOULD return an error")
+	}
+}
+
+// Support functions
+
+// testSharedStore checks that instances sharing store share the circuit.
+func testSharedStore(t *testing.T, store breaker.Store) {
+	ctx := context.Background()
+	clock := &testClock{now: time.Now()}
+	first := setupBreaker(&MockMailer{Results: []error{outage, outage, outage}}, store, clock)
+	second := setupBreaker(&MockMailer{}, store, clock)
+
+	for i := 0; i < 3; i++ {
+		_ = first.SendEmail(ctx, &api.EmailFormRequest{})
+	}
+	if err := second.SendEmail(ctx, &api.EmailFormRequest{}); !errors.Is(err, breaker.ErrOpen) {
+		t.Errorf("second instance SendEmail() actual[%v], SHOULD be breaker.ErrOpen", err)
+	}
+
+	clock.now = clock.now.Add(30 * time.Second)
+	if err := second.SendEmail(ctx, &api.EmailFormRequest{}); err != nil {
+		t.Errorf("second instance probe SendEmail() returned error [%v]", err)
+	}
+	if err := first.SendEmail(ctx, &api.EmailFormRequest{}); err != nil {
+		t.Errorf("first instance SendEmail() after the probe returned error [%v], SHOULD be closed", err)
+	}
+}
+
+func setupBreaker(m mailer.Mailer, store breaker.Store, clock *testClock, opts ...breaker.Option) *breaker.Breaker {
+	cfg := &configuration.ContactFormConfiguration{
+		MailProvider:        configuration.MailProviderSendGrid,
+		MailBreakerFailures: 3,
+		MailBreakerWindow:   time.Minute,
+		MailBreakerOpenFor:  30 * time.Second,
+	}
+	opts = append([]breaker.Option{breaker.WithStore(store), breaker.WithClock(clock.Now), breaker.WithLogger(logging.Discard())}, opts...)
+	return breaker.New(m, cfg, opts...)
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// Mocks
+
+// MockMailer returns Results in turn, then nil. During runs while sending.
+type MockMailer struct {
+	Results []error
+	During  func()
+	Calls   int
+}
+
+func (m *MockMailer) SendEmail(_ context.Context, _ *api.EmailFormRequest) error {
+	m.Calls++
+	if m.During != nil {
+		m.During()
+	}
+	if m.Calls > len(m.Results) {
+		return nil
+	}
+	return m.Results[m.Calls-1]
+}
+
+// ContextStore fails once ctx is done, as PostgresStore does.
+type ContextStore struct {
+	breaker.Store
+}
+
+func (s *ContextStore) Update(ctx context.Context, name string, fn func(circuit *breaker.Circuit)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Update(ctx, name, fn)
+}
+
+type FailingStore struct{}
+
+func (FailingStore) Update(_ context.Context, _ string, _ func(circuit *breaker.Circuit)) error {
+	return errors.New("store unavailable")
+}
@@ -0,0 +1,129 @@
+package breaker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	// Registers the "pgx" database/sql driver used by OpenPostgres.
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// Store keeps circuits by name. Implementations must be safe for concurrent use.
+type Store interface {
+	// Update applies fn to the named circuit, and saves it, atomically. A
+	// circuit not yet stored is passed as the zero Circuit.
+	Update(ctx context.Context, name string, fn func(circuit *Circuit)) error
+}
+
+// Open returns the configured Store: a MemoryStore, or a PostgresStore in the
+// SUBMISSION_STORE_DSN database.
+func Open(ctx context.Context, cfg *configuration.ContactFormConfiguration) (Store, error) {
+	switch cfg.MailBreakerStore {
+	case configuration.MailBreakerStoreMemory:
+		return NewMemoryStore(), nil
+	case configuration.MailBreakerStorePostgres:
+		return OpenPostgres(ctx, cfg.SubmissionStoreDSN)
+	default:
+		return nil, fmt.Errorf("unknown mail breaker store %q", cfg.MailBreakerStore)
+	}
+}
+
+// MemoryStore keeps circuits in memory, so each instance has its own.
+type MemoryStore struct {
+	mu       sync.Mutex
+	circuits map[string]Circuit
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{circuits: make(map[string]Circuit)}
+}
+
+func (s *MemoryStore) Update(_ context.Context, name string, fn func(circuit *Circuit)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	circuit := s.circuits[name]
+	fn(&circuit)
+	s.circuits[name] = circuit
+	return nil
+}
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS contact_mail_circuits (
+	name       TEXT PRIMARY KEY,
+	circuit    JSONB NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+`
+
+// PostgresStore keeps circuits in PostgreSQL, so every instance shares them.
+// Updates lock the circuit's row. The caller opens db with a driver of its
+// choice, such as github.com/jackc/pgx/v5/stdlib.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// OpenPostgres connects to dsn with the pgx driver, and migrates the schema.
+func OpenPostgres(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := NewPostgresStore(db)
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating mail breaker store: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Migrate creates the table, if it does not exist.
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, postgresSchema)
+	return err
+}
+
+func (s *PostgresStore) Update(ctx context.Context, name string, fn func(circuit *Circuit)) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO contact_mail_circuits (name, circuit) VALUES ($1, '{}') ON CONFLICT (name) DO NOTHING`, name); err != nil {
+		return err
+	}
+	var stored []byte
+	if err := tx.QueryRowContext(ctx,
+		`SELECT circuit FROM contact_mail_circuits WHERE name = $1 FOR UPDATE`, name).Scan(&stored); err != nil {
+		return err
+	}
+	var circuit Circuit
+	if err := json.Unmarshal(stored, &circuit); err != nil {
+		return fmt.Errorf("decoding mail circuit %s: %w", name, err)
+	}
+	fn(&circuit)
+	updated, err := json.Marshal(circuit)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE contact_mail_circuits SET circuit = $2, updated_at = now() WHERE name = $1`, name, updated); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,79 @@
+// Command contact-outbox delivers submissions queued with DELIVERY_MODE=outbox.
+// It drains the outbox, and purges submissions past their
+// SUBMISSION_RETENTION_<STATUS>, every -interval until interrupted, or once
+// with -once, eg. from a scheduled job.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/breaker"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/outbox"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+func main() {
+	once := flag.Bool("once", false, "drain the outbox once, then exit")
+	interval := flag.Duration("interval", 30*time.Second, "how often to drain the outbox")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, *once, *interval); err != nil {
+		fmt.Fprintln(os.Stderr, "contact-outbox:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, once bool, interval time.Duration) error {
+	cfg := configuration.NewContactFormConfiguration()
+	if !cfg.Valid() {
+		return errors.New("configuration is invalid")
+	}
+	submissionStore, err := store.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if submissionStore == nil {
+		return errors.New("SUBMISSION_STORE is required")
+	}
+
+	logger := logging.ForPolicy(cfg.LogPIIPolicy)
+	m, err := mailer.New(cfg, mailer.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	// While the provider is down, the breaker fails the remaining emails fast,
+	// and the worker retries them after the backoff.
+	circuits, err := breaker.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	m = breaker.New(m, cfg, breaker.WithStore(circuits), breaker.WithLogger(logger))
+	worker := outbox.NewWorker(cfg, submissionStore, m, outbox.WithLogger(logger))
+	if !once {
+		return worker.Run(ctx, interval)
+	}
+
+	result, err := worker.Drain(ctx)
+	if err != nil {
+		return err
+	}
+	purged, err := worker.Purge(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("sent=%d retried=%d dead_lettered=%d purged=%d\n", result.Sent, result.Retried, result.DeadLettered, purged)
+	return nil
+}
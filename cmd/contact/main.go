@@ -0,0 +1,359 @@
+// Command contact runs the contact form locally, without a DigitalOcean function.
+//
+//	contact validate <request.json>
+//	contact render <request.json>
+//	contact check-config
+//	contact send [-backend sendgrid|mailgun|postmark|ses|resend|stdout] <request.json>
+//	contact serve [-addr localhost:8080]
+//
+// Request files hold the function's JSON input, eg. {"name": ..., "email": ...,
+// "message": ...}. "-" reads the request from stdin. Configuration is read from
+// the same environment variables as the function.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/contactform"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/devserver"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/sanitize"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/scanner"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+const usage = `usage:
+  contact validate <request.json>
+  contact render <request.json>
+  contact check-config
+  contact send [-backend sendgrid|mailgun|postmark|ses|resend|stdout] <request.json>
+  contact serve [-addr localhost:8080]`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	if err := c.run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "contact:", err)
+		os.Exit(1)
+	}
+}
+
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	// stderr receives the logs, leaving stdout to the command output.
+	stderr io.Writer
+}
+
+func (c *cli) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cfg := configuration.NewContactFormConfiguration()
+	switch args[0] {
+	case "validate":
+		return c.validate(ctx, cfg, args[1:])
+	case "render":
+		return c.render(ctx, cfg, args[1:])
+	case "check-config":
+		return c.checkConfig(cfg)
+	case "send":
+		return c.send(ctx, cfg, args[1:])
+	case "serve":
+		return c.serve(ctx, cfg, args[1:])
+	default:
+		return errUsage
+	}
+}
+
+func (c *cli) validate(ctx context.Context, cfg *configuration.ContactFormConfiguration, args []string) error {
+	request, err := c.readRequest(args)
+	if err != nil {
+		return err
+	}
+	if err := c.check(ctx, cfg, request); err != nil {
+		return err
+	}
+	fmt.Fprintln(c.stdout, "valid")
+	return nil
+}
+
+// render prints the configured provider's request for request. Nothing is sent.
+func (c *cli) render(ctx context.Context, cfg *configuration.ContactFormConfiguration, args []string) error {
+	request, err := c.readRequest(args)
+	if err != nil {
+		return err
+	}
+	renderer, err := c.renderer(cfg)
+	if err != nil {
+		return err
+	}
+	body, err := renderer.Render(requestid.NewContext(ctx, requestid.New()), request)
+	if err != nil {
+		return err
+	}
+	return c.printBody(body)
+}
+
+// checkConfig prints the effective configuration, with secrets redacted.
+func (c *cli) checkConfig(cfg *configuration.ContactFormConfiguration) error {
+	w := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	for _, setting := range cfg.Settings() {
+		fmt.Fprintf(w, "%s\t%s\n", setting.Name, setting.Value)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	problems := cfg.Problems()
+	if len(problems) == 0 {
+		fmt.Fprintln(c.stdout, "\nconfiguration is valid")
+		return nil
+	}
+	fmt.Fprintln(c.stdout, "\nconfiguration is invalid:")
+	for _, problem := range problems {
+		fmt.Fprintln(c.stdout, "  "+problem)
+	}
+	return errors.New("configuration is invalid")
+}
+
+func (c *cli) send(ctx context.Context, cfg *configuration.ContactFormConfiguration, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	backend := flags.String("backend", cfg.MailProvider, "mailer to send with: "+strings.Join(backendNames(), ", "))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	newMailer, ok := backends[*backend]
+	if !ok {
+		return fmt.Errorf("unknown backend %q, expected one of: %s", *backend, strings.Join(backendNames(), ", "))
+	}
+
+	request, err := c.readRequest(flags.Args())
+	if err != nil {
+		return err
+	}
+	if err := c.check(ctx, cfg, request); err != nil {
+		return err
+	}
+	m, err := newMailer(cfg, c)
+	if err != nil {
+		return err
+	}
+	requestID := requestid.New()
+	if err := m.SendEmail(requestid.NewContext(ctx, requestID), request); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stdout, "sent with %s, request ID %s\n", *backend, requestID)
+	return nil
+}
+
+// serve runs the contact form on addr until ctx is done. Emails are captured,
+// and listed on the index page, instead of sent.
+func (c *cli) serve(ctx context.Context, cfg *configuration.ContactFormConfiguration, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	addr := flags.String("addr", "localhost:8080", "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	// The capture mailer needs no provider settings, and sends at once.
+	if len(cfg.MailProviderProblems()) > 0 {
+		cfg.MailProvider = configuration.MailProviderSendGrid
+		if strings.TrimSpace(cfg.SendGridApiKey) == "" {
+			cfg.SendGridApiKey = "unused-by-capture-mailer"
+		}
+	}
+	cfg.DeliveryMode = configuration.DeliveryModeSync
+	logger := c.logger(cfg)
+	capture := mailer.NewCaptureMailer()
+	attachmentScanner, err := scanner.New(cfg)
+	if err != nil {
+		return err
+	}
+	newContactForm := func() contactform.ContactForm {
+		return contactform.NewContactFormImpl(cfg,
+			validation.NewContactFormValidator(validation.WithLogger(logger), validation.WithConfiguration(cfg)),
+			capture, contactform.WithLogger(logger), contactform.WithScanner(attachmentScanner))
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           devserver.New(newContactForm, capture, devserver.WithLogger(logger)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	fmt.Fprintf(c.stdout, "contact form: POST http://%s%s\ncaptured emails: http://%s/\n",
+		listener.Addr(), devserver.ContactPath, listener.Addr())
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdownCtx)
+	}
+}
+
+// backends are the mailers `contact send` can use, by name: each provider,
+// and stdout.
+var backends = map[string]func(cfg *configuration.ContactFormConfiguration, c *cli) (mailer.Mailer, error){
+	configuration.MailProviderSendGrid: providerBackend(configuration.MailProviderSendGrid),
+	configuration.MailProviderMailgun:  providerBackend(configuration.MailProviderMailgun),
+	configuration.MailProviderPostmark: providerBackend(configuration.MailProviderPostmark),
+	configuration.MailProviderSES:      providerBackend(configuration.MailProviderSES),
+	configuration.MailProviderResend:   providerBackend(configuration.MailProviderResend),
+	// stdout prints the configured provider's request instead of sending it.
+	"stdout": func(cfg *configuration.ContactFormConfiguration, c *cli) (mailer.Mailer, error) {
+		renderer, err := c.renderer(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &stdoutMailer{renderer: renderer, cli: c}, nil
+	},
+}
+
+// providerBackend sends with provider, whatever the configured MAIL_PROVIDER.
+func providerBackend(provider string) func(cfg *configuration.ContactFormConfiguration, c *cli) (mailer.Mailer, error) {
+	return func(cfg *configuration.ContactFormConfiguration, c *cli) (mailer.Mailer, error) {
+		providerCfg := *cfg
+		providerCfg.MailProvider = provider
+		if problems := providerCfg.MailProviderProblems(); len(problems) > 0 {
+			return nil, errors.New(strings.Join(problems, ", "))
+		}
+		return mailer.New(&providerCfg, mailer.WithLogger(c.logger(cfg)))
+	}
+}
+
+func backendNames() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type stdoutMailer struct {
+	renderer mailer.Renderer
+	cli      *cli
+}
+
+func (m *stdoutMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	body, err := m.renderer.Render(ctx, request)
+	if err != nil {
+		return err
+	}
+	return m.cli.printBody(body)
+}
+
+// renderer returns the configured provider's Mailer, to render requests.
+func (c *cli) renderer(cfg *configuration.ContactFormConfiguration) (mailer.Renderer, error) {
+	m, err := mailer.New(cfg, mailer.WithLogger(c.logger(cfg)))
+	if err != nil {
+		return nil, err
+	}
+	renderer, ok := m.(mailer.Renderer)
+	if !ok {
+		return nil, fmt.Errorf("mail provider %s cannot render requests", cfg.MailProvider)
+	}
+	return renderer, nil
+}
+
+// check sanitizes and validates request, as the function does, with the
+// configured input policies and email checks, printing any errors.
+func (c *cli) check(ctx context.Context, cfg *configuration.ContactFormConfiguration, request *api.EmailFormRequest) error {
+	if fieldErrors := sanitize.New(cfg).Sanitize(request); fieldErrors != nil {
+		c.printFieldErrors(fieldErrors)
+		return errors.New("request is invalid")
+	}
+	validator := validation.NewContactFormValidator(validation.WithLogger(logging.New(c.stderr, slog.LevelWarn, nil)),
+		validation.WithConfiguration(cfg))
+	validator.CheckContext(ctx, request)
+	if validator.Valid() {
+		return nil
+	}
+	if globalError := validator.GlobalError(); globalError != "" {
+		fmt.Fprintln(c.stdout, globalError)
+	}
+	c.printFieldErrors(validator.FieldErrors())
+	return errors.New("request is invalid")
+}
+
+func (c *cli) printFieldErrors(fieldErrors map[string]string) {
+	fields := make([]string, 0, len(fieldErrors))
+	for field := range fieldErrors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		fmt.Fprintf(c.stdout, "%s: %s\n", field, fieldErrors[field])
+	}
+}
+
+func (c *cli) readRequest(args []string) (*api.EmailFormRequest, error) {
+	if len(args) != 1 {
+		return nil, errUsage
+	}
+	var r io.Reader = c.stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	var request api.EmailFormRequest
+	if err := json.NewDecoder(r).Decode(&request); err != nil {
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	return &request, nil
+}
+
+// printBody prints a provider request body, indented when it is JSON. Mailgun
+// requests are form encoded, and printed as they are.
+func (c *cli) printBody(body []byte) error {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		_, err := fmt.Fprintln(c.stdout, string(body))
+		return err
+	}
+	_, err := fmt.Fprintln(c.stdout, indented.String())
+	return err
+}
+
+func (c *cli) logger(cfg *configuration.ContactFormConfiguration) *slog.Logger {
+	return logging.New(c.stderr, slog.LevelInfo, redaction.New(cfg.LogPIIPolicy))
+}
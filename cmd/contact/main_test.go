@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	validRequest   = `{"name": "Gavin Thomas", "email": "test@example.com", "message": "This is a test message."}`
+	invalidRequest = `{"name": "", "email": "not-an-email", "message": "This is a test message."}`
+)
+
+func TestRun(t *testing.T) {
+	type testSpec struct {
+		args             []string
+		stdin            string
+		env              map[string]string
+		expectedError    bool
+		expectedOutput   []string
+		unexpectedOutput []string
+	}
+
+	testSpecs := []testSpec{
+		{args: []string{"validate", "-"}, stdin: validRequest, expectedOutput: []string{"valid"}},
+		{
+			args:           []string{"validate", "-"},
+			stdin:          invalidRequest,
+			expectedError:  true,
+			expectedOutput: []string{"email: email must be a valid email address\nname: name must be between 1 and 100 characters"},
+		},
+		{args: []string{"validate", "-"}, stdin: "{", expectedError: true},
+		{
+			args:           []string{"validate", "-"},
+			stdin:          `{"name": "Gavin", "email": "test@exa\u200bmple.com", "message": "Hello"}`,
+			expectedError:  true,
+			expectedOutput: []string{"email: email must not contain control, bidirectional or invisible characters"},
+		},
+		{
+			args:           []string{"render", "-"},
+			stdin:          validRequest,
+			expectedOutput: []string{`"reply_to": {`, `"email": "test@example.com"`, `"X-Request-Id"`},
+		},
+		{
+			args:             []string{"check-config"},
+			env:              map[string]string{"SENDGRID_API_KEY": "SG.s3cret"},
+			expectedOutput:   []string{"SENDGRID_API_KEY", "[redacted, 9 characters]", "DELIVERY_MODE", "configuration is valid"},
+			unexpectedOutput: []string{"s3cret"},
+		},
+		{
+			args:           []string{"check-config"},
+			env:            map[string]string{"SENDGRID_API_KEY": ""},
+			expectedError:  true,
+			expectedOutput: []string{"configuration is invalid:\n  SENDGRID_API_KEY is required"},
+		},
+		{
+			args:           []string{"send", "-backend", "stdout", "-"},
+			stdin:          validRequest,
+			expectedOutput: []string{`"email": "test@example.com"`, "sent with stdout, request ID "},
+		},
+		{
+			args:             []string{"send", "-backend", "stdout", "-"},
+			stdin:            invalidRequest,
+			expectedError:    true,
+			unexpectedOutput: []string{"sent with"},
+		},
+		{args: []string{"send", "-backend", "carrier-pigeon", "-"}, stdin: validRequest, expectedError: true},
+		{
+			args:           []string{"render", "-"},
+			stdin:          validRequest,
+			env:            map[string]string{"MAIL_PROVIDER": "mailgun"},
+			expectedOutput: []string{"h%3AReply-To=%22Gavin+Thomas%22+%3Ctest%40example.com%3E"},
+		},
+		{
+			args:           []string{"send", "-backend", "stdout", "-"},
+			stdin:          validRequest,
+			env:            map[string]string{"MAIL_PROVIDER": "postmark"},
+			expectedOutput: []string{`"TextBody": "This is a test message."`, "sent with stdout"},
+		},
+		{
+			args:          []string{"send", "-backend", "ses", "-"},
+			stdin:         validRequest,
+			env:           map[string]string{"SES_REGION": ""},
+			expectedError: true,
+		},
+		{args: []string{"send", "-"}, stdin: validRequest, env: map[string]string{"SENDGRID_API_KEY": ""}, expectedError: true},
+		{args: []string{"unknown"}, expectedError: true},
+		{args: []string{}, expectedError: true},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(strings.Join(test.args, " "), func(t *testing.T) {
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+			var stdout, stderr bytes.Buffer
+			c := &cli{stdin: strings.NewReader(test.stdin), stdout: &stdout, stderr: &stderr}
+
+			err := c.run(context.Background(), test.args)
+			if (err != nil) != test.expectedError {
+				t.Errorf("run() error actual[%v], does not match expected[error=%v]", err, test.expectedError)
+			}
+			for _, expected := range test.expectedOutput {
+				if !strings.Contains(stdout.String(), expected) {
+					t.Errorf("run() output actual[%s], SHOULD contain [%s]", stdout.String(), expected)
+				}
+			}
+			for _, unexpected := range test.unexpectedOutput {
+				if strings.Contains(stdout.String()+stderr.String(), unexpected) {
+					t.Errorf("run() output actual[%s], SHOULD NOT contain [%s]", stdout.String(), unexpected)
+				}
+			}
+		})
+	}
+}
+
+func TestRunReadsRequestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "request.json")
+	if err := os.WriteFile(path, []byte(validRequest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var stdout bytes.Buffer
+	c := &cli{stdin: strings.NewReader(""), stdout: &stdout, stderr: &bytes.Buffer{}}
+
+	if err := c.run(context.Background(), []string{"validate", path}); err != nil {
+		t.Errorf("run() returned error [%v]", err)
+	}
+	if err := c.run(context.Background(), []string{"validate", path + ".missing"}); err == nil {
+		t.Error("run() SHOULD return an error for a missing file")
+	}
+}
+
+func TestRunServe(t *testing.T) {
+	t.Setenv("SENDGRID_API_KEY", "")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := &cli{stdin: strings.NewReader(""), stdout: io.Discard, stderr: io.Discard}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- c.run(ctx, []string{"serve", "-addr", addr})
+	}()
+
+	var res *http.Response
+	for i := 0; i < 50; i++ {
+		res, err = http.Post("http://"+addr+"/contact", "application/json", strings.NewReader(validRequest))
+		if err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("POST /contact returned error [%v]", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("POST /contact status actual[%d], does not match expected[200]", res.StatusCode)
+	}
+
+	res, err = http.Get("http://" + addr + "/messages")
+	if err != nil {
+		t.Fatalf("GET /messages returned error [%v]", err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if !strings.Contains(string(body), "test@example.com") {
+		t.Errorf("GET /messages actual[%s], SHOULD contain the captured email", body)
+	}
+
+	cancel()
+	if err := <-errs; err != nil {
+		t.Errorf("serve returned error [%v] after shutdown", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Command contactctl manages dead-lettered submissions: submissions whose
+// delivery attempts are exhausted, and purges expired ones.
+//
+//	contactctl list [-status dead_letter]
+//	contactctl show <id>
+//	contactctl replay <id>...
+//	contactctl discard <id>...
+//	contactctl purge
+//
+// It reads the same environment variables as the function. Replay sends with
+// the configured mailer, and only sends submissions that are still
+// dead-lettered, so running it twice is safe.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/outbox"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+const usage = `usage:
+  contactctl list [-status dead_letter]
+  contactctl show <id>
+  contactctl replay <id>...
+  contactctl discard <id>...
+  contactctl purge`
+
+var errUsage = errors.New(usage)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "contactctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cfg := configuration.NewContactFormConfiguration()
+	submissionStore, err := store.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	if submissionStore == nil {
+		return errors.New("SUBMISSION_STORE is required")
+	}
+	if args[0] == "replay" && !cfg.Valid() {
+		return errors.New("configuration is invalid")
+	}
+
+	// Logs go to stderr, leaving stdout to the command output.
+	logger := logging.New(os.Stderr, slog.LevelInfo, redaction.New(cfg.LogPIIPolicy))
+	m, err := mailer.New(cfg, mailer.WithLogger(logger))
+	if err != nil {
+		return err
+	}
+	worker := outbox.NewWorker(cfg, submissionStore, m, outbox.WithLogger(logger))
+	return (&app{store: submissionStore, worker: worker, stdout: os.Stdout}).run(ctx, args)
+}
+
+type app struct {
+	store  store.SubmissionStore
+	worker *outbox.Worker
+	stdout io.Writer
+}
+
+func (a *app) run(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "list":
+		return a.list(ctx, args[1:])
+	case "show":
+		if len(args) != 2 {
+			return errUsage
+		}
+		return a.show(ctx, args[1])
+	case "replay":
+		return a.each(args[1:], func(id string) (string, error) {
+			replayed, err := a.worker.Replay(ctx, id)
+			return result(replayed, "replayed", err)
+		})
+	case "discard":
+		return a.each(args[1:], func(id string) (string, error) {
+			discarded, err := a.worker.Discard(ctx, id)
+			return result(discarded, "discarded", err)
+		})
+	case "purge":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return a.purge(ctx)
+	default:
+		return errUsage
+	}
+}
+
+func (a *app) list(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	status := flags.String("status", string(store.StatusDeadLetter), "submission status to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	submissions, err := a.store.List(ctx, store.Status(*status))
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREQUEST ID\tUPDATED\tATTEMPTS\tLAST ERROR")
+	for _, submission := range submissions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", submission.ID, submission.RequestID,
+			submission.UpdatedAt.Format(time.RFC3339), submission.Attempts, submission.LastError)
+	}
+	return w.Flush()
+}
+
+// show prints the submission, including its transitions: the attempt history.
+func (a *app) show(ctx context.Context, id string) error {
+	submission, err := a.store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(a.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(submission)
+}
+
+// purge deletes the submissions past their SUBMISSION_RETENTION_<STATUS>.
+func (a *app) purge(ctx context.Context) error {
+	purged, err := a.worker.Purge(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "purged %d\n", purged)
+	return nil
+}
+
+// each applies fn to every id, reporting each result, and returns the first error.
+func (a *app) each(ids []string, fn func(id string) (string, error)) error {
+	if len(ids) == 0 {
+		return errUsage
+	}
+	var firstErr error
+	for _, id := range ids {
+		msg, err := fn(id)
+		if err != nil {
+			msg = "error: " + err.Error()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", id, err)
+			}
+		}
+		fmt.Fprintf(a.stdout, "%s\t%s\n", id, msg)
+	}
+	return firstErr
+}
+
+func result(done bool, action string, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	if !done {
+		return "skipped, not dead-lettered", nil
+	}
+	return action, nil
+}
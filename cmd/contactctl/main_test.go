@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/outbox"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+func TestApp(t *testing.T) {
+	type testSpec struct {
+		args           func(id string) []string
+		mailerResult   error
+		expectedError  bool
+		expectedOutput []string
+		expectedStatus store.Status
+		expectedCalls  int
+	}
+
+	testSpecs := []testSpec{
+		{
+			args:           func(string) []string { return []string{"list"} },
+			expectedOutput: []string{"ATTEMPTS", "req-dead", "provider unavailable"},
+			expectedStatus: store.StatusDeadLetter,
+		},
+		{
+			args:           func(string) []string { return []string{"list", "-status", "sent"} },
+			expectedOutput: []string{"ATTEMPTS"},
+			expectedStatus: store.StatusDeadLetter,
+		},
+		{
+			args:           func(id string) []string { return []string{"show", id} },
+			expectedOutput: []string{`"status": "dead_letter"`, `"transitions"`, `"message": "Hello"`},
+			expectedStatus: store.StatusDeadLetter,
+		},
+		{
+			args:           func(id string) []string { return []string{"replay", id} },
+			expectedOutput: []string{"replayed"},
+			expectedStatus: store.StatusSent,
+			expectedCalls:  1,
+		},
+		{
+			args:           func(id string) []string { return []string{"replay", id} },
+			mailerResult:   errors.New("provider unavailable"),
+			expectedError:  true,
+			expectedOutput: []string{"error: provider unavailable"},
+			expectedStatus: store.StatusDeadLetter,
+			expectedCalls:  1,
+		},
+		{
+			args:           func(id string) []string { return []string{"discard", id, "unknown"} },
+			expectedError:  true,
+			expectedOutput: []string{"discarded", "unknown\terror: submission not found"},
+			expectedStatus: store.StatusDiscarded,
+		},
+		{
+			args:           func(string) []string { return []string{"unknown"} },
+			expectedError:  true,
+			expectedStatus: store.StatusDeadLetter,
+		},
+	}
+
+	for _, test := range testSpecs {
+		ctx := context.Background()
+		submissionStore, err := store.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore() returned error [%v]", err)
+		}
+		submission := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"},
+			"req-dead", time.Now().UTC())
+		submissionStore.Create(ctx, submission)
+		submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "provider unavailable")
+
+		mockedMailer := &MockMailer{SendEmailResult: test.mailerResult}
+		worker := outbox.NewWorker(configuration.NewContactFormConfiguration(), submissionStore, mockedMailer,
+			outbox.WithLogger(logging.Discard()))
+		var stdout bytes.Buffer
+
+		err = (&app{store: submissionStore, worker: worker, stdout: &stdout}).run(ctx, test.args(submission.ID))
+		if (err != nil) != test.expectedError {
+			t.Errorf("run(%v) error actual[%v], does not match expected[error=%v]", test.args(submission.ID), err, test.expectedError)
+		}
+		for _, expected := range test.expectedOutput {
+			if !strings.Contains(stdout.String(), expected) {
+				t.Errorf("run(%v) output actual[%s], SHOULD contain [%s]", test.args(submission.ID), stdout.String(), expected)
+			}
+		}
+		if stored, _ := submissionStore.Get(ctx, submission.ID); stored.Status != test.expectedStatus {
+			t.Errorf("run(%v) status actual[%s], does not match expected[%s]", test.args(submission.ID), stored.Status, test.expectedStatus)
+		}
+		if mockedMailer.Calls != test.expectedCalls {
+			t.Errorf("run(%v) SendEmail() calls actual[%d], does not match expected[%d]", test.args(submission.ID), mockedMailer.Calls, test.expectedCalls)
+		}
+	}
+}
+
+func TestAppPurge(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("SUBMISSION_RETENTION_DEAD_LETTER", "24h")
+	submissionStore, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	submission := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"},
+		"req-dead", time.Now().UTC())
+	submissionStore.Create(ctx, submission)
+	submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "provider unavailable")
+
+	later := func() time.Time { return time.Now().UTC().Add(48 * time.Hour) }
+	worker := outbox.NewWorker(configuration.NewContactFormConfiguration(), submissionStore, &MockMailer{},
+		outbox.WithLogger(logging.Discard()), outbox.WithClock(later))
+	var stdout bytes.Buffer
+
+	if err := (&app{store: submissionStore, worker: worker, stdout: &stdout}).run(ctx, []string{"purge"}); err != nil {
+		t.Errorf("run(purge) returned error [%v]", err)
+	}
+	if stdout.String() != "purged 1\n" {
+		t.Errorf("run(purge) output actual[%s], does not match expected[purged 1]", stdout.String())
+	}
+	if _, err := submissionStore.Get(ctx, submission.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() after purge error actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+}
+
+// Mocks
+
+type MockMailer struct {
+	SendEmailResult error
+	Calls           int
+}
+
+func (m *MockMailer) SendEmail(_ context.Context, _ *api.EmailFormRequest) error {
+	m.Calls++
+	return m.SendEmailResult
+}
@@ -1,19 +1,818 @@
 package configuration
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+)
+
+// Submission store kinds.
+const (
+	SubmissionStoreNone     = ""
+	SubmissionStoreFile     = "file"
+	SubmissionStorePostgres = "postgres"
 )
 
+// Mail circuit breaker stores.
+const (
+	// MailBreakerStoreMemory keeps the breaker state in each instance.
+	MailBreakerStoreMemory = ""
+	// MailBreakerStorePostgres shares the breaker state between instances, in
+	// the SUBMISSION_STORE_DSN database.
+	MailBreakerStorePostgres = "postgres"
+)
+
+// Attachment scanners.
+const (
+	AttachmentScannerNone = ""
+	// AttachmentScannerClamd sends attachments to ClamAV's clamd daemon.
+	AttachmentScannerClamd = "clamd"
+)
+
+// Input policies, for the hostile characters of a request field.
+const (
+	// InputPolicyDefault applies the field's own policy.
+	InputPolicyDefault = ""
+	// InputPolicyStrip removes control, bidirectional and invisible characters,
+	// and excess combining marks.
+	InputPolicyStrip = "strip"
+	// InputPolicyReject rejects the request instead.
+	InputPolicyReject = "reject"
+)
+
+// InputFields are the request fields with an input policy.
+var InputFields = []string{"name", "email", "message", "formId", "fields"}
+
+// Delivery modes.
+const (
+	// DeliveryModeSync sends the email before responding.
+	DeliveryModeSync = "sync"
+	// DeliveryModeOutbox stores the submission, responds 202 Accepted, and
+	// leaves sending to the outbox worker.
+	DeliveryModeOutbox = "outbox"
+)
+
+// Mail modes.
+const (
+	// MailModeOff sends email for real.
+	MailModeOff = "off"
+	// MailModeSandbox has SendGrid validate each email, without delivering it.
+	MailModeSandbox = "sandbox"
+	// MailModeLogOnly renders and logs each email, without calling SendGrid.
+	MailModeLogOnly = "log-only"
+)
+
+// Mail providers.
+const (
+	MailProviderSendGrid = "sendgrid"
+	MailProviderMailgun  = "mailgun"
+	MailProviderPostmark = "postmark"
+	MailProviderSES      = "ses"
+	MailProviderResend   = "resend"
+)
+
+// MailProviders lists every mail provider.
+var MailProviders = []string{MailProviderSendGrid, MailProviderMailgun, MailProviderPostmark, MailProviderSES, MailProviderResend}
+
+// Default provider API base URLs.
+const (
+	MailgunBaseURL = "https://api.mailgun.net"
+	// MailgunBaseURLEU is for domains created in Mailgun's EU region.
+	MailgunBaseURLEU = "https://api.eu.mailgun.net"
+	PostmarkBaseURL  = "https://api.postmarkapp.com"
+	ResendBaseURL    = "https://api.resend.com"
+)
+
+// MailgunConfiguration is read from MAILGUN_* variables.
+type MailgunConfiguration struct {
+	APIKey string
+	// Domain is the sending domain, as set up in Mailgun.
+	Domain  string
+	BaseURL string
+}
+
+// PostmarkConfiguration is read from POSTMARK_* variables.
+type PostmarkConfiguration struct {
+	ServerToken   string
+	MessageStream string
+	BaseURL       string
+}
+
+// SESConfiguration is read from SES_* variables, for the Amazon SES v2 API.
+type SESConfiguration struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is only set for temporary credentials.
+	SessionToken string
+	// ConfigurationSet routes events, eg. to SNS. Optional.
+	ConfigurationSet string
+	// BaseURL defaults to the regional endpoint, https://email.<region>.amazonaws.com.
+	BaseURL string
+}
+
+// ResendConfiguration is read from RESEND_* variables.
+type ResendConfiguration struct {
+	APIKey  string
+	BaseURL string
+}
+
+// ClamdConfiguration is read from CLAMD_* variables.
+type ClamdConfiguration struct {
+	// Network is tcp or unix, and Address the host and port, or the socket
+	// path, from CLAMD_ADDRESS, eg. tcp://clamav:3310 or unix:///run/clamav/clamd.ctl.
+	Network string
+	Address string
+	// Timeout bounds connecting to clamd and scanning a file.
+	Timeout time.Duration
+}
+
+// String returns the address as a URL, eg. tcp://clamav:3310, or "" when unset.
+func (c ClamdConfiguration) String() string {
+	if c.Address == "" {
+		return ""
+	}
+	return c.Network + "://" + c.Address
+}
+
+// SendGrid API base URLs.
+const (
+	SendGridBaseURLGlobal = "https://api.sendgrid.com"
+	// SendGridBaseURLEU keeps email data in the EU, for subusers created with EU data residency.
+	SendGridBaseURLEU = "https://api.eu.sendgrid.com"
+)
+
+// SendGrid limits.
+const (
+	// SendGridMaxCategories is the most categories an email may have.
+	SendGridMaxCategories = 10
+	// SendGridMaxSendDelay is the furthest ahead an email may be scheduled with send_at.
+	SendGridMaxSendDelay = 72 * time.Hour
+)
+
+// DeployEnvironmentProduction is the only environment that sends email by default.
+const DeployEnvironmentProduction = "production"
+
+// submissionStatuses that can have a retention period.
+var submissionStatuses = []string{"received", "sent", "failed", "quarantined", "dead_letter", "discarded",
+	"delivered", "bounced", "dropped", "spam_reported"}
+
 type ContactFormConfiguration struct {
+	// MailProvider sends the emails: sendgrid (default), mailgun, postmark, ses or resend.
+	MailProvider   string
 	SendGridApiKey string
+	// SendGridBaseURL is the SendGrid API, eg. SendGridBaseURLEU, or a local stand-in. Defaults to SendGridBaseURLGlobal.
+	SendGridBaseURL string
+	// SendGridTemplateID is a dynamic template for the email. Without it, the built-in plain text body is sent.
+	SendGridTemplateID string
+	// SendGridCategories label every email in SendGrid's activity feed and event webhooks.
+	// The form ID of the request is added too.
+	SendGridCategories []string
+	// SendGridASMGroupID is the unsubscribe group of the email, and SendGridASMGroupsToDisplay
+	// the groups shown on its preferences page. Zero sends no asm settings.
+	SendGridASMGroupID         int
+	SendGridASMGroupsToDisplay []int
+	// SendGridDisableClickTracking and SendGridDisableOpenTracking turn tracking off for privacy.
+	// Otherwise the account's tracking settings apply.
+	SendGridDisableClickTracking bool
+	SendGridDisableOpenTracking  bool
+	// SendGridSendDelay schedules emails with send_at, up to SendGridMaxSendDelay ahead. Zero sends at once.
+	SendGridSendDelay time.Duration
+	// LogPIIPolicy controls personal data in the logs: none (default), masked or full-debug.
+	LogPIIPolicy redaction.Policy
+	// SubmissionStore is where accepted submissions are persisted: "" (disabled), file or postgres.
+	SubmissionStore    string
+	SubmissionStoreDir string
+	SubmissionStoreDSN string
+	// SubmissionRetention is how long submissions are kept, by status. Missing statuses are kept forever.
+	SubmissionRetention map[string]time.Duration
+	// DeliveryMode is sync (default) or outbox. Outbox requires a SubmissionStore.
+	DeliveryMode string
+	// OutboxMaxAttempts is the number of delivery attempts before a submission is dead-lettered.
+	OutboxMaxAttempts int
+	// OutboxRetryBackoff is the delay before the first retry. It doubles with each attempt.
+	OutboxRetryBackoff time.Duration
+	// OutboxClaimTimeout is how long a worker may take to send, before another worker may claim the submission.
+	OutboxClaimTimeout time.Duration
+	Mailgun            MailgunConfiguration
+	Postmark           PostmarkConfiguration
+	SES                SESConfiguration
+	Resend             ResendConfiguration
+	// SendGridWebhookPublicKey verifies Event Webhook signatures. It is the base64
+	// encoded ECDSA key shown in SendGrid's mail settings.
+	SendGridWebhookPublicKey string
+	// SendGridWebhookMaxAge is how old an Event Webhook timestamp may be, to stop replays.
+	SendGridWebhookMaxAge time.Duration
+	// BounceAlertThreshold bounces within BounceAlertWindow raise an alert.
+	BounceAlertThreshold int
+	BounceAlertWindow    time.Duration
+	// MailBreakerFailures provider outages within MailBreakerWindow open the
+	// mail circuit breaker.
+	MailBreakerFailures int
+	MailBreakerWindow   time.Duration
+	// MailBreakerOpenFor is how long the open breaker fails fast, before it
+	// lets a probe through.
+	MailBreakerOpenFor time.Duration
+	// MailBreakerStore is empty, keeping the breaker state in each instance, or
+	// postgres, sharing it between instances.
+	MailBreakerStore string
+	// AttachmentMaxDimension downsizes larger JPEG and PNG attachments to it, in
+	// pixels, keeping their aspect ratio. Zero keeps their size.
+	AttachmentMaxDimension int
+	// AttachmentThumbnails adds an inline thumbnail of each JPEG and PNG
+	// attachment to the HTML email, of at most AttachmentThumbnailSize pixels.
+	AttachmentThumbnails    bool
+	AttachmentThumbnailSize int
+	// AttachmentScanner checks attachments for malware before they are stored
+	// or mailed: "" (disabled) or clamd.
+	AttachmentScanner string
+	Clamd             ClamdConfiguration
+	// EmailCheckMX rejects email addresses whose domain has no mail servers,
+	// looked up within EmailLookupTimeout.
+	EmailCheckMX       bool
+	EmailLookupTimeout time.Duration
+	// EmailDisposableDomains replaces the built-in list of disposable email
+	// domains, which addresses must not be at.
+	EmailDisposableDomains []string
+	// InputPolicies overrides the policy of InputFields, by field: strip or
+	// reject. Missing fields keep their own policy.
+	InputPolicies map[string]string
+	// InputMaxCombiningMarks limits the combining marks on each character of
+	// the request text, such as the accents stacked up in "zalgo" text.
+	InputMaxCombiningMarks int
+	// DeployEnvironment names the deployment, eg. production (default), staging or preview.
+	DeployEnvironment string
+	// MailMode is off, sandbox or log-only. It defaults to off in production,
+	// and to sandbox in every other DeployEnvironment.
+	MailMode string
+
+	invalidValues []string
 }
 
 func NewContactFormConfiguration() *ContactFormConfiguration {
-	return &ContactFormConfiguration{SendGridApiKey: os.Getenv("SENDGRID_API_KEY")}
+	c := &ContactFormConfiguration{
+		MailProvider:             strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_PROVIDER"))),
+		SendGridApiKey:           os.Getenv("SENDGRID_API_KEY"),
+		SendGridBaseURL:          SendGridBaseURLGlobal,
+		SendGridTemplateID:       strings.TrimSpace(os.Getenv("SENDGRID_TEMPLATE_ID")),
+		SendGridCategories:       listEnv("SENDGRID_CATEGORIES"),
+		LogPIIPolicy:             redaction.ParsePolicy(os.Getenv("LOG_PII_POLICY")),
+		SubmissionStore:          strings.ToLower(strings.TrimSpace(os.Getenv("SUBMISSION_STORE"))),
+		SubmissionStoreDir:       os.Getenv("SUBMISSION_STORE_DIR"),
+		SubmissionStoreDSN:       os.Getenv("SUBMISSION_STORE_DSN"),
+		SubmissionRetention:      make(map[string]time.Duration),
+		DeliveryMode:             strings.ToLower(strings.TrimSpace(os.Getenv("DELIVERY_MODE"))),
+		OutboxMaxAttempts:        5,
+		OutboxRetryBackoff:       time.Minute,
+		OutboxClaimTimeout:       5 * time.Minute,
+		SendGridWebhookPublicKey: strings.TrimSpace(os.Getenv("SENDGRID_WEBHOOK_PUBLIC_KEY")),
+		SendGridWebhookMaxAge:    10 * time.Minute,
+		BounceAlertThreshold:     3,
+		BounceAlertWindow:        24 * time.Hour,
+		MailBreakerFailures:      5,
+		MailBreakerWindow:        time.Minute,
+		MailBreakerOpenFor:       30 * time.Second,
+		MailBreakerStore:         strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_BREAKER_STORE"))),
+		AttachmentThumbnails:     true,
+		AttachmentThumbnailSize:  320,
+		AttachmentScanner:        strings.ToLower(strings.TrimSpace(os.Getenv("ATTACHMENT_SCANNER"))),
+		Clamd:                    ClamdConfiguration{Timeout: 30 * time.Second},
+		EmailLookupTimeout:       2 * time.Second,
+		EmailDisposableDomains:   listEnv("EMAIL_DISPOSABLE_DOMAINS"),
+		InputPolicies:            make(map[string]string),
+		InputMaxCombiningMarks:   4,
+		DeployEnvironment:        strings.ToLower(strings.TrimSpace(os.Getenv("DEPLOY_ENVIRONMENT"))),
+		MailMode:                 strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_MODE"))),
+	}
+	c.Mailgun = MailgunConfiguration{
+		APIKey:  os.Getenv("MAILGUN_API_KEY"),
+		Domain:  strings.TrimSpace(os.Getenv("MAILGUN_DOMAIN")),
+		BaseURL: MailgunBaseURL,
+	}
+	c.Postmark = PostmarkConfiguration{
+		ServerToken:   os.Getenv("POSTMARK_SERVER_TOKEN"),
+		MessageStream: strings.TrimSpace(os.Getenv("POSTMARK_MESSAGE_STREAM")),
+		BaseURL:       PostmarkBaseURL,
+	}
+	c.SES = SESConfiguration{
+		Region:           strings.TrimSpace(os.Getenv("SES_REGION")),
+		AccessKeyID:      strings.TrimSpace(os.Getenv("SES_ACCESS_KEY_ID")),
+		SecretAccessKey:  os.Getenv("SES_SECRET_ACCESS_KEY"),
+		SessionToken:     os.Getenv("SES_SESSION_TOKEN"),
+		ConfigurationSet: strings.TrimSpace(os.Getenv("SES_CONFIGURATION_SET")),
+	}
+	c.Resend = ResendConfiguration{APIKey: os.Getenv("RESEND_API_KEY"), BaseURL: ResendBaseURL}
+	if c.MailProvider == "" {
+		c.MailProvider = MailProviderSendGrid
+	}
+	if c.Postmark.MessageStream == "" {
+		c.Postmark.MessageStream = "outbound"
+	}
+	if c.DeliveryMode == "" {
+		c.DeliveryMode = DeliveryModeSync
+	}
+	if c.DeployEnvironment == "" {
+		c.DeployEnvironment = DeployEnvironmentProduction
+	}
+	if c.MailMode == "" {
+		c.MailMode = MailModeSandbox
+		if c.DeployEnvironment == DeployEnvironmentProduction {
+			c.MailMode = MailModeOff
+		}
+	}
+	if baseURL, ok := c.urlEnv("SENDGRID_BASE_URL"); ok {
+		c.SendGridBaseURL = baseURL
+	}
+	if baseURL, ok := c.urlEnv("MAILGUN_BASE_URL"); ok {
+		c.Mailgun.BaseURL = baseURL
+	}
+	if baseURL, ok := c.urlEnv("POSTMARK_BASE_URL"); ok {
+		c.Postmark.BaseURL = baseURL
+	}
+	if baseURL, ok := c.urlEnv("SES_BASE_URL"); ok {
+		c.SES.BaseURL = baseURL
+	} else if c.SES.Region != "" {
+		c.SES.BaseURL = "https://email." + c.SES.Region + ".amazonaws.com"
+	}
+	if baseURL, ok := c.urlEnv("RESEND_BASE_URL"); ok {
+		c.Resend.BaseURL = baseURL
+	}
+	if groupID, ok := c.intEnv("SENDGRID_ASM_GROUP_ID"); ok {
+		c.SendGridASMGroupID = groupID
+	}
+	for _, group := range listEnv("SENDGRID_ASM_GROUPS_TO_DISPLAY") {
+		groupID, err := strconv.Atoi(group)
+		if err != nil || groupID <= 0 {
+			c.invalidValues = append(c.invalidValues, "SENDGRID_ASM_GROUPS_TO_DISPLAY")
+			break
+		}
+		c.SendGridASMGroupsToDisplay = append(c.SendGridASMGroupsToDisplay, groupID)
+	}
+	c.SendGridDisableClickTracking, _ = c.boolEnv("SENDGRID_DISABLE_CLICK_TRACKING")
+	c.SendGridDisableOpenTracking, _ = c.boolEnv("SENDGRID_DISABLE_OPEN_TRACKING")
+	if sendDelay, ok := c.durationEnv("SENDGRID_SEND_DELAY"); ok {
+		c.SendGridSendDelay = sendDelay
+	}
+	if maxAge, ok := c.durationEnv("SENDGRID_WEBHOOK_MAX_AGE"); ok {
+		c.SendGridWebhookMaxAge = maxAge
+	}
+	if threshold, ok := c.intEnv("BOUNCE_ALERT_THRESHOLD"); ok {
+		c.BounceAlertThreshold = threshold
+	}
+	if window, ok := c.durationEnv("BOUNCE_ALERT_WINDOW"); ok {
+		c.BounceAlertWindow = window
+	}
+	if failures, ok := c.intEnv("MAIL_BREAKER_FAILURES"); ok {
+		c.MailBreakerFailures = failures
+	}
+	if window, ok := c.durationEnv("MAIL_BREAKER_WINDOW"); ok {
+		c.MailBreakerWindow = window
+	}
+	if openFor, ok := c.durationEnv("MAIL_BREAKER_OPEN_FOR"); ok {
+		c.MailBreakerOpenFor = openFor
+	}
+	if maxDimension, ok := c.intEnv("ATTACHMENT_MAX_DIMENSION"); ok {
+		c.AttachmentMaxDimension = maxDimension
+	}
+	if thumbnails, ok := c.boolEnv("ATTACHMENT_THUMBNAILS"); ok {
+		c.AttachmentThumbnails = thumbnails
+	}
+	if thumbnailSize, ok := c.intEnv("ATTACHMENT_THUMBNAIL_SIZE"); ok {
+		c.AttachmentThumbnailSize = thumbnailSize
+	}
+	if network, address, ok := c.clamdAddressEnv("CLAMD_ADDRESS"); ok {
+		c.Clamd.Network, c.Clamd.Address = network, address
+	}
+	if timeout, ok := c.durationEnv("CLAMD_TIMEOUT"); ok {
+		c.Clamd.Timeout = timeout
+	}
+	c.EmailCheckMX, _ = c.boolEnv("EMAIL_CHECK_MX")
+	if timeout, ok := c.durationEnv("EMAIL_LOOKUP_TIMEOUT"); ok {
+		c.EmailLookupTimeout = timeout
+	}
+	for _, field := range InputFields {
+		if policy := strings.ToLower(strings.TrimSpace(os.Getenv(inputPolicyEnv(field)))); policy != "" {
+			c.InputPolicies[field] = policy
+		}
+	}
+	if maxMarks, ok := c.intEnv("INPUT_MAX_COMBINING_MARKS"); ok {
+		c.InputMaxCombiningMarks = maxMarks
+	}
+	if maxAttempts, ok := c.intEnv("OUTBOX_MAX_ATTEMPTS"); ok {
+		c.OutboxMaxAttempts = maxAttempts
+	}
+	if backoff, ok := c.durationEnv("OUTBOX_RETRY_BACKOFF"); ok {
+		c.OutboxRetryBackoff = backoff
+	}
+	if claimTimeout, ok := c.durationEnv("OUTBOX_CLAIM_TIMEOUT"); ok {
+		c.OutboxClaimTimeout = claimTimeout
+	}
+	for _, status := range submissionStatuses {
+		if retention, ok := c.durationEnv("SUBMISSION_RETENTION_" + strings.ToUpper(status)); ok {
+			c.SubmissionRetention[status] = retention
+		}
+	}
+	return c
 }
 
 func (c *ContactFormConfiguration) Valid() bool {
-	return utf8.RuneCountInString(strings.TrimSpace(c.SendGridApiKey)) != 0
+	return len(c.Problems()) == 0
+}
+
+// Problems describes why the configuration is invalid. It is empty when Valid.
+func (c *ContactFormConfiguration) Problems() []string {
+	problems := c.MailProviderProblems()
+	problems = append(problems, c.sendGridProblems()...)
+	problems = append(problems, c.submissionStoreProblems()...)
+	problems = append(problems, c.deliveryModeProblems()...)
+	problems = append(problems, c.mailBreakerProblems()...)
+	problems = append(problems, c.attachmentScannerProblems()...)
+	problems = append(problems, c.inputPolicyProblems()...)
+	switch c.MailMode {
+	case MailModeOff, MailModeSandbox, MailModeLogOnly:
+	default:
+		problems = append(problems, "MAIL_MODE must be off, sandbox or log-only")
+	}
+	for _, name := range c.invalidValues {
+		problems = append(problems, name+" is invalid")
+	}
+	return problems
+}
+
+func (c *ContactFormConfiguration) inputPolicyProblems() []string {
+	var problems []string
+	for _, field := range InputFields {
+		switch c.InputPolicies[field] {
+		case InputPolicyDefault, InputPolicyStrip, InputPolicyReject:
+		default:
+			problems = append(problems, inputPolicyEnv(field)+" must be empty, strip or reject")
+		}
+	}
+	return problems
+}
+
+// inputPolicyEnv names the variable of field's input policy, eg.
+// INPUT_POLICY_FORM_ID for formId.
+func inputPolicyEnv(field string) string {
+	var name strings.Builder
+	name.WriteString("INPUT_POLICY_")
+	for _, r := range field {
+		if unicode.IsUpper(r) {
+			name.WriteByte('_')
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
+
+// MailProviderProblems reports the missing settings of the selected MailProvider.
+func (c *ContactFormConfiguration) MailProviderProblems() []string {
+	var required map[string]string
+	switch c.MailProvider {
+	case MailProviderSendGrid:
+		required = map[string]string{"SENDGRID_API_KEY": c.SendGridApiKey}
+	case MailProviderMailgun:
+		required = map[string]string{"MAILGUN_API_KEY": c.Mailgun.APIKey, "MAILGUN_DOMAIN": c.Mailgun.Domain}
+	case MailProviderPostmark:
+		required = map[string]string{"POSTMARK_SERVER_TOKEN": c.Postmark.ServerToken}
+	case MailProviderSES:
+		required = map[string]string{"SES_REGION": c.SES.Region, "SES_ACCESS_KEY_ID": c.SES.AccessKeyID,
+			"SES_SECRET_ACCESS_KEY": c.SES.SecretAccessKey}
+	case MailProviderResend:
+		required = map[string]string{"RESEND_API_KEY": c.Resend.APIKey}
+	default:
+		return []string{"MAIL_PROVIDER must be one of " + strings.Join(MailProviders, ", ")}
+	}
+	var problems []string
+	for _, name := range sortedKeys(required) {
+		if utf8.RuneCountInString(strings.TrimSpace(required[name])) == 0 {
+			problems = append(problems, name+" is required")
+		}
+	}
+	return problems
+}
+
+func (c *ContactFormConfiguration) sendGridProblems() []string {
+	var problems []string
+	if len(c.SendGridCategories) > SendGridMaxCategories {
+		problems = append(problems, fmt.Sprintf("SENDGRID_CATEGORIES must have at most %d categories", SendGridMaxCategories))
+	}
+	if len(c.SendGridASMGroupsToDisplay) > 0 && c.SendGridASMGroupID == 0 {
+		problems = append(problems, "SENDGRID_ASM_GROUPS_TO_DISPLAY requires SENDGRID_ASM_GROUP_ID")
+	}
+	if c.SendGridSendDelay > SendGridMaxSendDelay {
+		problems = append(problems, fmt.Sprintf("SENDGRID_SEND_DELAY must be at most %s", SendGridMaxSendDelay))
+	}
+	return problems
+}
+
+func (c *ContactFormConfiguration) deliveryModeProblems() []string {
+	switch c.DeliveryMode {
+	case DeliveryModeSync:
+		return nil
+	case DeliveryModeOutbox:
+		if c.SubmissionStore == SubmissionStoreNone {
+			return []string{"DELIVERY_MODE=outbox requires SUBMISSION_STORE"}
+		}
+		return nil
+	default:
+		return []string{"DELIVERY_MODE must be sync or outbox"}
+	}
+}
+
+func (c *ContactFormConfiguration) mailBreakerProblems() []string {
+	switch c.MailBreakerStore {
+	case MailBreakerStoreMemory:
+		return nil
+	case MailBreakerStorePostgres:
+		if strings.TrimSpace(c.SubmissionStoreDSN) == "" {
+			return []string{"MAIL_BREAKER_STORE=postgres requires SUBMISSION_STORE_DSN"}
+		}
+		return nil
+	default:
+		return []string{"MAIL_BREAKER_STORE must be empty or postgres"}
+	}
+}
+
+func (c *ContactFormConfiguration) attachmentScannerProblems() []string {
+	switch c.AttachmentScanner {
+	case AttachmentScannerNone:
+		return nil
+	case AttachmentScannerClamd:
+		if c.Clamd.Address == "" {
+			return []string{"ATTACHMENT_SCANNER=clamd requires CLAMD_ADDRESS"}
+		}
+		return nil
+	default:
+		return []string{"ATTACHMENT_SCANNER must be empty or clamd"}
+	}
+}
+
+func (c *ContactFormConfiguration) submissionStoreProblems() []string {
+	switch c.SubmissionStore {
+	case SubmissionStoreNone:
+		return nil
+	case SubmissionStoreFile:
+		if strings.TrimSpace(c.SubmissionStoreDir) == "" {
+			return []string{"SUBMISSION_STORE=file requires SUBMISSION_STORE_DIR"}
+		}
+		return nil
+	case SubmissionStorePostgres:
+		if strings.TrimSpace(c.SubmissionStoreDSN) == "" {
+			return []string{"SUBMISSION_STORE=postgres requires SUBMISSION_STORE_DSN"}
+		}
+		return nil
+	default:
+		return []string{"SUBMISSION_STORE must be empty, file or postgres"}
+	}
+}
+
+// Setting is a configuration value, named by its environment variable.
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Settings lists the effective configuration for diagnostics. Secrets are
+// redacted, so the output is safe to share.
+func (c *ContactFormConfiguration) Settings() []Setting {
+	settings := []Setting{
+		{Name: "MAIL_PROVIDER", Value: c.MailProvider},
+		{Name: "SENDGRID_API_KEY", Value: redactedSecret(c.SendGridApiKey)},
+		{Name: "SENDGRID_BASE_URL", Value: c.SendGridBaseURL},
+		{Name: "SENDGRID_TEMPLATE_ID", Value: c.SendGridTemplateID},
+		{Name: "SENDGRID_CATEGORIES", Value: strings.Join(c.SendGridCategories, ",")},
+		{Name: "SENDGRID_ASM_GROUP_ID", Value: strconv.Itoa(c.SendGridASMGroupID)},
+		{Name: "SENDGRID_ASM_GROUPS_TO_DISPLAY", Value: joinInts(c.SendGridASMGroupsToDisplay)},
+		{Name: "SENDGRID_DISABLE_CLICK_TRACKING", Value: strconv.FormatBool(c.SendGridDisableClickTracking)},
+		{Name: "SENDGRID_DISABLE_OPEN_TRACKING", Value: strconv.FormatBool(c.SendGridDisableOpenTracking)},
+		{Name: "SENDGRID_SEND_DELAY", Value: c.SendGridSendDelay.String()},
+		{Name: "LOG_PII_POLICY", Value: string(c.LogPIIPolicy)},
+	}
+	settings = append(settings, c.providerSettings()...)
+	settings = append(settings, []Setting{
+		{Name: "SUBMISSION_STORE", Value: c.SubmissionStore},
+		{Name: "SUBMISSION_STORE_DIR", Value: c.SubmissionStoreDir},
+		{Name: "SUBMISSION_STORE_DSN", Value: redactedDSN(c.SubmissionStoreDSN)},
+	}...)
+	for _, status := range submissionStatuses {
+		if retention, ok := c.SubmissionRetention[status]; ok {
+			settings = append(settings, Setting{Name: "SUBMISSION_RETENTION_" + strings.ToUpper(status), Value: retention.String()})
+		}
+	}
+	settings = append(settings,
+		Setting{Name: "DELIVERY_MODE", Value: c.DeliveryMode},
+		Setting{Name: "OUTBOX_MAX_ATTEMPTS", Value: strconv.Itoa(c.OutboxMaxAttempts)},
+		Setting{Name: "OUTBOX_RETRY_BACKOFF", Value: c.OutboxRetryBackoff.String()},
+		Setting{Name: "OUTBOX_CLAIM_TIMEOUT", Value: c.OutboxClaimTimeout.String()},
+		Setting{Name: "SENDGRID_WEBHOOK_PUBLIC_KEY", Value: c.SendGridWebhookPublicKey},
+		Setting{Name: "SENDGRID_WEBHOOK_MAX_AGE", Value: c.SendGridWebhookMaxAge.String()},
+		Setting{Name: "BOUNCE_ALERT_THRESHOLD", Value: strconv.Itoa(c.BounceAlertThreshold)},
+		Setting{Name: "BOUNCE_ALERT_WINDOW", Value: c.BounceAlertWindow.String()},
+		Setting{Name: "MAIL_BREAKER_FAILURES", Value: strconv.Itoa(c.MailBreakerFailures)},
+		Setting{Name: "MAIL_BREAKER_WINDOW", Value: c.MailBreakerWindow.String()},
+		Setting{Name: "MAIL_BREAKER_OPEN_FOR", Value: c.MailBreakerOpenFor.String()},
+		Setting{Name: "MAIL_BREAKER_STORE", Value: c.MailBreakerStore},
+		Setting{Name: "ATTACHMENT_MAX_DIMENSION", Value: strconv.Itoa(c.AttachmentMaxDimension)},
+		Setting{Name: "ATTACHMENT_THUMBNAILS", Value: strconv.FormatBool(c.AttachmentThumbnails)},
+		Setting{Name: "ATTACHMENT_THUMBNAIL_SIZE", Value: strconv.Itoa(c.AttachmentThumbnailSize)},
+		Setting{Name: "ATTACHMENT_SCANNER", Value: c.AttachmentScanner},
+		Setting{Name: "CLAMD_ADDRESS", Value: c.Clamd.String()},
+		Setting{Name: "CLAMD_TIMEOUT", Value: c.Clamd.Timeout.String()},
+		Setting{Name: "EMAIL_CHECK_MX", Value: strconv.FormatBool(c.EmailCheckMX)},
+		Setting{Name: "EMAIL_LOOKUP_TIMEOUT", Value: c.EmailLookupTimeout.String()},
+		Setting{Name: "EMAIL_DISPOSABLE_DOMAINS", Value: strings.Join(c.EmailDisposableDomains, ",")},
+	)
+	for _, field := range InputFields {
+		settings = append(settings, Setting{Name: inputPolicyEnv(field), Value: c.InputPolicies[field]})
+	}
+	return append(settings,
+		Setting{Name: "INPUT_MAX_COMBINING_MARKS", Value: strconv.Itoa(c.InputMaxCombiningMarks)},
+		Setting{Name: "DEPLOY_ENVIRONMENT", Value: c.DeployEnvironment},
+		Setting{Name: "MAIL_MODE", Value: c.MailMode},
+	)
+}
+
+// providerSettings lists the settings of the selected MailProvider, other than SendGrid.
+func (c *ContactFormConfiguration) providerSettings() []Setting {
+	switch c.MailProvider {
+	case MailProviderMailgun:
+		return []Setting{
+			{Name: "MAILGUN_API_KEY", Value: redactedSecret(c.Mailgun.APIKey)},
+			{Name: "MAILGUN_DOMAIN", Value: c.Mailgun.Domain},
+			{Name: "MAILGUN_BASE_URL", Value: c.Mailgun.BaseURL},
+		}
+	case MailProviderPostmark:
+		return []Setting{
+			{Name: "POSTMARK_SERVER_TOKEN", Value: redactedSecret(c.Postmark.ServerToken)},
+			{Name: "POSTMARK_MESSAGE_STREAM", Value: c.Postmark.MessageStream},
+			{Name: "POSTMARK_BASE_URL", Value: c.Postmark.BaseURL},
+		}
+	case MailProviderSES:
+		return []Setting{
+			{Name: "SES_REGION", Value: c.SES.Region},
+			{Name: "SES_ACCESS_KEY_ID", Value: c.SES.AccessKeyID},
+			{Name: "SES_SECRET_ACCESS_KEY", Value: redactedSecret(c.SES.SecretAccessKey)},
+			{Name: "SES_SESSION_TOKEN", Value: redactedSecret(c.SES.SessionToken)},
+			{Name: "SES_CONFIGURATION_SET", Value: c.SES.ConfigurationSet},
+			{Name: "SES_BASE_URL", Value: c.SES.BaseURL},
+		}
+	case MailProviderResend:
+		return []Setting{
+			{Name: "RESEND_API_KEY", Value: redactedSecret(c.Resend.APIKey)},
+			{Name: "RESEND_BASE_URL", Value: c.Resend.BaseURL},
+		}
+	default:
+		return nil
+	}
+}
+
+// redactedSecret shows whether a secret is set, and never any of its characters.
+func redactedSecret(secret string) string {
+	if strings.TrimSpace(secret) == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted, %d characters]", utf8.RuneCountInString(secret))
+}
+
+// redactedDSN removes the password from a connection URL. Other DSN formats may
+// hold a password anywhere, so they are redacted entirely.
+func redactedDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return redactedSecret(dsn)
+	}
+	query := u.Query()
+	if query.Has("password") {
+		query.Set("password", "xxxxx")
+		u.RawQuery = query.Encode()
+	}
+	return u.Redacted()
+}
+
+// durationEnv parses a Go duration, eg. "720h". Unparseable values make the configuration invalid.
+func (c *ContactFormConfiguration) durationEnv(name string) (time.Duration, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return 0, false
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		c.invalidValues = append(c.invalidValues, name)
+		return 0, false
+	}
+	return duration, true
+}
+
+// intEnv parses a positive integer. Unparseable values make the configuration invalid.
+func (c *ContactFormConfiguration) intEnv(name string) (int, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		c.invalidValues = append(c.invalidValues, name)
+		return 0, false
+	}
+	return n, true
+}
+
+// boolEnv parses a boolean, eg. "true" or "1". Unparseable values make the configuration invalid.
+func (c *ContactFormConfiguration) boolEnv(name string) (bool, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return false, false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		c.invalidValues = append(c.invalidValues, name)
+		return false, false
+	}
+	return b, true
+}
+
+// listEnv splits a comma separated list, ignoring empty entries.
+func listEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = strconv.Itoa(value)
+	}
+	return strings.Join(s, ",")
+}
+
+// urlEnv parses an absolute http(s) URL, without a trailing slash. Unparseable
+// values make the configuration invalid.
+// clamdAddressEnv parses a tcp://host:port or unix:///path address. Addresses
+// without a scheme are TCP, or unix sockets when they are absolute paths.
+// Unparseable values make the configuration invalid.
+func (c *ContactFormConfiguration) clamdAddressEnv(name string) (network, address string, ok bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return "", "", false
+	}
+	switch {
+	case strings.HasPrefix(value, "unix://"):
+		network, address = "unix", strings.TrimPrefix(value, "unix://")
+	case strings.HasPrefix(value, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(value, "tcp://")
+	case strings.HasPrefix(value, "/"):
+		network, address = "unix", value
+	default:
+		network, address = "tcp", value
+	}
+	valid := strings.HasPrefix(address, "/")
+	if network == "tcp" {
+		host, port, err := net.SplitHostPort(address)
+		valid = err == nil && host != "" && port != ""
+	}
+	if !valid {
+		c.invalidValues = append(c.invalidValues, name)
+		return "", "", false
+	}
+	return network, address, true
+}
+
+func (c *ContactFormConfiguration) urlEnv(name string) (string, bool) {
+	value := strings.TrimSpace(os.Getenv(name))
+	if value == "" {
+		return "", false
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.invalidValues = append(c.invalidValues, name)
+		return "", false
+	}
+	return strings.TrimSuffix(value, "/"), true
 }
@@ -2,60 +2,491 @@ package contactform
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/sanitize"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/scanner"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/tracing"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
 )
 
 type ContactForm interface {
-	Execute(ctx context.Context, emailFormReq api.EmailFormRequest) api.EmailFormResponse
+	// Execute always responds with the V1 envelope.
+	Execute(ctx context.Context, emailFormReq *api.EmailFormRequest) api.EmailFormResponse
+	// Respond negotiates the response version from the request.
+	Respond(ctx context.Context, emailFormReq *api.EmailFormRequest) api.Response
 }
 
+// Outcomes of a submission, as logged and counted.
+const (
+	OutcomeSuccess         = "success"
+	OutcomeQueued          = "queued"
+	OutcomeValidationError = "validation_error"
+	OutcomeMalware         = "malware"
+	OutcomeRateLimited     = "rate_limited"
+	OutcomeMailError       = "mail_error"
+	OutcomeInternalError   = "internal_error"
+)
+
+// Field errors of attachments rejected after validation.
+const (
+	// AttachmentsUnreadable is the field error of attachments that are not
+	// valid images, such as truncated JPEGs.
+	AttachmentsUnreadable = "attachments must be readable JPEG, PNG, HEIC or PDF files"
+	// AttachmentsInfected is the field error of attachments holding malware.
+	AttachmentsInfected = "attachments must not contain malware"
+	// AttachmentsUnscannable is the field error of attachments that could not
+	// be scanned, eg. while the scanner is down.
+	AttachmentsUnscannable = "attachments could not be checked for malware, please try again later"
+)
+
 type ContactFormImpl struct {
-	configuration *configuration.ContactFormConfiguration
-	validator     validation.Validator
-	mailer        mailer.Mailer
+	configuration  *configuration.ContactFormConfiguration
+	validator      validation.Validator
+	mailer         mailer.Mailer
+	logger         *slog.Logger
+	meter          metrics.Meter
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+	store          store.SubmissionStore
+	attachments    *attachment.Processor
+	scanner        scanner.Scanner
+	sanitizer      *sanitize.Sanitizer
+}
+
+type Option func(*ContactFormImpl)
+
+// WithLogger sets the logger. Without it, a default logger redacting by the
+// configured LogPIIPolicy is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cf *ContactFormImpl) {
+		cf.logger = logger
+	}
+}
+
+// WithMeter sets the meter for submission metrics. Without it, metrics are discarded.
+func WithMeter(meter metrics.Meter) Option {
+	return func(cf *ContactFormImpl) {
+		cf.meter = meter
+	}
+}
+
+// WithTracerProvider sets the provider for submission spans. Without it, the
+// global OpenTelemetry provider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(cf *ContactFormImpl) {
+		cf.tracerProvider = tp
+	}
+}
+
+// WithSubmissionStore persists every accepted submission before it is mailed,
+// and records whether it was sent.
+func WithSubmissionStore(submissionStore store.SubmissionStore) Option {
+	return func(cf *ContactFormImpl) {
+		cf.store = submissionStore
+	}
+}
+
+// WithSanitizer sets how request text is normalised before it is validated.
+// Without it, sanitize.New(configuration) is used.
+func WithSanitizer(sanitizer *sanitize.Sanitizer) Option {
+	return func(cf *ContactFormImpl) {
+		cf.sanitizer = sanitizer
+	}
+}
+
+// WithScanner checks attachments for malware, before they are processed, stored
+// or mailed. Infected files, and files it cannot scan, reject the submission.
+// A nil scanner does not scan.
+func WithScanner(s scanner.Scanner) Option {
+	return func(cf *ContactFormImpl) {
+		cf.scanner = s
+	}
 }
 
 func NewContactFormImpl(
 	configuration *configuration.ContactFormConfiguration,
 	validator validation.Validator,
-	mailer mailer.Mailer) *ContactFormImpl {
-	return &ContactFormImpl{
+	mailer mailer.Mailer,
+	opts ...Option) *ContactFormImpl {
+	cf := &ContactFormImpl{
 		configuration: configuration,
 		validator:     validator,
 		mailer:        mailer,
+		meter:         metrics.Noop{},
+		attachments:   attachment.NewProcessor(configuration),
+	}
+	for _, opt := range opts {
+		opt(cf)
 	}
+	if cf.sanitizer == nil {
+		cf.sanitizer = sanitize.New(configuration)
+	}
+	if cf.logger == nil {
+		cf.logger = logging.ForPolicy(configuration.LogPIIPolicy)
+	}
+	cf.tracer = tracing.Tracer(cf.tracerProvider)
+	return cf
 }
 
 func (cf *ContactFormImpl) Execute(ctx context.Context, emailFormReq *api.EmailFormRequest) api.EmailFormResponse {
-	if !cf.configuration.Valid() {
-		fmt.Printf("Configuration: [%v]", cf.configuration)
-		return api.InternalFailureResponse("configuration is invalid")
+	ctx, requestID := withRequestID(ctx, emailFormReq)
+	return cf.execute(ctx, emailFormReq, cf.responder(api.V1, requestID)).(api.EmailFormResponse)
+}
+
+func (cf *ContactFormImpl) Respond(ctx context.Context, emailFormReq *api.EmailFormRequest) api.Response {
+	ctx, requestID := withRequestID(ctx, emailFormReq)
+	version := api.V1
+	if emailFormReq != nil {
+		version = api.NegotiateVersion(emailFormReq.Header("Accept"), emailFormReq.APIVersion)
+	}
+	return cf.execute(ctx, emailFormReq, cf.responder(version, requestID))
+}
+
+// responder shows the mail mode in responses, unless email is sent for real.
+func (cf *ContactFormImpl) responder(version api.Version, requestID string) api.Responder {
+	if cf.configuration.MailMode == "" || cf.configuration.MailMode == configuration.MailModeOff {
+		return api.NewResponder(version, requestID)
+	}
+	return api.NewResponder(version, requestID, api.WithMailMode(cf.configuration.MailMode))
+}
+
+func (cf *ContactFormImpl) execute(ctx context.Context, emailFormReq *api.EmailFormRequest, res api.Responder) api.Response {
+	start := time.Now()
+	if emailFormReq != nil {
+		ctx = tracing.Extract(ctx, emailFormReq.Headers)
+	}
+	ctx, span := cf.tracer.Start(ctx, "contactform.Execute",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tracing.AttrRequestID.String(requestid.FromContext(ctx))))
+	defer span.End()
+
+	err := cf.trace(ctx, "contactform.configuration", func(_ context.Context, _ trace.Span) error {
+		if !cf.configuration.Valid() {
+			return errors.New("configuration is invalid")
+		}
+		return nil
+	})
+	if err != nil {
+		return cf.complete(ctx, start, logging.StageConfiguration, OutcomeInternalError, res.InternalFailure(), err)
 	}
 
 	if cf.validator == nil {
-		fmt.Println("Validator was nil")
-		return api.InternalFailureResponse("validator is invalid")
+		return cf.complete(ctx, start, logging.StageValidation, OutcomeInternalError,
+			res.InternalFailure(), errors.New("validator is invalid"))
+	}
+
+	// Text is normalised before it is validated, so lengths are counted, and
+	// the email written, without hidden characters.
+	var rejected map[string]string
+	_ = cf.trace(ctx, "sanitize.Sanitize", func(_ context.Context, sanitizeSpan trace.Span) error {
+		rejected = cf.sanitizer.Sanitize(emailFormReq)
+		sanitizeSpan.SetAttributes(tracing.AttrInvalidFields.StringSlice(fieldNames(rejected)))
+		return nil
+	})
+	if len(rejected) > 0 {
+		for field := range rejected {
+			cf.meter.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: field})
+		}
+		return cf.complete(ctx, start, logging.StageSanitization, OutcomeValidationError,
+			res.ValidationFailure("", rejected), nil, "invalid_fields", fieldNames(rejected))
 	}
 
-	cf.validator.Check(emailFormReq)
+	_ = cf.trace(ctx, "contactform.validation", func(validationCtx context.Context, validationSpan trace.Span) error {
+		if validator, ok := cf.validator.(validation.ContextValidator); ok {
+			validator.CheckContext(validationCtx, emailFormReq)
+		} else {
+			cf.validator.Check(emailFormReq)
+		}
+		validationSpan.SetAttributes(tracing.AttrInvalidFields.StringSlice(fieldNames(cf.validator.FieldErrors())))
+		return nil
+	})
 	if !cf.validator.Valid() {
-		return api.ValidationFailureResponse(cf.validator.GlobalError(), cf.validator.FieldErrors())
+		for field := range cf.validator.FieldErrors() {
+			cf.meter.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: field})
+		}
+		return cf.complete(ctx, start, logging.StageValidation, OutcomeValidationError,
+			res.ValidationFailure(cf.validator.GlobalError(), cf.validator.FieldErrors()), nil,
+			"global_error", cf.validator.GlobalError(), "invalid_fields", fieldNames(cf.validator.FieldErrors()))
+	}
+
+	if len(emailFormReq.Attachments) > 0 && cf.scanner != nil {
+		if response := cf.scanAttachments(ctx, start, emailFormReq, res); response != nil {
+			return response
+		}
+	}
+
+	// Attachments are processed before they are stored or mailed, so their
+	// metadata, such as where a photo was taken, is never kept.
+	if len(emailFormReq.Attachments) > 0 {
+		err = cf.trace(ctx, "attachment.Process", func(_ context.Context, _ trace.Span) error {
+			processed, err := cf.attachments.Process(emailFormReq.Attachments)
+			emailFormReq.Attachments = processed
+			return err
+		})
+		if err != nil {
+			cf.meter.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: validation.AttachmentsField})
+			return cf.complete(ctx, start, logging.StageAttachments, OutcomeValidationError,
+				res.ValidationFailure("", map[string]string{validation.AttachmentsField: AttachmentsUnreadable}), nil,
+				"invalid_fields", []string{validation.AttachmentsField}, logging.KeyError, err.Error())
+		}
+	}
+
+	cf.logger.DebugContext(ctx, "submission accepted",
+		"name", emailFormReq.Name, "email", emailFormReq.Email, "message", emailFormReq.Message)
+
+	if cf.configuration.DeliveryMode == configuration.DeliveryModeOutbox {
+		return cf.enqueue(ctx, start, emailFormReq, res)
 	}
 
 	if cf.mailer == nil {
-		fmt.Println("Mailer was nil")
-		return api.InternalFailureResponse("mailer is invalid")
+		return cf.complete(ctx, start, logging.StageMail, OutcomeInternalError,
+			res.InternalFailure(), errors.New("mailer is invalid"))
+	}
+
+	submission := cf.createSubmission(ctx, emailFormReq)
+	if submission != nil {
+		ctx = store.NewContext(ctx, submission.ID)
 	}
 
-	err := cf.mailer.SendEmail(emailFormReq)
+	err = cf.trace(ctx, "mailer.SendEmail", func(ctx context.Context, _ trace.Span) error {
+		return cf.mailer.SendEmail(ctx, emailFormReq)
+	})
 	if err != nil {
-		return api.InternalFailureResponse(err.Error())
+		cf.updateSubmission(ctx, submission, store.StatusFailed, err.Error())
+		if fieldErrors := headerInjectionErrors(err); fieldErrors != nil {
+			for field := range fieldErrors {
+				cf.meter.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: field})
+			}
+			return cf.complete(ctx, start, logging.StageMail, OutcomeValidationError,
+				res.ValidationFailure("", fieldErrors), nil, "invalid_fields", fieldNames(fieldErrors))
+		}
+		return cf.complete(ctx, start, logging.StageMail, mailFailureOutcome(err), res.MailFailure(mailFailureStatus(err), mailer.RetryAfter(err)), err)
 	}
+	cf.updateSubmission(ctx, submission, store.StatusSent, "")
 
-	return api.SuccessResponse()
+	return cf.complete(ctx, start, logging.StageExecute, OutcomeSuccess, res.Success(), nil)
+}
+
+// scanAttachments scans the request's files as the client sent them, and returns
+// the response rejecting them, or nil when they are clean.
+func (cf *ContactFormImpl) scanAttachments(ctx context.Context, start time.Time, emailFormReq *api.EmailFormRequest,
+	res api.Responder) api.Response {
+	err := cf.trace(ctx, "scanner.Scan", func(ctx context.Context, _ trace.Span) error {
+		for _, file := range emailFormReq.Attachments {
+			err := cf.scanner.Scan(ctx, file.Content)
+			cf.meter.IncCounter(ctx, metrics.AttachmentScansTotal, metrics.Labels{metrics.LabelOutcome: scanOutcome(err)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		return nil
+	}
+	cf.meter.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: validation.AttachmentsField})
+	var infected *scanner.InfectedError
+	if errors.As(err, &infected) {
+		cf.quarantineSubmission(ctx, emailFormReq, infected)
+		return cf.complete(ctx, start, logging.StageAttachments, OutcomeMalware,
+			res.ValidationFailure("", map[string]string{validation.AttachmentsField: AttachmentsInfected}), nil,
+			"invalid_fields", []string{validation.AttachmentsField}, "signature", infected.Signature)
+	}
+	return cf.complete(ctx, start, logging.StageAttachments, OutcomeValidationError,
+		res.ValidationFailure("", map[string]string{validation.AttachmentsField: AttachmentsUnscannable}), err,
+		"invalid_fields", []string{validation.AttachmentsField})
+}
+
+// scanOutcome labels a scan result: clean, infected or error.
+func scanOutcome(err error) string {
+	var infected *scanner.InfectedError
+	switch {
+	case err == nil:
+		return "clean"
+	case errors.As(err, &infected):
+		return "infected"
+	default:
+		return "error"
+	}
+}
+
+// enqueue durably stores the submission for the outbox worker, and responds 202 Accepted.
+func (cf *ContactFormImpl) enqueue(ctx context.Context, start time.Time, emailFormReq *api.EmailFormRequest, res api.Responder) api.Response {
+	if cf.store == nil {
+		return cf.complete(ctx, start, logging.StageStore, OutcomeInternalError,
+			res.InternalFailure(), errors.New("submission store is required in outbox mode"))
+	}
+	submission := store.NewSubmission(emailFormReq, requestid.FromContext(ctx), time.Now().UTC())
+	err := cf.trace(ctx, "store.Create", func(ctx context.Context, _ trace.Span) error {
+		return cf.store.Create(ctx, submission)
+	})
+	if err != nil {
+		return cf.complete(ctx, start, logging.StageStore, OutcomeInternalError, res.InternalFailure(), err)
+	}
+	return cf.complete(ctx, start, logging.StageStore, OutcomeQueued, res.Accepted(), nil,
+		"submission_id", submission.ID)
+}
+
+// createSubmission stores the submission as received. Failing to store it does
+// not stop the email being sent, so nil is returned and the error is logged.
+// The outbox worker may retry it once the claim timeout passes, should this
+// invocation not record the result.
+func (cf *ContactFormImpl) createSubmission(ctx context.Context, emailFormReq *api.EmailFormRequest) *store.Submission {
+	if cf.store == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	submission := store.NewSubmission(emailFormReq, requestid.FromContext(ctx), now)
+	submission.NextAttemptAt = now.Add(cf.configuration.OutboxClaimTimeout)
+	err := cf.trace(ctx, "store.Create", func(ctx context.Context, _ trace.Span) error {
+		return cf.store.Create(ctx, submission)
+	})
+	if err != nil {
+		cf.logger.ErrorContext(ctx, "error storing submission",
+			logging.KeyStage, logging.StageStore, logging.KeyError, err.Error())
+		return nil
+	}
+	return submission
+}
+
+// quarantineSubmission stores a submission rejected for malware as
+// quarantined, without its attachments, so the message is not lost should it
+// be a false positive. Failing to store it is only logged.
+func (cf *ContactFormImpl) quarantineSubmission(ctx context.Context, emailFormReq *api.EmailFormRequest, infected *scanner.InfectedError) {
+	if cf.store == nil {
+		return
+	}
+	now := time.Now().UTC()
+	submission := store.NewSubmission(emailFormReq, requestid.FromContext(ctx), now)
+	submission.Quarantine(infected.Error(), now)
+	err := cf.trace(ctx, "store.Create", func(ctx context.Context, _ trace.Span) error {
+		return cf.store.Create(ctx, submission)
+	})
+	if err != nil {
+		cf.logger.ErrorContext(ctx, "error storing quarantined submission",
+			logging.KeyStage, logging.StageStore, logging.KeyError, err.Error())
+	}
+}
+
+func (cf *ContactFormImpl) updateSubmission(ctx context.Context, submission *store.Submission, status store.Status, lastError string) {
+	if submission == nil {
+		return
+	}
+	err := cf.trace(ctx, "store.UpdateStatus", func(ctx context.Context, _ trace.Span) error {
+		return cf.store.UpdateStatus(ctx, submission.ID, status, lastError)
+	})
+	if err != nil {
+		cf.logger.ErrorContext(ctx, "error updating submission status",
+			logging.KeyStage, logging.StageStore, "submission_id", submission.ID, "status", status, logging.KeyError, err.Error())
+	}
+}
+
+// trace runs fn in a child span named name. An error returned by fn fails the span.
+func (cf *ContactFormImpl) trace(ctx context.Context, name string, fn func(ctx context.Context, span trace.Span) error) error {
+	ctx, span := cf.tracer.Start(ctx, name)
+	err := fn(ctx, span)
+	tracing.EndWithError(span, err)
+	return err
+}
+
+// complete logs and counts the result of the submission, and returns the response.
+func (cf *ContactFormImpl) complete(ctx context.Context, start time.Time, stage, outcome string,
+	response api.Response, err error, attrs ...any) api.Response {
+	cf.meter.IncCounter(ctx, metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: outcome})
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(tracing.AttrOutcome.String(outcome), tracing.AttrStatusCode.Int(response.Status()))
+	if err != nil {
+		span.SetStatus(codes.Error, outcome)
+	}
+	attrs = append(attrs,
+		logging.KeyStage, stage,
+		logging.KeyOutcome, outcome,
+		logging.KeyStatusCode, response.Status(),
+		logging.KeyLatency, time.Since(start).Milliseconds())
+	switch {
+	case err != nil:
+		cf.logger.ErrorContext(ctx, "contact form failed", append(attrs, logging.KeyError, err.Error())...)
+	case outcome == OutcomeValidationError, outcome == OutcomeMalware:
+		cf.logger.WarnContext(ctx, "contact form rejected", attrs...)
+	default:
+		cf.logger.InfoContext(ctx, "contact form completed", attrs...)
+	}
+	return response
+}
+
+// headerInjectionErrors returns the field error of a mailer refusing the
+// request for header injection, which is the visitor's input rather than a
+// mail failure, or nil for other errors. Validation rejects these first, so
+// this only applies to validators that do not.
+func headerInjectionErrors(err error) map[string]string {
+	var injectionErr *mailer.HeaderInjectionError
+	if !errors.As(err, &injectionErr) {
+		return nil
+	}
+	return map[string]string{injectionErr.Field: validation.HeaderValueErrorMsg(injectionErr.Field)}
+}
+
+// mailFailureOutcome labels a mailer error: rate_limited when the provider is
+// throttling, and mail_error otherwise.
+func mailFailureOutcome(err error) string {
+	if errors.Is(err, mailer.ErrProviderRateLimited) {
+		return OutcomeRateLimited
+	}
+	return OutcomeMailError
+}
+
+// mailFailureStatus maps a mailer error to the response status code: 503 when
+// the provider is throttling or down, 504 when it timed out, and 502 when it
+// rejected the email. Rejected credentials, and errors of unknown cause, are
+// internal errors.
+func mailFailureStatus(err error) int {
+	var providerErr *mailer.ProviderError
+	switch {
+	case errors.Is(err, mailer.ErrProviderTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, mailer.ErrProviderRateLimited), errors.Is(err, mailer.ErrProviderUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, mailer.ErrProviderAuth):
+		return http.StatusInternalServerError
+	case errors.As(err, &providerErr):
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// fieldNames returns the invalid field names, without the (potentially user derived) messages.
+func fieldNames(fieldErrors map[string]string) []string {
+	names := make([]string, 0, len(fieldErrors))
+	for name := range fieldErrors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// withRequestID resolves the request ID for this invocation, and stores it in the context.
+func withRequestID(ctx context.Context, emailFormReq *api.EmailFormRequest) (context.Context, string) {
+	header := ""
+	if emailFormReq != nil {
+		header = emailFormReq.Header(requestid.Header)
+	}
+	id := requestid.Resolve(ctx, header)
+	return requestid.NewContext(ctx, id), id
 }
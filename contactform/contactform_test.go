@@ -1,14 +1,36 @@
 package contactform_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"log/slog"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/breaker"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/contactform"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/scanner"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
 )
 
 func TestNewContactFormImpl(t *testing.T) {
@@ -21,7 +43,7 @@ func TestNewContactFormImpl(t *testing.T) {
 }
 
 func TestExecuteMissingAPIKey(t *testing.T) {
-	ctx := context.Background()
+	ctx := requestid.NewContext(context.Background(), testRequestID)
 	cfg := configuration.NewContactFormConfiguration()
 
 	cf := contactform.NewContactFormImpl(cfg, nil, nil)
@@ -30,10 +52,12 @@ func TestExecuteMissingAPIKey(t *testing.T) {
 		StatusCode: 500,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
 			Message:            "error",
+			RequestID:          testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -50,10 +74,12 @@ func TestExecuteNilValidator(t *testing.T) {
 		StatusCode: 500,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
 			Message:            "error",
+			RequestID:          testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -75,10 +101,12 @@ func TestExecuteInvalidRequest(t *testing.T) {
 		StatusCode: 400,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			GlobalErrorMessage: "global error from validator",
 			Message:            "error",
+			RequestID:          testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -100,6 +128,7 @@ func TestExecuteFieldValidationFailure(t *testing.T) {
 		StatusCode: 400,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			FieldErrors: []api.FieldError{
@@ -108,7 +137,8 @@ func TestExecuteFieldValidationFailure(t *testing.T) {
 					ErrorMessage: "name must be between 1 and 100 characters",
 				},
 			},
-			Message: "error",
+			Message:   "error",
+			RequestID: testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -129,10 +159,12 @@ func TestExecuteMailerIsNil(t *testing.T) {
 		StatusCode: 500,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
 			Message:            "error",
+			RequestID:          testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -157,10 +189,12 @@ func TestExecuteMailerReturnsError(t *testing.T) {
 		StatusCode: 500,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
 			Message:            "error",
+			RequestID:          testRequestID,
 		},
 	}
 	if !reflect.DeepEqual(actual, expected) {
@@ -168,6 +202,128 @@ func TestExecuteMailerReturnsError(t *testing.T) {
 	}
 }
 
+func TestExecuteChecksWithRequestContext(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	validator := &MockContextValidator{MockContactFormValidator: MockContactFormValidator{ValidResult: true}}
+
+	cf := contactform.NewContactFormImpl(cfg, validator, &MockMailer{})
+	if actual := cf.Execute(ctx, &api.EmailFormRequest{}); actual.StatusCode != 200 {
+		t.Errorf("cf.Execute() status actual[%d], does not match expected[%d]", actual.StatusCode, 200)
+	}
+	if validator.RequestID != testRequestID {
+		t.Errorf("CheckContext() request ID actual[%s], does not match expected[%s]", validator.RequestID, testRequestID)
+	}
+}
+
+func TestExecuteMapsMailerErrors(t *testing.T) {
+	type testSpec struct {
+		err             error
+		expectedStatus  int
+		expectedOutcome string
+	}
+
+	testSpecs := []testSpec{
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 401, Err: mailer.ErrProviderAuth}, expectedStatus: 500,
+			expectedOutcome: "mail_error"},
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 400, Err: mailer.ErrInvalidRecipient}, expectedStatus: 502,
+			expectedOutcome: "mail_error"},
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 413}, expectedStatus: 502, expectedOutcome: "mail_error"},
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 429, Err: mailer.ErrProviderRateLimited}, expectedStatus: 503,
+			expectedOutcome: "rate_limited"},
+		{err: fmt.Errorf("error sending email: sendgrid: %w: connection refused", mailer.ErrProviderUnavailable), expectedStatus: 503,
+			expectedOutcome: "mail_error"},
+		{err: fmt.Errorf("error sending email: sendgrid: %w: %w", mailer.ErrProviderTimeout, context.DeadlineExceeded), expectedStatus: 504,
+			expectedOutcome: "mail_error"},
+		{err: errors.New("mailer error"), expectedStatus: 500, expectedOutcome: "mail_error"},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		registry := metrics.NewRegistry()
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{SendEmailResult: test.err},
+			contactform.WithLogger(logging.Discard()), contactform.WithMeter(registry))
+
+		actual := cf.Execute(ctx, &api.EmailFormRequest{})
+		if actual.StatusCode != test.expectedStatus {
+			t.Errorf("%v: StatusCode actual[%d], does not match expected[%d]", test.err, actual.StatusCode, test.expectedStatus)
+		}
+		if strings.Contains(actual.Body.GlobalErrorMessage, "sendgrid") {
+			t.Errorf("%v: GlobalErrorMessage actual[%s], SHOULD NOT show the cause", test.err, actual.Body.GlobalErrorMessage)
+		}
+		if count := registry.Counter(metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: test.expectedOutcome}); count != 1 {
+			t.Errorf("%v: submissions with outcome [%s] actual[%v], does not match expected[1]", test.err, test.expectedOutcome, count)
+		}
+	}
+}
+
+func TestExecuteRejectsHeaderInjectionAsValidationError(t *testing.T) {
+	type testSpec struct {
+		request  api.EmailFormRequest
+		expected []api.FieldError
+	}
+
+	testSpecs := []testSpec{
+		{request: api.EmailFormRequest{Name: "Gavin\r\nBcc: eve@example.com", Email: "test@example.com"},
+			expected: []api.FieldError{{Field: "name", ErrorMessage: "name must not contain line breaks or encoded words"}}},
+		{request: api.EmailFormRequest{Name: "Gavin Thomas", Email: "=?utf-8?q?eve=40evil.example?=@example.com"},
+			expected: []api.FieldError{{Field: "email", ErrorMessage: "email must not contain line breaks or encoded words"}}},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		registry := metrics.NewRegistry()
+		capture := mailer.NewCaptureMailer()
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, capture,
+			contactform.WithLogger(logging.Discard()), contactform.WithMeter(registry))
+
+		request := test.request
+		request.Message = "This is a test message."
+		actual := cf.Execute(ctx, &request)
+		if actual.StatusCode != 400 || !reflect.DeepEqual(actual.Body.FieldErrors, test.expected) {
+			t.Errorf("%+q: cf.Execute() actual[%d, %v], does not match expected[400, %v]",
+				request.Name, actual.StatusCode, actual.Body.FieldErrors, test.expected)
+		}
+		if count := registry.Counter(metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "validation_error"}); count != 1 {
+			t.Errorf("%+q: submissions with outcome [validation_error] actual[%v], does not match expected[1]", request.Name, count)
+		}
+		field := test.expected[0].Field
+		if count := registry.Counter(metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: field}); count != 1 {
+			t.Errorf("%+q: validation failures of [%s] actual[%v], does not match expected[1]", request.Name, field, count)
+		}
+		if emails := capture.Emails(); len(emails) != 0 {
+			t.Errorf("%+q: captured emails actual[%d], SHOULD NOT send injections", request.Name, len(emails))
+		}
+	}
+}
+
+func TestExecuteRespondsRetryAfterWhileBreakerOpen(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	cfg.MailBreakerFailures = 1
+	cfg.MailBreakerOpenFor = 30 * time.Second
+	outage := &mailer.ProviderError{Provider: "sendgrid", StatusCode: 503, Err: mailer.ErrProviderUnavailable}
+	m := breaker.New(&MockMailer{SendEmailResult: outage}, cfg, breaker.WithLogger(logging.Discard()))
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, m,
+		contactform.WithLogger(logging.Discard()))
+
+	type testSpec struct {
+		name               string
+		expectedRetryAfter string
+	}
+	testSpecs := []testSpec{
+		{name: "provider outage opens the breaker", expectedRetryAfter: ""},
+		{name: "open breaker fails fast", expectedRetryAfter: "30"},
+	}
+	for _, test := range testSpecs {
+		actual := cf.Execute(ctx, &api.EmailFormRequest{})
+		if actual.StatusCode != 503 {
+			t.Errorf("%s: StatusCode actual[%d], does not match expected[503]", test.name, actual.StatusCode)
+		}
+		if actual.Headers.RetryAfter != test.expectedRetryAfter {
+			t.Errorf("%s: Retry-After actual[%s], does not match expected[%s]", test.name, actual.Headers.RetryAfter, test.expectedRetryAfter)
+		}
+	}
+}
+
 func TestExecuteSuccess(t *testing.T) {
 	ctx, cfg := setupValidConfiguration(t)
 
@@ -185,6 +341,7 @@ func TestExecuteSuccess(t *testing.T) {
 		StatusCode: 200,
 		Headers: api.ResponseHeaders{
 			ContentType: "application/json",
+			RequestID:   testRequestID,
 		},
 		Body: api.ResponseBody{
 			Message: "success",
@@ -195,11 +352,731 @@ func TestExecuteSuccess(t *testing.T) {
 	}
 }
 
+func TestExecuteProcessesAttachments(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 640, 480))); err != nil {
+		t.Fatalf("png.Encode() returned error [%v]", err)
+	}
+	// A text chunk with the location, after the signature and IHDR chunk.
+	text := []byte("tEXtLocation\x0035.6586N 139.7454E")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = binary.BigEndian.AppendUint32(append(chunk, text...), crc32.ChecksumIEEE(text))
+	content := append(append(append([]byte{}, encoded.Bytes()[:33]...), chunk...), encoded.Bytes()[33:]...)
+
+	mockedMailer := &MockMailer{}
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer)
+	actual := cf.Execute(ctx, &api.EmailFormRequest{Attachments: []api.Attachment{{Filename: "venue.png", Content: content}}})
+	if actual.StatusCode != 200 {
+		t.Fatalf("cf.Execute() status actual[%d], does not match expected[200]", actual.StatusCode)
+	}
+	attachments := mockedMailer.Request.Attachments
+	if len(attachments) != 2 {
+		t.Fatalf("mailed attachments actual[%d], does not match expected[2]", len(attachments))
+	}
+	if bytes.Contains(attachments[0].Content, []byte("139.7454E")) {
+		t.Errorf("mailed attachment SHOULD NOT contain its location")
+	}
+	if attachments[1].ContentID != "thumbnail-1-venue.png" {
+		t.Errorf("thumbnail content ID actual[%s], does not match expected[thumbnail-1-venue.png]", attachments[1].ContentID)
+	}
+}
+
+func TestExecuteRejectsUnreadableAttachments(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	mockedMailer := &MockMailer{}
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer)
+	actual := cf.Execute(ctx, &api.EmailFormRequest{Attachments: []api.Attachment{
+		{Filename: "venue.jpg", Content: []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")},
+	}})
+	expected := []api.FieldError{{Field: "attachments", ErrorMessage: contactform.AttachmentsUnreadable}}
+	if actual.StatusCode != 400 || !reflect.DeepEqual(actual.Body.FieldErrors, expected) {
+		t.Errorf("cf.Execute() actual[%d, %v], does not match expected[400, %v]", actual.StatusCode, actual.Body.FieldErrors, expected)
+	}
+	if mockedMailer.Request != nil {
+		t.Errorf("mailer SHOULD NOT be called with unreadable attachments")
+	}
+}
+
+func TestExecuteSanitizesRequests(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	mockedMailer := &MockMailer{}
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer)
+	actual := cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin\t Thomas\u202e", Email: "gavin@example.com",
+		Message: "Hello\r\nthere\u200b"})
+	if actual.StatusCode != 200 {
+		t.Errorf("cf.Execute() status actual[%d], does not match expected[200]", actual.StatusCode)
+	}
+	if mockedMailer.Request == nil || mockedMailer.Request.Name != "Gavin Thomas" ||
+		mockedMailer.Request.Message != "Hello\nthere" {
+		t.Errorf("mailed request actual[%+v], SHOULD be sanitized", mockedMailer.Request)
+	}
+}
+
+func TestExecuteRejectsHiddenCharacters(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	registry := metrics.NewRegistry()
+	mockedMailer := &MockMailer{}
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer,
+		contactform.WithMeter(registry))
+	actual := cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin", Email: "gavin@exa\u200bmple.com", Message: "Hello"})
+	expected := []api.FieldError{{Field: "email", ErrorMessage: "email must not contain control, bidirectional or invisible characters"}}
+	if actual.StatusCode != 400 || !reflect.DeepEqual(actual.Body.FieldErrors, expected) {
+		t.Errorf("cf.Execute() actual[%d, %v], does not match expected[400, %v]", actual.StatusCode, actual.Body.FieldErrors, expected)
+	}
+	if mockedMailer.Request != nil {
+		t.Errorf("mailer SHOULD NOT be called with rejected fields")
+	}
+	if count := registry.Counter(metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: "email"}); count != 1 {
+		t.Errorf("validation failures actual[%v], does not match expected[1]", count)
+	}
+}
+
+func TestExecuteRejectsHeaderInjection(t *testing.T) {
+	type testSpec struct {
+		name          string
+		email         string
+		expectedField string
+	}
+
+	testSpecs := []testSpec{
+		{name: "Gavin\r\nBcc: eve@example.com", email: "gavin@example.com", expectedField: "name"},
+		{name: "Gavin\nBcc: eve@example.com", email: "gavin@example.com", expectedField: "name"},
+		{name: "=?utf-8?q?Gavin=0D=0ABcc:_eve@example.com?=", email: "gavin@example.com", expectedField: "name"},
+		{name: "=?utf-8?q?Gavin?\u200b=", email: "gavin@example.com", expectedField: "name"},
+		{name: "Gavin", email: "gavin@example.com\r\nBcc: eve@example.com", expectedField: "email"},
+		{name: "Gavin", email: "=?utf-8?q?eve=40evil.example?=@example.com", expectedField: "email"},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		mockedMailer := &MockMailer{}
+		cf := contactform.NewContactFormImpl(cfg, validation.NewContactFormValidator(), mockedMailer)
+		actual := cf.Execute(ctx, &api.EmailFormRequest{Name: test.name, Email: test.email, Message: "Hello"})
+		expected := []api.FieldError{{Field: test.expectedField,
+			ErrorMessage: test.expectedField + " must not contain line breaks or encoded words"}}
+		if actual.StatusCode != 400 || !reflect.DeepEqual(actual.Body.FieldErrors, expected) {
+			t.Errorf("%+q, %+q: cf.Execute() actual[%d, %v], does not match expected[400, %v]",
+				test.name, test.email, actual.StatusCode, actual.Body.FieldErrors, expected)
+		}
+		if mockedMailer.Request != nil {
+			t.Errorf("%+q, %+q: mailer SHOULD NOT be called with header injection", test.name, test.email)
+		}
+	}
+}
+
+func TestExecuteScansAttachments(t *testing.T) {
+	type testSpec struct {
+		name               string
+		scanResult         error
+		expectedStatusCode int
+		expectedFieldError string
+		expectedOutcome    string
+		expectedScan       string
+	}
+
+	testSpecs := []testSpec{
+		{name: "clean", expectedStatusCode: 200, expectedOutcome: "success", expectedScan: "clean"},
+		{name: "infected", scanResult: &scanner.InfectedError{Signature: "Win.Test.EICAR_HDB-1"}, expectedStatusCode: 400,
+			expectedFieldError: contactform.AttachmentsInfected, expectedOutcome: "malware", expectedScan: "infected"},
+		{name: "unscannable", scanResult: errors.New("connecting to clamd: connection refused"), expectedStatusCode: 400,
+			expectedFieldError: contactform.AttachmentsUnscannable, expectedOutcome: "validation_error", expectedScan: "error"},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cfg := setupValidConfiguration(t)
+			registry := metrics.NewRegistry()
+			mockedScanner := &MockScanner{ScanResult: test.scanResult}
+			mockedMailer := &MockMailer{}
+			cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer,
+				contactform.WithScanner(mockedScanner), contactform.WithMeter(registry))
+
+			content := []byte("%PDF-1.7\n")
+			actual := cf.Execute(ctx, &api.EmailFormRequest{Attachments: []api.Attachment{{Filename: "brief.pdf", Content: content}}})
+			if actual.StatusCode != test.expectedStatusCode {
+				t.Errorf("cf.Execute() status actual[%d], does not match expected[%d]", actual.StatusCode, test.expectedStatusCode)
+			}
+			if len(mockedScanner.Scanned) != 1 || !bytes.Equal(mockedScanner.Scanned[0], content) {
+				t.Errorf("scanned actual[%q], does not match expected[[%q]]", mockedScanner.Scanned, content)
+			}
+			if test.expectedFieldError != "" {
+				expected := []api.FieldError{{Field: "attachments", ErrorMessage: test.expectedFieldError}}
+				if !reflect.DeepEqual(actual.Body.FieldErrors, expected) {
+					t.Errorf("field errors actual[%v], does not match expected[%v]", actual.Body.FieldErrors, expected)
+				}
+				if mockedMailer.Request != nil {
+					t.Errorf("mailer SHOULD NOT be called with rejected attachments")
+				}
+			}
+			if actual := registry.Counter(metrics.SubmissionsTotal, metrics.Labels{"outcome": test.expectedOutcome}); actual != 1 {
+				t.Errorf("submissions with outcome [%s] actual[%v], does not match expected[1]", test.expectedOutcome, actual)
+			}
+			if actual := registry.Counter(metrics.AttachmentScansTotal, metrics.Labels{"outcome": test.expectedScan}); actual != 1 {
+				t.Errorf("scans with outcome [%s] actual[%v], does not match expected[1]", test.expectedScan, actual)
+			}
+		})
+	}
+}
+
+func TestRespondNegotiatesV2FromAcceptHeader(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	mockedValidator := &MockContactFormValidator{
+		ValidResult:       false,
+		FieldErrorsResult: map[string]string{"name": "name must be between 1 and 100 characters"},
+	}
+
+	cf := contactform.NewContactFormImpl(cfg, mockedValidator, nil)
+	actual := cf.Respond(ctx, &api.EmailFormRequest{
+		Headers: map[string]string{"accept": "application/problem+json"},
+	})
+	expected := api.ResponseV2{
+		StatusCode: 400,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/problem+json",
+			RequestID:   testRequestID,
+		},
+		Body: api.ProblemDetails{
+			Type:     "https://ippoippophotography.com/problems/validation-error",
+			Title:    "Validation failed",
+			Status:   400,
+			Detail:   "One or more fields are invalid.",
+			Instance: "urn:request:" + testRequestID,
+			Errors: []api.FieldError{
+				{
+					Field:        "name",
+					ErrorMessage: "name must be between 1 and 100 characters",
+				},
+			},
+			RequestID: testRequestID,
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("cf.Respond() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
+func TestRespondNegotiatesV2FromRequestField(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	mockedValidator := &MockContactFormValidator{
+		ValidResult: true,
+	}
+
+	mockedMailer := &MockMailer{
+		SendEmailResult: nil,
+	}
+
+	cf := contactform.NewContactFormImpl(cfg, mockedValidator, mockedMailer)
+	actual := cf.Respond(ctx, &api.EmailFormRequest{APIVersion: "2"})
+	expected := api.ResponseV2{
+		StatusCode: 200,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/json",
+			RequestID:   testRequestID,
+		},
+		Body: api.SuccessBody{
+			Title:  "Message sent",
+			Status: 200,
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("cf.Respond() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
+func TestRespondDefaultsToV1(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+
+	mockedValidator := &MockContactFormValidator{
+		ValidResult: true,
+	}
+
+	mockedMailer := &MockMailer{
+		SendEmailResult: errors.New("mailer error"),
+	}
+
+	cf := contactform.NewContactFormImpl(cfg, mockedValidator, mockedMailer)
+	actual := cf.Respond(ctx, &api.EmailFormRequest{})
+	expected := api.EmailFormResponse{
+		StatusCode: 500,
+		Headers: api.ResponseHeaders{
+			ContentType: "application/json",
+			RequestID:   testRequestID,
+		},
+		Body: api.ResponseBody{
+			GlobalErrorMessage: "Unexpected error occurred. Please try again later.",
+			Message:            "error",
+			RequestID:          testRequestID,
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("cf.Respond() actual[%v], does not match expected[%v]", actual, expected)
+	}
+}
+
+func TestExecuteUsesIncomingRequestIDHeader(t *testing.T) {
+	t.Setenv("SENDGRID_API_KEY", "valid-api-key")
+	cfg := configuration.NewContactFormConfiguration()
+
+	mockedValidator := &MockContactFormValidator{
+		ValidResult: true,
+	}
+
+	mockedMailer := &MockMailer{
+		SendEmailResult: nil,
+	}
+
+	cf := contactform.NewContactFormImpl(cfg, mockedValidator, mockedMailer)
+	actual := cf.Execute(context.Background(), &api.EmailFormRequest{
+		Headers: map[string]string{"x-request-id": "frontend-id-1"},
+	})
+	if actual.Headers.RequestID != "frontend-id-1" {
+		t.Errorf("cf.Execute() X-Request-Id actual[%s], does not match expected[%s]", actual.Headers.RequestID, "frontend-id-1")
+	}
+	if mockedMailer.RequestID != "frontend-id-1" {
+		t.Errorf("mailer request ID actual[%s], does not match expected[%s]", mockedMailer.RequestID, "frontend-id-1")
+	}
+}
+
+func TestExecuteGeneratesRequestID(t *testing.T) {
+	t.Setenv("SENDGRID_API_KEY", "valid-api-key")
+	t.Setenv("__OW_ACTIVATION_ID", "")
+	cfg := configuration.NewContactFormConfiguration()
+
+	cf := contactform.NewContactFormImpl(cfg, nil, nil)
+	actual := cf.Execute(context.Background(), &api.EmailFormRequest{})
+	if !requestid.Valid(actual.Headers.RequestID) {
+		t.Errorf("cf.Execute() SHOULD generate a request ID, got [%s]", actual.Headers.RequestID)
+	}
+	if actual.Body.RequestID != actual.Headers.RequestID {
+		t.Errorf("cf.Execute() body request ID [%s] SHOULD match header [%s]", actual.Body.RequestID, actual.Headers.RequestID)
+	}
+}
+
+func TestExecuteLogsOutcome(t *testing.T) {
+	type testSpec struct {
+		validator       *MockContactFormValidator
+		mailer          *MockMailer
+		expectedLevel   slog.Level
+		expectedStage   string
+		expectedOutcome string
+	}
+
+	testSpecs := []testSpec{
+		{
+			validator:       &MockContactFormValidator{ValidResult: true},
+			mailer:          &MockMailer{},
+			expectedLevel:   slog.LevelInfo,
+			expectedStage:   "execute",
+			expectedOutcome: "success",
+		},
+		{
+			validator:       &MockContactFormValidator{FieldErrorsResult: map[string]string{"email": "email must be a valid email address"}},
+			mailer:          &MockMailer{},
+			expectedLevel:   slog.LevelWarn,
+			expectedStage:   "validation",
+			expectedOutcome: "validation_error",
+		},
+		{
+			validator:       &MockContactFormValidator{ValidResult: true},
+			mailer:          &MockMailer{SendEmailResult: errors.New("mailer error")},
+			expectedLevel:   slog.LevelError,
+			expectedStage:   "mail",
+			expectedOutcome: "mail_error",
+		},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		recorder := logging.NewRecorder()
+
+		cf := contactform.NewContactFormImpl(cfg, test.validator, test.mailer,
+			contactform.WithLogger(logging.NewWithHandler(recorder, nil)))
+		cf.Execute(ctx, &api.EmailFormRequest{Email: "test@example.com"})
+
+		records := recorder.Records()
+		if len(records) == 0 {
+			t.Fatal("len(Records()) SHOULD NOT be 0")
+		}
+		last := records[len(records)-1]
+		if last.Level != test.expectedLevel {
+			t.Errorf("log level actual[%v], does not match expected[%v]", last.Level, test.expectedLevel)
+		}
+		attrs := logging.Attrs(last)
+		if actual := attrs["request_id"].String(); actual != testRequestID {
+			t.Errorf("request_id actual[%s], does not match expected[%s]", actual, testRequestID)
+		}
+		if actual := attrs["stage"].String(); actual != test.expectedStage {
+			t.Errorf("stage actual[%s], does not match expected[%s]", actual, test.expectedStage)
+		}
+		if actual := attrs["outcome"].String(); actual != test.expectedOutcome {
+			t.Errorf("outcome actual[%s], does not match expected[%s]", actual, test.expectedOutcome)
+		}
+		if _, ok := attrs["latency_ms"]; !ok {
+			t.Error("latency_ms SHOULD be logged")
+		}
+	}
+}
+
+func TestExecuteRedactsSubmissionByPolicy(t *testing.T) {
+	type testSpec struct {
+		policy        redaction.Policy
+		expectedEmail string
+	}
+
+	testSpecs := []testSpec{
+		{policy: redaction.PolicyNone, expectedEmail: "[REDACTED]"},
+		{policy: redaction.PolicyMasked, expectedEmail: "t***@example.com#973dfe46"},
+		{policy: redaction.PolicyFullDebug, expectedEmail: "test@example.com"},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		recorder := logging.NewRecorder()
+
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{},
+			contactform.WithLogger(logging.NewWithHandler(recorder, redaction.New(test.policy))))
+		cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"})
+
+		found := false
+		for _, record := range recorder.Records() {
+			if record.Message != "submission accepted" {
+				continue
+			}
+			found = true
+			if actual := logging.Attrs(record)["email"].String(); actual != test.expectedEmail {
+				t.Errorf("email with policy [%s] actual[%s], does not match expected[%s]", test.policy, actual, test.expectedEmail)
+			}
+		}
+		if !found {
+			t.Errorf("submission accepted SHOULD be logged with policy [%s]", test.policy)
+		}
+	}
+}
+
+func TestExecuteRecordsMetrics(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	registry := metrics.NewRegistry()
+
+	invalid := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{
+		FieldErrorsResult: map[string]string{
+			"email":   "email must be a valid email address",
+			"message": "message must be between 1 and 1000 characters",
+		},
+	}, &MockMailer{}, contactform.WithMeter(registry))
+	invalid.Execute(ctx, &api.EmailFormRequest{})
+
+	failing := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true},
+		&MockMailer{SendEmailResult: errors.New("mailer error")}, contactform.WithMeter(registry))
+	failing.Execute(ctx, &api.EmailFormRequest{})
+	failing.Execute(ctx, &api.EmailFormRequest{})
+
+	type expectation struct {
+		name     string
+		labels   metrics.Labels
+		expected float64
+	}
+	expectations := []expectation{
+		{name: "contact_submissions_total", labels: metrics.Labels{"outcome": "validation_error"}, expected: 1},
+		{name: "contact_submissions_total", labels: metrics.Labels{"outcome": "mail_error"}, expected: 2},
+		{name: "contact_submissions_total", labels: metrics.Labels{"outcome": "success"}, expected: 0},
+		{name: "contact_validation_failures_total", labels: metrics.Labels{"field": "email"}, expected: 1},
+		{name: "contact_validation_failures_total", labels: metrics.Labels{"field": "message"}, expected: 1},
+	}
+	for _, e := range expectations {
+		if actual := registry.Counter(e.name, e.labels); actual != e.expected {
+			t.Errorf("Counter(%s, %v) actual[%v], does not match expected[%v]", e.name, e.labels, actual, e.expected)
+		}
+	}
+}
+
+func TestExecuteCreatesSpans(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{},
+		contactform.WithTracerProvider(tp))
+	cf.Execute(ctx, &api.EmailFormRequest{
+		Name:    "Gavin Thomas",
+		Email:   "test@example.com",
+		Message: "This is a test message.",
+		Headers: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	})
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	root, ok := spans["contactform.Execute"]
+	if !ok {
+		t.Fatal("contactform.Execute span SHOULD be recorded")
+	}
+	if actual := root.SpanContext().TraceID().String(); actual != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("root TraceID() actual[%s], SHOULD continue the incoming trace", actual)
+	}
+	if actual := root.Parent().SpanID().String(); actual != "00f067aa0ba902b7" {
+		t.Errorf("root Parent() actual[%s], SHOULD be the incoming span", actual)
+	}
+	for _, name := range []string{"contactform.configuration", "contactform.validation", "mailer.SendEmail"} {
+		child, ok := spans[name]
+		if !ok {
+			t.Errorf("%s span SHOULD be recorded", name)
+			continue
+		}
+		if child.Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s span SHOULD be a child of contactform.Execute", name)
+		}
+	}
+
+	attrs := make(map[string]string)
+	for _, span := range recorder.Ended() {
+		for _, attr := range span.Attributes() {
+			if value := attr.Value.Emit(); value == "test@example.com" || value == "Gavin Thomas" {
+				t.Errorf("span %s attribute %s SHOULD NOT contain PII", span.Name(), attr.Key)
+			}
+		}
+	}
+	for _, attr := range root.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["contact.outcome"] != "success" {
+		t.Errorf("contact.outcome actual[%s], does not match expected[success]", attrs["contact.outcome"])
+	}
+	if attrs["http.response.status_code"] != "200" {
+		t.Errorf("http.response.status_code actual[%s], does not match expected[200]", attrs["http.response.status_code"])
+	}
+}
+
+func TestExecuteMailerErrorFailsSpans(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true},
+		&MockMailer{SendEmailResult: errors.New("mailer error")}, contactform.WithTracerProvider(tp))
+	cf.Execute(ctx, &api.EmailFormRequest{})
+
+	for _, span := range recorder.Ended() {
+		if span.Name() != "mailer.SendEmail" && span.Name() != "contactform.Execute" {
+			continue
+		}
+		if span.Status().Code != codes.Error {
+			t.Errorf("%s span status actual[%v], does not match expected[%v]", span.Name(), span.Status().Code, codes.Error)
+		}
+	}
+}
+
+func TestExecuteKeepsErrorMessagesOutOfSpans(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	const filename = "gavin-thomas-passport.jpg"
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{},
+		contactform.WithTracerProvider(tp))
+	cf.Execute(ctx, &api.EmailFormRequest{Attachments: []api.Attachment{
+		{Filename: filename, Content: []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")},
+	}})
+
+	failed := false
+	for _, span := range recorder.Ended() {
+		failed = failed || span.Status().Code == codes.Error
+		if strings.Contains(span.Status().Description, filename) {
+			t.Errorf("span %s status [%s] SHOULD NOT contain the filename", span.Name(), span.Status().Description)
+		}
+		for _, event := range span.Events() {
+			for _, attr := range event.Attributes {
+				if strings.Contains(attr.Value.Emit(), filename) {
+					t.Errorf("span %s event %s attribute %s SHOULD NOT contain the filename", span.Name(), event.Name, attr.Key)
+				}
+			}
+		}
+	}
+	if !failed {
+		t.Error("attachment.Process span SHOULD be failed")
+	}
+}
+
+func TestExecuteStoresSubmissionStatus(t *testing.T) {
+	type testSpec struct {
+		mailerResult   error
+		expectedStatus store.Status
+		expectedError  string
+	}
+
+	testSpecs := []testSpec{
+		{mailerResult: nil, expectedStatus: store.StatusSent},
+		{mailerResult: errors.New("mailer error"), expectedStatus: store.StatusFailed, expectedError: "mailer error"},
+	}
+
+	for _, test := range testSpecs {
+		ctx, cfg := setupValidConfiguration(t)
+		submissionStore, err := store.NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileStore() returned error [%v]", err)
+		}
+
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true},
+			&MockMailer{SendEmailResult: test.mailerResult}, contactform.WithSubmissionStore(submissionStore))
+		cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"})
+
+		submissions, _ := submissionStore.List(ctx, test.expectedStatus)
+		if len(submissions) != 1 {
+			t.Fatalf("len(List(%s)) actual[%d], does not match expected[1]", test.expectedStatus, len(submissions))
+		}
+		submission := submissions[0]
+		if submission.Email != "test@example.com" || submission.RequestID != testRequestID {
+			t.Errorf("submission actual[%+v], does not match the request", submission)
+		}
+		if submission.LastError != test.expectedError {
+			t.Errorf("LastError actual[%s], does not match expected[%s]", submission.LastError, test.expectedError)
+		}
+		if len(submission.Transitions) != 2 || submission.Transitions[0].Status != store.StatusReceived {
+			t.Errorf("Transitions actual[%+v], SHOULD be received then %s", submission.Transitions, test.expectedStatus)
+		}
+	}
+}
+
+func TestExecuteQuarantinesInfectedSubmissions(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	submissionStore, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	mockedMailer := &MockMailer{}
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer,
+		contactform.WithSubmissionStore(submissionStore),
+		contactform.WithScanner(&MockScanner{ScanResult: &scanner.InfectedError{Signature: "Win.Test.EICAR_HDB-1"}}))
+	cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello",
+		Attachments: []api.Attachment{{Filename: "brief.pdf", Content: []byte("%PDF-1.7\n")}}})
+
+	submissions, _ := submissionStore.List(ctx, store.StatusQuarantined)
+	if len(submissions) != 1 {
+		t.Fatalf("len(List(quarantined)) actual[%d], does not match expected[1]", len(submissions))
+	}
+	submission := submissions[0]
+	if submission.Message != "Hello" || submission.RequestID != testRequestID || len(submission.Attachments) != 0 {
+		t.Errorf("submission actual[%+v], SHOULD keep the message without its attachments", submission)
+	}
+	if submission.LastError != "malware found: Win.Test.EICAR_HDB-1" {
+		t.Errorf("LastError actual[%s], does not match expected[malware found: Win.Test.EICAR_HDB-1]", submission.LastError)
+	}
+	if due, _ := submissionStore.ListDue(ctx, time.Now().UTC().Add(time.Hour), 10); len(due) != 0 {
+		t.Errorf("ListDue() actual[%+v], SHOULD NOT contain quarantined submissions", due)
+	}
+	if mockedMailer.Request != nil {
+		t.Errorf("mailer SHOULD NOT be called for quarantined submissions")
+	}
+}
+
+func TestExecuteSendsEmailWhenStoreFails(t *testing.T) {
+	ctx, cfg := setupValidConfiguration(t)
+	mockedMailer := &MockMailer{}
+
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer,
+		contactform.WithSubmissionStore(&MockSubmissionStore{CreateResult: errors.New("disk full")}))
+	actual := cf.Execute(ctx, &api.EmailFormRequest{})
+	if actual.StatusCode != 200 {
+		t.Errorf("cf.Execute() StatusCode actual[%d], does not match expected[200]", actual.StatusCode)
+	}
+	if mockedMailer.RequestID != testRequestID {
+		t.Error("mailer SHOULD be called when the store fails")
+	}
+}
+
+func TestExecuteOutboxModeEnqueues(t *testing.T) {
+	t.Setenv("DELIVERY_MODE", "outbox")
+	t.Setenv("SUBMISSION_STORE", "file")
+	t.Setenv("SUBMISSION_STORE_DIR", t.TempDir())
+	ctx, cfg := setupValidConfiguration(t)
+	submissionStore, err := store.NewFileStore(cfg.SubmissionStoreDir)
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	mockedMailer := &MockMailer{SendEmailResult: errors.New("SendGrid unavailable")}
+
+	cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, mockedMailer,
+		contactform.WithSubmissionStore(submissionStore))
+	actual := cf.Execute(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"})
+
+	if actual.StatusCode != 202 || actual.Body.Message != "accepted" {
+		t.Errorf("cf.Execute() actual[%d %s], does not match expected[202 accepted]", actual.StatusCode, actual.Body.Message)
+	}
+	if mockedMailer.RequestID != "" {
+		t.Error("mailer SHOULD NOT be called in outbox mode")
+	}
+	due, _ := submissionStore.ListDue(ctx, time.Now().UTC(), 10)
+	if len(due) != 1 || due[0].Status != store.StatusReceived || due[0].RequestID != testRequestID {
+		t.Errorf("ListDue() actual[%+v], SHOULD contain the received submission", due)
+	}
+}
+
+func TestExecuteOutboxModeFailsWithoutStore(t *testing.T) {
+	type testSpec struct {
+		submissionStore store.SubmissionStore
+	}
+
+	testSpecs := []testSpec{
+		{submissionStore: nil},
+		{submissionStore: &MockSubmissionStore{CreateResult: errors.New("disk full")}},
+	}
+
+	for _, test := range testSpecs {
+		t.Setenv("DELIVERY_MODE", "outbox")
+		ctx, cfg := setupValidConfiguration(t)
+		var opts []contactform.Option
+		if test.submissionStore != nil {
+			opts = append(opts, contactform.WithSubmissionStore(test.submissionStore))
+		}
+
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{}, opts...)
+		actual := cf.Execute(ctx, &api.EmailFormRequest{})
+		if actual.StatusCode != 500 {
+			t.Errorf("cf.Execute() StatusCode actual[%d], does not match expected[500]", actual.StatusCode)
+		}
+	}
+}
+
+func TestExecuteShowsMailMode(t *testing.T) {
+	type testSpec struct {
+		env              map[string]string
+		expectedMailMode string
+	}
+
+	testSpecs := []testSpec{
+		{env: map[string]string{}, expectedMailMode: ""},
+		{env: map[string]string{"DEPLOY_ENVIRONMENT": "staging"}, expectedMailMode: "sandbox"},
+		{env: map[string]string{"MAIL_MODE": "log-only"}, expectedMailMode: "log-only"},
+	}
+
+	for _, test := range testSpecs {
+		for key, value := range test.env {
+			t.Setenv(key, value)
+		}
+		ctx, cfg := setupValidConfiguration(t)
+
+		cf := contactform.NewContactFormImpl(cfg, &MockContactFormValidator{ValidResult: true}, &MockMailer{})
+		actual := cf.Execute(ctx, &api.EmailFormRequest{})
+		if actual.Headers.MailMode != test.expectedMailMode || actual.Body.MailMode != test.expectedMailMode {
+			t.Errorf("cf.Execute() mail mode actual[%s, %s], does not match expected[%s]",
+				actual.Headers.MailMode, actual.Body.MailMode, test.expectedMailMode)
+		}
+	}
+}
+
 // Support functions
 
+const testRequestID = "test-request-id"
+
 func setupValidConfiguration(t *testing.T) (context.Context, *configuration.ContactFormConfiguration) {
 	t.Setenv("SENDGRID_API_KEY", "valid-api-key")
-	ctx := context.Background()
+	ctx := requestid.NewContext(context.Background(), testRequestID)
 	cfg := configuration.NewContactFormConfiguration()
 	return ctx, cfg
 }
@@ -227,10 +1104,43 @@ func (v *MockContactFormValidator) GlobalError() string {
 func (v *MockContactFormValidator) Check(_ any) {
 }
 
+// MockContextValidator records the request ID of the context it checks with.
+type MockContextValidator struct {
+	MockContactFormValidator
+	RequestID string
+}
+
+func (v *MockContextValidator) CheckContext(ctx context.Context, _ any) {
+	v.RequestID = requestid.FromContext(ctx)
+}
+
 type MockMailer struct {
 	SendEmailResult error
+	RequestID       string
+	Request         *api.EmailFormRequest
 }
 
-func (m *MockMailer) SendEmail(_ *api.EmailFormRequest) error {
+func (m *MockMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	m.RequestID = requestid.FromContext(ctx)
+	m.Request = request
 	return m.SendEmailResult
 }
+
+type MockScanner struct {
+	ScanResult error
+	Scanned    [][]byte
+}
+
+func (s *MockScanner) Scan(_ context.Context, content []byte) error {
+	s.Scanned = append(s.Scanned, content)
+	return s.ScanResult
+}
+
+type MockSubmissionStore struct {
+	store.SubmissionStore
+	CreateResult error
+}
+
+func (s *MockSubmissionStore) Create(_ context.Context, _ *store.Submission) error {
+	return s.CreateResult
+}
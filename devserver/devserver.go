@@ -0,0 +1,197 @@
+// Package devserver runs the contact form over HTTP on a developer machine, with
+// emails captured in memory instead of sent, similar to MailHog.
+package devserver
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/contactform"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+// maxRequestBytes allows for the largest attachments, base64 encoded in JSON.
+const maxRequestBytes = 64<<10 + validation.MaxAttachmentsBytes*4/3
+
+// Routes served by New.
+const (
+	ContactPath  = "/contact"
+	MessagesPath = "/messages"
+)
+
+type server struct {
+	newContactForm func() contactform.ContactForm
+	capture        *mailer.CaptureMailer
+	logger         *slog.Logger
+}
+
+type Option func(*server)
+
+// WithLogger sets the logger. Without it, logging.Default() is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *server) {
+		s.logger = logger
+	}
+}
+
+// New returns the development server:
+//
+//	POST   /contact   the contact form, taking the function's JSON or a multipart
+//	                  form with files, and returning the function's JSON
+//	GET    /          the captured emails, as HTML
+//	GET    /messages  the captured emails, as JSON
+//	DELETE /messages  deletes the captured emails
+//
+// newContactForm is called for every request, since validators keep the errors
+// of the request they checked.
+func New(newContactForm func() contactform.ContactForm, capture *mailer.CaptureMailer, opts ...Option) http.Handler {
+	s := &server{newContactForm: newContactForm, capture: capture, logger: logging.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(ContactPath, s.contact)
+	mux.HandleFunc(MessagesPath, s.messages)
+	mux.HandleFunc("/", s.index)
+	return mux
+}
+
+// contact is the equivalent of the DigitalOcean web function. Browsers may call
+// it from a frontend served on another port.
+func (s *server) contact(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id, Retry-After")
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Traceparent, X-Request-Id")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request, err := readRequest(http.MaxBytesReader(w, r.Body, maxRequestBytes), r.Header.Get("Content-Type"))
+	if err != nil {
+		s.writeResponse(w, api.ValidationFailureResponse("invalid request body", nil))
+		return
+	}
+	// Web functions receive the HTTP headers in the request, with lower case names.
+	request.Headers = make(map[string]string, len(r.Header))
+	for name := range r.Header {
+		request.Headers[strings.ToLower(name)] = r.Header.Get(name)
+	}
+	s.writeResponse(w, s.newContactForm().Respond(r.Context(), request))
+}
+
+// readRequest reads the function's JSON, or a multipart/form-data form with
+// file inputs, by contentType.
+func readRequest(body io.Reader, contentType string) (*api.EmailFormRequest, error) {
+	if mediaType, params, err := mime.ParseMediaType(contentType); err == nil && mediaType == "multipart/form-data" {
+		return api.ReadMultipartRequest(body, params["boundary"])
+	}
+	var request api.EmailFormRequest
+	if err := json.NewDecoder(body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (s *server) messages(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", api.JSONMediaType)
+		if err := json.NewEncoder(w).Encode(s.capture.Emails()); err != nil {
+			s.logger.Error("error writing messages", logging.KeyError, err.Error())
+		}
+	case http.MethodDelete:
+		s.capture.Reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, s.capture.Emails()); err != nil {
+		s.logger.Error("error writing messages page", logging.KeyError, err.Error())
+	}
+}
+
+// writeResponse writes a versioned response envelope as an HTTP response, as
+// DigitalOcean does for web functions.
+func (s *server) writeResponse(w http.ResponseWriter, res api.Response) {
+	data, err := json.Marshal(res)
+	var envelope struct {
+		Body    json.RawMessage   `json:"body"`
+		Headers map[string]string `json:"headers"`
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &envelope)
+	}
+	if err != nil {
+		s.logger.Error("error writing response", logging.KeyError, err.Error())
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	for name, value := range envelope.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(res.Status())
+	w.Write(envelope.Body)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Captured emails</title>
+<style>
+body { font-family: sans-serif; margin: 2rem; max-width: 60rem; }
+article { border: 1px solid #ccc; border-radius: 4px; margin-bottom: 1rem; padding: 1rem; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.25rem 1rem; margin: 0; }
+dt { color: #666; }
+pre { white-space: pre-wrap; background: #f6f6f6; padding: 0.5rem; }
+</style>
+</head>
+<body>
+<h1>Captured emails ({{len .}})</h1>
+<p>Submit the form to <code>POST /contact</code>. Emails are also available as <a href="/messages">JSON</a>.
+<button onclick="fetch('/messages', {method: 'DELETE'}).then(() => location.reload())">Clear</button></p>
+{{range .}}
+<article>
+<dl>
+<dt>Sent</dt><dd>{{.SentAt.Format "2006-01-02 15:04:05 MST"}}</dd>
+<dt>From</dt><dd>{{.From}}</dd>
+<dt>To</dt><dd>{{.To}}</dd>
+<dt>Reply-To</dt><dd>{{.ReplyTo}}</dd>
+<dt>Subject</dt><dd>{{.Subject}}</dd>
+<dt>Request ID</dt><dd>{{.RequestID}}</dd>
+{{range .Attachments}}<dt>Attachment</dt><dd>{{.Filename}} ({{.ContentType}}, {{.Size}} bytes{{if .ContentID}}, inline{{end}})</dd>
+{{end}}</dl>
+<pre>{{.Body}}</pre>
+</article>
+{{else}}
+<p>No emails yet.</p>
+{{end}}
+</body>
+</html>
+`))
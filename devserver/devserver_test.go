@@ -0,0 +1,208 @@
+package devserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/contactform"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/devserver"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+const validRequest = `{"name": "Gavin Thomas", "email": "test@example.com", "message": "Hello <b>there</b>"}`
+
+func TestContact(t *testing.T) {
+	type testSpec struct {
+		body                string
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+		expectedEmails      int
+	}
+
+	testSpecs := []testSpec{
+		{body: validRequest, expectedStatus: 200, expectedContentType: "application/json", expectedBody: `"message":"success"`, expectedEmails: 1},
+		{body: `{"name": "", "email": "test@example.com", "message": "Hello"}`, expectedStatus: 400,
+			expectedContentType: "application/json", expectedBody: `"field":"name"`},
+		{body: `{"name": "", "email": "test@example.com", "message": "Hello"}`, accept: "application/problem+json", expectedStatus: 400,
+			expectedContentType: "application/problem+json", expectedBody: `"title":"Validation failed"`},
+		{body: `{`, expectedStatus: 400, expectedContentType: "application/json", expectedBody: "invalid request body"},
+	}
+
+	for _, test := range testSpecs {
+		handler, capture := setupServer(t)
+		req := httptest.NewRequest(http.MethodPost, devserver.ContactPath, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Request-Id", "req-123")
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedStatus {
+			t.Errorf("POST %s status actual[%d], does not match expected[%d]", test.body, rec.Code, test.expectedStatus)
+		}
+		if actual := rec.Header().Get("Content-Type"); actual != test.expectedContentType {
+			t.Errorf("POST %s Content-Type actual[%s], does not match expected[%s]", test.body, actual, test.expectedContentType)
+		}
+		if !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Errorf("POST %s body actual[%s], SHOULD contain [%s]", test.body, rec.Body.String(), test.expectedBody)
+		}
+		if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Error("POST SHOULD allow cross-origin requests")
+		}
+		if len(capture.Emails()) != test.expectedEmails {
+			t.Errorf("POST %s emails actual[%d], does not match expected[%d]", test.body, len(capture.Emails()), test.expectedEmails)
+		}
+	}
+}
+
+func TestContactUsesRequestHeaders(t *testing.T) {
+	handler, capture := setupServer(t)
+	req := httptest.NewRequest(http.MethodPost, devserver.ContactPath, strings.NewReader(validRequest))
+	req.Header.Set("X-Request-Id", "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if actual := rec.Header().Get("X-Request-Id"); actual != "req-123" {
+		t.Errorf("X-Request-Id header actual[%s], does not match expected[req-123]", actual)
+	}
+	if emails := capture.Emails(); len(emails) != 1 || emails[0].RequestID != "req-123" {
+		t.Errorf("captured emails actual[%+v], SHOULD have the request ID", emails)
+	}
+}
+
+func TestContactMultipart(t *testing.T) {
+	type testSpec struct {
+		name                string
+		file                []byte
+		expectedStatus      int
+		expectedAttachments []mailer.CapturedAttachment
+	}
+
+	testSpecs := []testSpec{
+		{name: "pdf", file: []byte("%PDF-1.7\n"), expectedStatus: 200,
+			expectedAttachments: []mailer.CapturedAttachment{{Filename: "brief.pdf", ContentType: "application/pdf", Size: 9}}},
+		{name: "script", file: []byte("<html><script>alert(1)</script>"), expectedStatus: 400},
+	}
+
+	for _, test := range testSpecs {
+		handler, capture := setupServer(t)
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		writer.WriteField("name", "Gavin Thomas")
+		writer.WriteField("email", "test@example.com")
+		writer.WriteField("message", "Please see the brief.")
+		file, _ := writer.CreateFormFile("attachments", "../brief.pdf")
+		file.Write(test.file)
+		writer.Close()
+		req := httptest.NewRequest(http.MethodPost, devserver.ContactPath, &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedStatus {
+			t.Errorf("%s: status actual[%d], does not match expected[%d]", test.name, rec.Code, test.expectedStatus)
+		}
+		var actual []mailer.CapturedAttachment
+		if emails := capture.Emails(); len(emails) == 1 {
+			actual = emails[0].Attachments
+		}
+		if !reflect.DeepEqual(actual, test.expectedAttachments) {
+			t.Errorf("%s: attachments actual[%+v], does not match expected[%+v]", test.name, actual, test.expectedAttachments)
+		}
+	}
+}
+
+func TestContactPreflight(t *testing.T) {
+	handler, _ := setupServer(t)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, devserver.ContactPath, nil))
+
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS status actual[%d], does not match expected[%d]", rec.Code, http.StatusNoContent)
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), "Content-Type") {
+		t.Errorf("Access-Control-Allow-Headers actual[%s], SHOULD allow Content-Type", rec.Header().Get("Access-Control-Allow-Headers"))
+	}
+}
+
+func TestMessages(t *testing.T) {
+	handler, _ := setupServer(t)
+	handler.ServeHTTP(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, devserver.ContactPath, strings.NewReader(validRequest)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, devserver.MessagesPath, nil))
+	var emails []mailer.CapturedEmail
+	if err := json.Unmarshal(rec.Body.Bytes(), &emails); err != nil {
+		t.Fatalf("GET %s returned invalid JSON [%v]", devserver.MessagesPath, err)
+	}
+	if len(emails) != 1 || emails[0].ReplyTo != "test@example.com" {
+		t.Errorf("GET %s actual[%+v], SHOULD contain the email", devserver.MessagesPath, emails)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	page := rec.Body.String()
+	if !strings.Contains(page, "Captured emails (1)") || !strings.Contains(page, "test@example.com") {
+		t.Errorf("GET / actual[%s], SHOULD list the email", page)
+	}
+	if !strings.Contains(page, "Hello &lt;b&gt;there&lt;/b&gt;") {
+		t.Error("GET / SHOULD escape the message")
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, devserver.MessagesPath, nil))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, devserver.MessagesPath, nil))
+	if strings.TrimSpace(rec.Body.String()) != "[]" {
+		t.Errorf("GET %s after DELETE actual[%s], does not match expected[[]]", devserver.MessagesPath, rec.Body.String())
+	}
+}
+
+func TestUnknownRoutes(t *testing.T) {
+	type testSpec struct {
+		method         string
+		path           string
+		expectedStatus int
+	}
+
+	testSpecs := []testSpec{
+		{method: http.MethodGet, path: devserver.ContactPath, expectedStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: devserver.MessagesPath, expectedStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, path: "/unknown", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, test := range testSpecs {
+		handler, _ := setupServer(t)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(test.method, test.path, nil))
+		if rec.Code != test.expectedStatus {
+			t.Errorf("%s %s status actual[%d], does not match expected[%d]", test.method, test.path, rec.Code, test.expectedStatus)
+		}
+	}
+}
+
+// Support functions
+
+func setupServer(t *testing.T) (http.Handler, *mailer.CaptureMailer) {
+	t.Setenv("SENDGRID_API_KEY", "unused-by-capture-mailer")
+	cfg := configuration.NewContactFormConfiguration()
+	capture := mailer.NewCaptureMailer()
+	newContactForm := func() contactform.ContactForm {
+		return contactform.NewContactFormImpl(cfg, validation.NewContactFormValidator(validation.WithLogger(logging.Discard())),
+			capture, contactform.WithLogger(logging.Discard()))
+	}
+	return devserver.New(newContactForm, capture, devserver.WithLogger(logging.Discard())), capture
+}
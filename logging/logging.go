@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+// Attribute keys shared by every package, so log queries stay consistent.
+const (
+	KeyRequestID  = "request_id"
+	KeyStage      = "stage"
+	KeyOutcome    = "outcome"
+	KeyLatency    = "latency_ms"
+	KeyStatusCode = "status_code"
+	KeyProvider   = "provider"
+	KeyError      = "error"
+	KeyMailMode   = "mail_mode"
+)
+
+// Stages of a contact form submission.
+const (
+	StageConfiguration = "configuration"
+	StageSanitization  = "sanitization"
+	StageValidation    = "validation"
+	StageAttachments   = "attachments"
+	StageStore         = "store"
+	StageMail          = "mail"
+	StageExecute       = "execute"
+)
+
+// New returns a JSON logger writing to w. A nil redactor uses redaction.PolicyNone.
+func New(w io.Writer, level slog.Leveler, redactor *redaction.Redactor) *slog.Logger {
+	return NewWithHandler(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}), redactor)
+}
+
+// NewWithHandler wraps next so that records carry the request ID from the
+// context, and personal data is redacted by the redactor's policy.
+func NewWithHandler(next slog.Handler, redactor *redaction.Redactor) *slog.Logger {
+	if redactor == nil {
+		redactor = redaction.New(redaction.PolicyNone)
+	}
+	return slog.New(&handler{next: next, redactor: redactor})
+}
+
+// Default returns the logger used when none is injected: JSON to stdout at info level,
+// with personal data removed.
+func Default() *slog.Logger {
+	return New(os.Stdout, slog.LevelInfo, nil)
+}
+
+// ForPolicy returns the default logger, redacting by policy.
+func ForPolicy(policy redaction.Policy) *slog.Logger {
+	return New(os.Stdout, slog.LevelInfo, redaction.New(policy))
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return New(io.Discard, slog.LevelError+1, nil)
+}
+
+type handler struct {
+	next     slog.Handler
+	redactor *redaction.Redactor
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	out := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	if id := requestid.FromContext(ctx); id != "" {
+		out.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		out.AddAttrs(h.redactor.Attr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, out)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redactedAttrs := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redactedAttrs = append(redactedAttrs, h.redactor.Attr(attr))
+	}
+	return &handler{next: h.next.WithAttrs(redactedAttrs), redactor: h.redactor}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name), redactor: h.redactor}
+}
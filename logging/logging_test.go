@@ -0,0 +1,90 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+func TestNewWritesJSONWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelInfo, nil)
+	ctx := requestid.NewContext(context.Background(), "req-123")
+
+	logger.InfoContext(ctx, "contact form completed", logging.KeyStage, logging.StageExecute)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log output is not JSON [%s]: %v", buf.String(), err)
+	}
+	expected := map[string]any{
+		"level":      "INFO",
+		"msg":        "contact form completed",
+		"request_id": "req-123",
+		"stage":      "execute",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("log record [%s] actual[%v], does not match expected[%v]", key, record[key], value)
+		}
+	}
+}
+
+func TestNewRespectsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.New(&buf, slog.LevelWarn, nil)
+
+	logger.Info("not written")
+	if buf.Len() != 0 {
+		t.Errorf("Info() SHOULD NOT be written at warn level, got [%s]", buf.String())
+	}
+}
+
+func TestPIIAttributesAreRedacted(t *testing.T) {
+	recorder := logging.NewRecorder()
+	logger := logging.NewWithHandler(recorder, nil).With("email", "test@example.com")
+
+	logger.Info("submission",
+		"name", "Gavin Thomas",
+		"message", "This is a test message.",
+		slog.Group("request", "email", "test@example.com"),
+		logging.KeyStage, logging.StageValidation)
+
+	records := recorder.Records()
+	if len(records) != 1 {
+		t.Fatalf("len(Records()) actual[%d], does not match expected[1]", len(records))
+	}
+	attrs := logging.Attrs(records[0])
+	for _, key := range []string{"name", "email", "request"} {
+		if actual := attrs[key].String(); actual != "[REDACTED]" {
+			t.Errorf("attribute [%s] actual[%s], SHOULD be redacted", key, actual)
+		}
+	}
+	if actual := attrs["message"].String(); actual != "[REDACTED] len=23" {
+		t.Errorf("attribute [message] actual[%s], SHOULD be redacted", actual)
+	}
+	if actual := attrs[logging.KeyStage].String(); actual != logging.StageValidation {
+		t.Errorf("attribute [%s] actual[%s], does not match expected[%s]", logging.KeyStage, actual, logging.StageValidation)
+	}
+}
+
+func TestFullDebugPolicyKeepsPII(t *testing.T) {
+	recorder := logging.NewRecorder()
+	logger := logging.NewWithHandler(recorder, redaction.New(redaction.PolicyFullDebug))
+
+	logger.Debug("submission", "email", "test@example.com", "api_key", "valid-api-key")
+
+	attrs := logging.Attrs(recorder.Records()[0])
+	if actual := attrs["email"].String(); actual != "test@example.com" {
+		t.Errorf("attribute [email] actual[%s], does not match expected[%s]", actual, "test@example.com")
+	}
+	if actual := attrs["api_key"].String(); actual != "[REDACTED]" {
+		t.Errorf("attribute [api_key] actual[%s], SHOULD be redacted", actual)
+	}
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Recorder is a slog.Handler that keeps records in memory, so tests can assert on them.
+type Recorder struct {
+	mu      *sync.Mutex
+	records *[]slog.Record
+	attrs   []slog.Attr
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{mu: &sync.Mutex{}, records: &[]slog.Record{}}
+}
+
+func (r *Recorder) Enabled(_ context.Context, _ slog.Level) bool {
+	return true
+}
+
+func (r *Recorder) Handle(_ context.Context, record slog.Record) error {
+	record = record.Clone()
+	record.AddAttrs(r.attrs...)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*r.records = append(*r.records, record)
+	return nil
+}
+
+func (r *Recorder) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Recorder{mu: r.mu, records: r.records, attrs: append(append([]slog.Attr{}, r.attrs...), attrs...)}
+}
+
+func (r *Recorder) WithGroup(_ string) slog.Handler {
+	return r
+}
+
+// Records returns a copy of the records handled so far.
+func (r *Recorder) Records() []slog.Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]slog.Record{}, *r.records...)
+}
+
+// Attrs flattens the attributes of record into a map keyed by attribute key.
+func Attrs(record slog.Record) map[string]slog.Value {
+	attrs := make(map[string]slog.Value)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs[attr.Key] = attr.Value
+		return true
+	})
+	return attrs
+}
@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+// CapturedEmail is an email kept by a CaptureMailer, as it would have been sent.
+type CapturedEmail struct {
+	ID        int               `json:"id"`
+	RequestID string            `json:"requestId,omitempty"`
+	SentAt    time.Time         `json:"sentAt"`
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	ReplyTo   string            `json:"replyTo"`
+	Subject   string            `json:"subject"`
+	Body      string            `json:"body"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	// Attachments describe the attached files, without their content.
+	Attachments []CapturedAttachment `json:"attachments,omitempty"`
+}
+
+// CapturedAttachment is a file attached to a CapturedEmail, as it would have been sent.
+type CapturedAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int    `json:"size"`
+	// ContentID is set for inline attachments, such as thumbnails.
+	ContentID string `json:"contentId,omitempty"`
+}
+
+// CaptureMailer keeps emails in memory instead of sending them, for local
+// development and tests. It is safe for concurrent use.
+type CaptureMailer struct {
+	mu     sync.Mutex
+	emails []CapturedEmail
+	nextID int
+}
+
+func NewCaptureMailer() *CaptureMailer {
+	return &CaptureMailer{nextID: 1}
+}
+
+func (m *CaptureMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	message := buildMessage(request, requestid.FromContext(ctx))
+	email := CapturedEmail{
+		RequestID: requestid.FromContext(ctx),
+		SentAt:    time.Now().UTC(),
+		From:      message.From.Address,
+		ReplyTo:   request.Email,
+		Subject:   message.Subject,
+		Headers:   message.Headers,
+	}
+	if len(message.Personalizations) > 0 && len(message.Personalizations[0].To) > 0 {
+		email.To = message.Personalizations[0].To[0].Address
+	}
+	if len(message.Content) > 0 {
+		email.Body = message.Content[0].Value
+	}
+	for _, file := range attachment.Prepare(request.Attachments) {
+		email.Attachments = append(email.Attachments, CapturedAttachment{Filename: file.Filename,
+			ContentType: file.ContentType, Size: len(file.Content), ContentID: file.ContentID})
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	email.ID = m.nextID
+	m.nextID++
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+// Emails returns the captured emails, newest first.
+func (m *CaptureMailer) Emails() []CapturedEmail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	emails := make([]CapturedEmail, len(m.emails))
+	for i, email := range m.emails {
+		emails[len(m.emails)-1-i] = email
+	}
+	return emails
+}
+
+// Reset deletes the captured emails.
+func (m *CaptureMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = nil
+}
@@ -0,0 +1,78 @@
+package mailer_test
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+func TestCaptureMailer(t *testing.T) {
+	m := mailer.NewCaptureMailer()
+	ctx := requestid.NewContext(context.Background(), "req-123")
+
+	for _, message := range []string{"First message", "Second message"} {
+		err := m.SendEmail(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: message})
+		if err != nil {
+			t.Fatalf("SendEmail() returned error [%v]", err)
+		}
+	}
+
+	emails := m.Emails()
+	if len(emails) != 2 {
+		t.Fatalf("len(Emails()) actual[%d], does not match expected[2]", len(emails))
+	}
+	latest := emails[0]
+	if latest.ID != 2 || latest.Body != "Second message" {
+		t.Errorf("Emails()[0] actual[%d %s], SHOULD be the newest email", latest.ID, latest.Body)
+	}
+	if latest.RequestID != "req-123" || latest.Headers["X-Request-Id"] != "req-123" {
+		t.Errorf("RequestID actual[%s], does not match expected[req-123]", latest.RequestID)
+	}
+	if latest.ReplyTo != "test@example.com" || latest.To != "contact@ippoippophotography.com" || latest.Subject == "" {
+		t.Errorf("Emails()[0] actual[%+v], SHOULD be addressed as sent by SendGrid", latest)
+	}
+
+	m.Reset()
+	if len(m.Emails()) != 0 {
+		t.Error("Emails() SHOULD be empty after Reset()")
+	}
+}
+
+func TestCaptureMailerDescribesAttachments(t *testing.T) {
+	m := mailer.NewCaptureMailer()
+	err := m.SendEmail(context.Background(), &api.EmailFormRequest{Message: "Hello",
+		Attachments: []api.Attachment{{Filename: "C:\\photos\\venue", Content: []byte("\x89PNG\r\n\x1a\n")}}})
+	if err != nil {
+		t.Fatalf("SendEmail() returned error [%v]", err)
+	}
+	expected := []mailer.CapturedAttachment{{Filename: "venue.png", ContentType: "image/png", Size: 8}}
+	if actual := m.Emails()[0].Attachments; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Attachments actual[%+v], does not match expected[%+v]", actual, expected)
+	}
+}
+
+func TestCaptureMailerConcurrentSends(t *testing.T) {
+	m := mailer.NewCaptureMailer()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.SendEmail(context.Background(), &api.EmailFormRequest{Message: "Hello"})
+		}()
+	}
+	wg.Wait()
+
+	seen := make(map[int]bool)
+	for _, email := range m.Emails() {
+		seen[email.ID] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("unique IDs actual[%d], does not match expected[20]", len(seen))
+	}
+}
@@ -0,0 +1,174 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Classes of provider failure. Errors returned by SendEmail wrap at most one
+// of them, for errors.Is.
+var (
+	// ErrProviderAuth is returned when the provider rejects the credentials,
+	// eg. a revoked API key. It needs the configuration fixed, not a retry.
+	ErrProviderAuth = errors.New("mail provider rejected the credentials")
+	// ErrProviderRateLimited is returned when the provider throttles requests.
+	ErrProviderRateLimited = errors.New("mail provider rate limited the request")
+	// ErrProviderUnavailable is returned for provider outages: 5xx responses,
+	// and failures to connect.
+	ErrProviderUnavailable = errors.New("mail provider unavailable")
+	// ErrProviderTimeout is returned when the provider does not respond in
+	// time. The email may have been sent.
+	ErrProviderTimeout = errors.New("mail provider timed out")
+	// ErrInvalidRecipient is returned when the provider rejects an address of
+	// the email.
+	ErrInvalidRecipient = errors.New("mail provider rejected a recipient")
+	// ErrHeaderInjection is returned, before any provider is called, for
+	// requests whose name or email would inject into the Reply-To header.
+	ErrHeaderInjection = errors.New("request would inject into mail headers")
+)
+
+// maxErrorBodyBytes bounds the provider response kept in a ProviderError.
+const maxErrorBodyBytes = 512
+
+// ProviderError is a provider's response rejecting an email, whatever the provider.
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	// Body is the start of the response body, describing the rejection.
+	Body string
+	// Err is the class of the rejection, eg. ErrProviderAuth. It is nil for
+	// other rejections, such as malformed requests.
+	Err error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("error sending email: %s responded %d: %s", e.Provider, e.StatusCode, e.Body)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// HeaderInjectionError is the ErrHeaderInjection of a request, naming the
+// field, eg. validation.NameField, that would inject into the headers.
+type HeaderInjectionError struct {
+	Field string
+}
+
+func (e *HeaderInjectionError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrHeaderInjection, e.Field)
+}
+
+func (e *HeaderInjectionError) Unwrap() error {
+	return ErrHeaderInjection
+}
+
+// Retryable reports whether sending again may succeed: after rate limiting,
+// outages and timeouts. Rejected credentials, recipients and requests, and
+// header injection, fail again until fixed. Errors of unknown cause are retryable.
+func Retryable(err error) bool {
+	switch {
+	case errors.Is(err, ErrProviderRateLimited), errors.Is(err, ErrProviderUnavailable), errors.Is(err, ErrProviderTimeout):
+		return true
+	case errors.Is(err, ErrProviderAuth), errors.Is(err, ErrInvalidRecipient), errors.Is(err, ErrHeaderInjection):
+		return false
+	}
+	var providerErr *ProviderError
+	return !errors.As(err, &providerErr)
+}
+
+// RetryAfter returns how long to wait before sending again, when err knows,
+// such as an open circuit breaker's error. It is zero otherwise.
+func RetryAfter(err error) time.Duration {
+	var retryAfter interface{ RetryAfter() time.Duration }
+	if errors.As(err, &retryAfter) {
+		return retryAfter.RetryAfter()
+	}
+	return 0
+}
+
+// classify returns the class of a provider response. rejectsRecipient
+// recognises the provider's invalid recipient responses.
+func classify(statusCode int, body string, rejectsRecipient func(statusCode int, body string) bool) error {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrProviderAuth
+	case statusCode == http.StatusTooManyRequests:
+		return ErrProviderRateLimited
+	case statusCode == http.StatusGatewayTimeout:
+		return ErrProviderTimeout
+	case statusCode >= 500:
+		return ErrProviderUnavailable
+	case rejectsRecipient != nil && rejectsRecipient(statusCode, body):
+		return ErrInvalidRecipient
+	}
+	return nil
+}
+
+// transportError classifies an error reaching the provider. Cancellation is
+// left unclassified, as the caller gave up rather than the provider.
+func transportError(provider string, err error) error {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("error sending email: %s: %w", provider, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("error sending email: %s: %w: %w", provider, ErrProviderTimeout, err)
+	default:
+		return fmt.Errorf("error sending email: %s: %w: %w", provider, ErrProviderUnavailable, err)
+	}
+}
+
+// mentionsAddress returns a rejectsRecipient for providers describing an
+// invalid address with statusCode, and a message mentioning the address.
+func mentionsAddress(statusCode int) func(int, string) bool {
+	return func(actual int, body string) bool {
+		return actual == statusCode && strings.Contains(strings.ToLower(body), "address")
+	}
+}
+
+// sendGridRejectsRecipient recognises SendGrid's 400 errors for the to or
+// reply_to fields.
+func sendGridRejectsRecipient(statusCode int, body string) bool {
+	if statusCode != http.StatusBadRequest {
+		return false
+	}
+	var response struct {
+		Errors []struct {
+			Field string `json:"field"`
+		} `json:"errors"`
+	}
+	if json.Unmarshal([]byte(body), &response) != nil {
+		return false
+	}
+	for _, e := range response.Errors {
+		if strings.HasPrefix(e.Field, "reply_to") || strings.Contains(e.Field, ".to") {
+			return true
+		}
+	}
+	return false
+}
+
+// postmarkRejectsRecipient recognises Postmark's 422 errors for inactive
+// (bounced or unsubscribed) recipients, and invalid addresses.
+func postmarkRejectsRecipient(statusCode int, body string) bool {
+	if statusCode != http.StatusUnprocessableEntity {
+		return false
+	}
+	var response struct {
+		ErrorCode int
+		Message   string
+	}
+	if json.Unmarshal([]byte(body), &response) != nil {
+		return false
+	}
+	const invalidRequest, inactiveRecipient = 300, 406
+	return response.ErrorCode == inactiveRecipient ||
+		response.ErrorCode == invalidRequest && strings.Contains(strings.ToLower(response.Message), "address")
+}
@@ -0,0 +1,22 @@
+package mailer
+
+import (
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+// checkHeaders returns a *HeaderInjectionError unless the request's values that
+// reach the mail headers are safe, so no provider's handling of line breaks
+// or encoded words is relied on. Requests are validated before, so this only
+// guards against mailers used without validation.
+func checkHeaders(request *api.EmailFormRequest) error {
+	for _, field := range []struct{ name, value string }{
+		{validation.NameField, request.Name},
+		{validation.EmailField, request.Email},
+	} {
+		if !validation.ValidHeaderValue(field.value) {
+			return &HeaderInjectionError{Field: field.name}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package mailer_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+)
+
+// injections are requests whose name or email would inject into the Reply-To header.
+var injections = []api.EmailFormRequest{
+	{Name: "Gavin\r\nBcc: eve@example.com", Email: "test@example.com"},
+	{Name: "Gavin\nBcc: eve@example.com", Email: "test@example.com"},
+	{Name: "Gavin\r\n\r\nForged body", Email: "test@example.com"},
+	{Name: "Gavin\x00", Email: "test@example.com"},
+	{Name: "Gavin\u2028Bcc: eve@example.com", Email: "test@example.com"},
+	{Name: "=?utf-8?q?Gavin=0D=0ABcc:_eve@example.com?=", Email: "test@example.com"},
+	{Name: "=?UTF-8?B?R2F2aW4NCkJjYzogZXZlQGV4YW1wbGUuY29t?=", Email: "test@example.com"},
+	{Name: "Gavin Thomas", Email: "test@example.com\r\nBcc: eve@example.com"},
+	{Name: "Gavin Thomas", Email: "=?utf-8?q?eve=40evil.example?=@example.com"},
+}
+
+func TestMailersRejectHeaderInjection(t *testing.T) {
+	providers := []string{configuration.MailProviderSendGrid, configuration.MailProviderMailgun, configuration.MailProviderPostmark,
+		configuration.MailProviderSES, configuration.MailProviderResend}
+	modes := []string{configuration.MailModeOff, configuration.MailModeSandbox, configuration.MailModeLogOnly}
+
+	for _, provider := range providers {
+		for _, mode := range modes {
+			t.Run(provider+"/"+mode, func(t *testing.T) {
+				standIn := newStandIn(http.StatusOK)
+				defer standIn.Close()
+				cfg := providerConfiguration(provider, standIn.URL)
+				cfg.MailMode = mode
+				m, err := mailer.New(cfg, mailer.WithLogger(logging.Discard()))
+				if err != nil {
+					t.Fatalf("New() returned error [%v]", err)
+				}
+
+				for _, injection := range injections {
+					request := injection
+					request.Message = "This is a test message."
+					if err := m.SendEmail(testContext(), &request); !errors.Is(err, mailer.ErrHeaderInjection) {
+						t.Errorf("SendEmail(%+q, %+q) error actual[%v], does not match expected[%v]",
+							request.Name, request.Email, err, mailer.ErrHeaderInjection)
+					}
+					if body, err := m.(mailer.Renderer).Render(testContext(), &request); !errors.Is(err, mailer.ErrHeaderInjection) || body != nil {
+						t.Errorf("Render(%+q, %+q) actual[%s, %v], SHOULD return [%v]",
+							request.Name, request.Email, body, err, mailer.ErrHeaderInjection)
+					}
+				}
+				if standIn.request != nil {
+					t.Errorf("provider SHOULD NOT be called, called with [%s]", standIn.body)
+				}
+			})
+		}
+	}
+}
+
+func TestCaptureMailerRejectsHeaderInjection(t *testing.T) {
+	m := mailer.NewCaptureMailer()
+	for _, injection := range injections {
+		request := injection
+		if err := m.SendEmail(testContext(), &request); !errors.Is(err, mailer.ErrHeaderInjection) {
+			t.Errorf("SendEmail(%+q, %+q) error actual[%v], does not match expected[%v]",
+				request.Name, request.Email, err, mailer.ErrHeaderInjection)
+		}
+	}
+	if emails := m.Emails(); len(emails) != 0 {
+		t.Errorf("captured emails actual[%d], SHOULD NOT capture injections", len(emails))
+	}
+}
+
+func TestHeaderInjectionErrorNamesField(t *testing.T) {
+	m := mailer.NewCaptureMailer()
+	for _, injection := range injections {
+		request := injection
+		expected := "name"
+		if request.Name == "Gavin Thomas" {
+			expected = "email"
+		}
+		var injectionErr *mailer.HeaderInjectionError
+		if err := m.SendEmail(testContext(), &request); !errors.As(err, &injectionErr) || injectionErr.Field != expected {
+			t.Errorf("SendEmail(%+q, %+q) error actual[%v], SHOULD name the field [%s]", request.Name, request.Email, err, expected)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package mailer
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+)
+
+// htmlTemplate shows the message, escaped, followed by the inline images.
+var htmlTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body>
+<p style="white-space: pre-wrap">{{.Text}}</p>
+{{range .Images}}<img src="{{.Source}}" alt="{{.Alt}}" style="max-width: 100%; margin: 0 8px 8px 0">
+{{end}}</body>
+</html>
+`))
+
+type htmlImage struct {
+	// Source is a cid: URL, which html/template would otherwise not allow.
+	Source template.URL
+	Alt    string
+}
+
+// htmlBody returns the HTML alternative of an email showing text and its inline
+// attachments, such as thumbnails. Without inline attachments it returns "", as
+// the email is only plain text.
+func htmlBody(text string, attachments []api.Attachment) string {
+	var images []htmlImage
+	for _, file := range attachments {
+		if file.ContentID != "" {
+			// RFC 2392: a cid: URL is the URL-encoded Content-ID.
+			images = append(images, htmlImage{Source: template.URL("cid:" + url.PathEscape(file.ContentID)), Alt: file.Filename})
+		}
+	}
+	if len(images) == 0 {
+		return ""
+	}
+	var body strings.Builder
+	data := struct {
+		Text   string
+		Images []htmlImage
+	}{Text: text, Images: images}
+	if err := htmlTemplate.Execute(&body, data); err != nil {
+		// The template only fails when writing fails, and strings.Builder does not.
+		return ""
+	}
+	return body.String()
+}
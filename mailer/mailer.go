@@ -1,63 +1,235 @@
 package mailer
 
 import (
+	"context"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
 
+	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
 )
 
 var (
-	acceptedSendStatusCodes = []int{200, 202}
-	contactEmailAddress     = "contact@ippoippophotography.com"
-	websiteUrl              = "https://ippoippophotography.com"
+	contactEmailAddress = "contact@ippoippophotography.com"
+	websiteUrl          = "https://ippoippophotography.com"
 )
 
+// defaultHTTPClient is shared by every mailer without WithHTTPClient, so warm
+// function invocations reuse its connections.
+var defaultHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
 type Mailer interface {
-	SendEmail(request *api.EmailFormRequest) error
+	SendEmail(ctx context.Context, request *api.EmailFormRequest) error
+}
+
+// Renderer is implemented by Mailers that can show the provider request they
+// would send, without sending it.
+type Renderer interface {
+	Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error)
 }
 
+const (
+	sendGridProvider     = "sendgrid"
+	sendGridSendEndpoint = "/v3/mail/send"
+)
+
+// custom_args keys, returned by SendGrid's event webhook.
+const (
+	customArgRequestID    = "request_id"
+	customArgSubmissionID = "submission_id"
+)
+
 type SendGridMailer struct {
-	configuration *configuration.ContactFormConfiguration
+	base
 }
 
-func NewSendGridMailer(cfg *configuration.ContactFormConfiguration) *SendGridMailer {
-	return &SendGridMailer{configuration: cfg}
+type Option func(*base)
+
+// WithLogger sets the logger. Without it, a default logger redacting by the
+// configured LogPIIPolicy is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(b *base) {
+		b.logger = logger
+	}
+}
+
+// WithMeter sets the meter for provider latency. Without it, metrics are discarded.
+func WithMeter(meter metrics.Meter) Option {
+	return func(b *base) {
+		b.meter = meter
+	}
 }
 
-func (m *SendGridMailer) SendEmail(request *api.EmailFormRequest) error {
-	message := buildMessage(request)
-	client := sendgrid.NewSendClient(m.configuration.SendGridApiKey)
-	emailSendResponse, err := client.Send(message)
+// WithTracerProvider sets the provider for the outbound HTTP spans. Without it,
+// the global OpenTelemetry provider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(b *base) {
+		b.tracerProvider = tp
+	}
+}
+
+// WithHTTPClient sets the client for provider requests, eg. for timeouts,
+// proxies or test transports. Share one client between mailers to reuse its
+// connections. Without it, a shared client with a 30 second timeout is used.
+func WithHTTPClient(client *http.Client) Option {
+	return func(b *base) {
+		b.httpClient = client
+	}
+}
+
+func NewSendGridMailer(cfg *configuration.ContactFormConfiguration, opts ...Option) *SendGridMailer {
+	return &SendGridMailer{base: newBase(sendGridProvider, cfg, sendGridRejectsRecipient, opts)}
+}
+
+func (m *SendGridMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	message := m.buildMessage(ctx, request)
+	if m.configuration.MailMode == configuration.MailModeLogOnly {
+		body := ""
+		if len(message.Content) > 0 {
+			body = message.Content[0].Value
+		}
+		return m.logOnly(ctx, message.Subject, message.ReplyTo.Address, body, request.Attachments)
+	}
+	sendRequest := sendgrid.GetRequest(m.configuration.SendGridApiKey, sendGridSendEndpoint, m.configuration.SendGridBaseURL)
+	sendRequest.Method = rest.Post
+	sendRequest.Body = mail.GetRequestBody(message)
+	req, err := rest.BuildRequestObject(sendRequest)
 	if err != nil {
-		fmt.Printf("Error sending email: %v", err)
 		return err
 	}
-	if !m.isAcceptedStatusCode(emailSendResponse.StatusCode) {
-		fmt.Printf("Error sending email: %v", emailSendResponse.Body)
-		return fmt.Errorf("error sending email: %v", emailSendResponse.Body)
+	return m.send(ctx, req)
+}
+
+// Render returns the SendGrid request body for request.
+func (m *SendGridMailer) Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error) {
+	if err := checkHeaders(request); err != nil {
+		return nil, err
+	}
+	return mail.GetRequestBody(m.buildMessage(ctx, request)), nil
+}
+
+// buildMessage builds the message for the configured template, SendGrid
+// settings and MailMode, with the request's attachments.
+func (m *SendGridMailer) buildMessage(ctx context.Context, request *api.EmailFormRequest) *mail.SGMailV3 {
+	requestID := requestid.FromContext(ctx)
+	now := m.now()
+	message := buildMessage(request, requestID)
+	if m.configuration.SendGridTemplateID != "" {
+		message = buildTemplateMessage(request, requestID, m.configuration.SendGridTemplateID, now)
+	}
+	m.applySettings(message, request, requestID, store.IDFromContext(ctx), now)
+	files := attachment.Prepare(request.Attachments)
+	for _, file := range files {
+		attached := mail.NewAttachment().
+			SetContent(base64.StdEncoding.EncodeToString(file.Content)).
+			SetType(file.ContentType).
+			SetFilename(file.Filename).
+			SetDisposition("attachment")
+		if file.ContentID != "" {
+			attached.SetDisposition("inline").SetContentID(file.ContentID)
+		}
+		message.AddAttachment(attached)
+	}
+	// Template emails are laid out in SendGrid, which can show the thumbnails
+	// by their content IDs.
+	if html := htmlBody(request.Message, files); html != "" && m.configuration.SendGridTemplateID == "" {
+		message.AddContent(mail.NewContent("text/html", html))
 	}
-	return nil
+	if m.configuration.MailMode == configuration.MailModeSandbox {
+		message.SetMailSettings(mail.NewMailSettings().SetSandboxMode(mail.NewSetting(true)))
+	}
+	return message
 }
 
-func buildMessage(request *api.EmailFormRequest) *mail.SGMailV3 {
+// applySettings adds the configured categories, asm, tracking and send_at
+// settings, and the custom_args that correlate SendGrid events with the
+// request and submission.
+func (m *SendGridMailer) applySettings(message *mail.SGMailV3, request *api.EmailFormRequest, requestID, submissionID string,
+	now time.Time) {
+	cfg := m.configuration
+	categories := append([]string{}, cfg.SendGridCategories...)
+	if request.FormID != "" && len(categories) < configuration.SendGridMaxCategories {
+		categories = append(categories, request.FormID)
+	}
+	if len(categories) > 0 {
+		message.AddCategories(categories...)
+	}
+	if requestID != "" {
+		message.SetCustomArg(customArgRequestID, requestID)
+	}
+	if submissionID != "" {
+		message.SetCustomArg(customArgSubmissionID, submissionID)
+	}
+	if cfg.SendGridASMGroupID != 0 {
+		message.SetASM(mail.NewASM().SetGroupID(cfg.SendGridASMGroupID).AddGroupsToDisplay(cfg.SendGridASMGroupsToDisplay...))
+	}
+	if cfg.SendGridDisableClickTracking || cfg.SendGridDisableOpenTracking {
+		tracking := mail.NewTrackingSettings()
+		if cfg.SendGridDisableClickTracking {
+			tracking.SetClickTracking(mail.NewClickTrackingSetting().SetEnable(false).SetEnableText(false))
+		}
+		if cfg.SendGridDisableOpenTracking {
+			tracking.SetOpenTracking(mail.NewOpenTrackingSetting().SetEnable(false))
+		}
+		message.SetTrackingSettings(tracking)
+	}
+	if cfg.SendGridSendDelay > 0 {
+		message.SetSendAt(int(now.Add(cfg.SendGridSendDelay).Unix()))
+	}
+}
+
+func buildMessage(request *api.EmailFormRequest, requestID string) *mail.SGMailV3 {
 	from := mail.NewEmail(fmt.Sprintf("%s Contact Form", websiteUrl), contactEmailAddress)
 	subject := fmt.Sprintf("Contact Message from %s", websiteUrl)
 	to := mail.NewEmail("ippoippo Photography", contactEmailAddress)
 	plainTextContent := request.Message
 	message := mail.NewSingleEmailPlainText(from, subject, to, plainTextContent)
 	message = message.SetReplyTo(mail.NewEmail(request.Name, request.Email))
+	if requestID != "" {
+		message = message.SetHeader(requestid.Header, requestID)
+	}
 	return message
 }
 
-func (m *SendGridMailer) isAcceptedStatusCode(statusCode int) bool {
-	for _, acceptedStatusCode := range acceptedSendStatusCodes {
-		if statusCode == acceptedStatusCode {
-			return true
-		}
+// buildTemplateMessage sends the submission as dynamic_template_data, for a
+// template edited in SendGrid. The template sets the subject and the body.
+func buildTemplateMessage(request *api.EmailFormRequest, requestID, templateID string, now time.Time) *mail.SGMailV3 {
+	personalization := mail.NewPersonalization()
+	personalization.AddTos(mail.NewEmail("ippoippo Photography", contactEmailAddress))
+	personalization.SetDynamicTemplateData("name", request.Name)
+	personalization.SetDynamicTemplateData("email", request.Email)
+	personalization.SetDynamicTemplateData("message", request.Message)
+	personalization.SetDynamicTemplateData("timestamp", now.UTC().Format(time.RFC3339))
+	personalization.SetDynamicTemplateData("form_id", request.FormID)
+	personalization.SetDynamicTemplateData("request_id", requestID)
+	fields := request.Fields
+	if fields == nil {
+		fields = map[string]string{}
 	}
-	return false
+	personalization.SetDynamicTemplateData("fields", fields)
+
+	message := mail.NewV3Mail()
+	message.SetFrom(mail.NewEmail(fmt.Sprintf("%s Contact Form", websiteUrl), contactEmailAddress))
+	message.AddPersonalizations(personalization)
+	message.SetReplyTo(mail.NewEmail(request.Name, request.Email))
+	message.SetTemplateID(templateID)
+	if requestID != "" {
+		message.SetHeader(requestid.Header, requestID)
+	}
+	return message
 }
@@ -0,0 +1,345 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+func TestBuildMessageSetsRequestIDHeader(t *testing.T) {
+	message := buildMessage(&api.EmailFormRequest{
+		Name:    "Gavin Thomas",
+		Email:   "test@example.com",
+		Message: "This is a test message.",
+	}, "req-123")
+	if actual := message.Headers["X-Request-Id"]; actual != "req-123" {
+		t.Errorf("buildMessage() X-Request-Id header actual[%s], does not match expected[%s]", actual, "req-123")
+	}
+}
+
+func TestBuildMessageWithoutRequestID(t *testing.T) {
+	message := buildMessage(&api.EmailFormRequest{
+		Name:    "Gavin Thomas",
+		Email:   "test@example.com",
+		Message: "This is a test message.",
+	}, "")
+	if _, ok := message.Headers["X-Request-Id"]; ok {
+		t.Error("buildMessage() SHOULD NOT set X-Request-Id header without a request ID")
+	}
+}
+
+func TestRenderReturnsSendGridRequestBody(t *testing.T) {
+	m := NewSendGridMailer(&configuration.ContactFormConfiguration{})
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	body, err := m.Render(ctx, &api.EmailFormRequest{
+		Name:    "Gavin Thomas",
+		Email:   "test@example.com",
+		Message: "This is a test message.",
+	})
+	if err != nil {
+		t.Fatalf("Render() returned error [%v]", err)
+	}
+
+	var rendered struct {
+		ReplyTo struct {
+			Email string `json:"email"`
+		} `json:"reply_to"`
+		Headers map[string]string `json:"headers"`
+		Content []struct {
+			Value string `json:"value"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(body, &rendered); err != nil {
+		t.Fatalf("Render() body is not JSON [%v]", err)
+	}
+	if rendered.ReplyTo.Email != "test@example.com" {
+		t.Errorf("reply_to actual[%s], does not match expected[test@example.com]", rendered.ReplyTo.Email)
+	}
+	if rendered.Headers["X-Request-Id"] != "req-123" {
+		t.Errorf("X-Request-Id header actual[%s], does not match expected[req-123]", rendered.Headers["X-Request-Id"])
+	}
+	if len(rendered.Content) != 1 || rendered.Content[0].Value != "This is a test message." {
+		t.Errorf("content actual[%+v], SHOULD be the message", rendered.Content)
+	}
+}
+
+func TestSendEmailByMailMode(t *testing.T) {
+	type testSpec struct {
+		mailMode        string
+		expectedCalls   int
+		expectedSandbox bool
+	}
+
+	testSpecs := []testSpec{
+		{mailMode: configuration.MailModeOff, expectedCalls: 1},
+		{mailMode: configuration.MailModeSandbox, expectedCalls: 1, expectedSandbox: true},
+		{mailMode: configuration.MailModeLogOnly, expectedCalls: 0},
+	}
+
+	for _, test := range testSpecs {
+		transport := &recordingTransport{}
+		recorder := logging.NewRecorder()
+		m := NewSendGridMailer(&configuration.ContactFormConfiguration{SendGridApiKey: "valid-api-key", MailMode: test.mailMode},
+			WithLogger(slog.New(recorder)), WithHTTPClient(&http.Client{Transport: transport}))
+
+		err := m.SendEmail(context.Background(), &api.EmailFormRequest{
+			Name:    "Gavin Thomas",
+			Email:   "test@example.com",
+			Message: "This is a test message.",
+		})
+		if err != nil {
+			t.Fatalf("SendEmail() in %s mode returned error [%v]", test.mailMode, err)
+		}
+		if len(transport.bodies) != test.expectedCalls {
+			t.Fatalf("SendGrid calls in %s mode actual[%d], does not match expected[%d]", test.mailMode, len(transport.bodies), test.expectedCalls)
+		}
+		if test.expectedCalls == 1 {
+			sandbox := strings.Contains(transport.bodies[0], `"sandbox_mode":{"enable":true}`)
+			if sandbox != test.expectedSandbox {
+				t.Errorf("sandbox_mode in %s mode actual[%v], does not match expected[%v]", test.mailMode, sandbox, test.expectedSandbox)
+			}
+		}
+
+		records := recorder.Records()
+		if len(records) != 1 {
+			t.Fatalf("log records in %s mode actual[%d], does not match expected[1]", test.mailMode, len(records))
+		}
+		if actual := logging.Attrs(records[0])[logging.KeyMailMode].String(); actual != test.mailMode {
+			t.Errorf("logged mail_mode actual[%s], does not match expected[%s]", actual, test.mailMode)
+		}
+	}
+}
+
+func TestSendEmailLogOnlyRedactsByPolicy(t *testing.T) {
+	var logs strings.Builder
+	m := NewSendGridMailer(&configuration.ContactFormConfiguration{MailMode: configuration.MailModeLogOnly},
+		WithLogger(logging.New(&logs, slog.LevelInfo, redaction.New(redaction.PolicyNone))))
+
+	err := m.SendEmail(context.Background(), &api.EmailFormRequest{
+		Name:    "Gavin Thomas",
+		Email:   "test@example.com",
+		Message: "This is a test message.",
+	})
+	if err != nil {
+		t.Fatalf("SendEmail() returned error [%v]", err)
+	}
+	if strings.Contains(logs.String(), "test@example.com") || strings.Contains(logs.String(), "This is a test message.") {
+		t.Errorf("log actual[%s], SHOULD NOT contain personal data", logs.String())
+	}
+	if !strings.Contains(logs.String(), `"subject":"Contact Message from https://ippoippophotography.com"`) {
+		t.Errorf("log actual[%s], SHOULD contain the subject", logs.String())
+	}
+}
+
+func TestSendEmailTemplatePayload(t *testing.T) {
+	type testSpec struct {
+		templateID      string
+		expectedPayload string
+	}
+
+	testSpecs := []testSpec{
+		{
+			templateID: "d-0123456789abcdef",
+			expectedPayload: `{"from":{"name":"https://ippoippophotography.com Contact Form","email":"contact@ippoippophotography.com"},` +
+				`"personalizations":[{"to":[{"name":"ippoippo Photography","email":"contact@ippoippophotography.com"}],` +
+				`"dynamic_template_data":{"email":"test@example.com","fields":{"venue":"Kyoto"},"form_id":"wedding-enquiry",` +
+				`"message":"This is a test message.","name":"Gavin Thomas","request_id":"req-123","timestamp":"2024-05-01T09:30:00Z"}}],` +
+				`"template_id":"d-0123456789abcdef","headers":{"X-Request-Id":"req-123"},"categories":["wedding-enquiry"],` +
+				`"custom_args":{"request_id":"req-123"},"reply_to":{"name":"Gavin Thomas","email":"test@example.com"}}`,
+		},
+		{
+			expectedPayload: `{"from":{"name":"https://ippoippophotography.com Contact Form","email":"contact@ippoippophotography.com"},` +
+				`"subject":"Contact Message from https://ippoippophotography.com",` +
+				`"personalizations":[{"to":[{"name":"ippoippo Photography","email":"contact@ippoippophotography.com"}]}],` +
+				`"content":[{"type":"text/plain","value":"This is a test message."}],` +
+				`"headers":{"X-Request-Id":"req-123"},"categories":["wedding-enquiry"],"custom_args":{"request_id":"req-123"},` +
+				`"reply_to":{"name":"Gavin Thomas","email":"test@example.com"}}`,
+		},
+	}
+
+	for _, test := range testSpecs {
+		var payload string
+		standIn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			payload = string(body)
+			w.WriteHeader(http.StatusAccepted)
+		}))
+		defer standIn.Close()
+
+		m := NewSendGridMailer(&configuration.ContactFormConfiguration{
+			SendGridApiKey:     "valid-api-key",
+			SendGridBaseURL:    standIn.URL,
+			SendGridTemplateID: test.templateID,
+		}, WithLogger(slog.New(logging.NewRecorder())), WithHTTPClient(standIn.Client()))
+		m.now = func() time.Time { return time.Date(2024, 5, 1, 18, 30, 0, 0, time.FixedZone("JST", 9*60*60)) }
+
+		ctx := requestid.NewContext(context.Background(), "req-123")
+		err := m.SendEmail(ctx, &api.EmailFormRequest{
+			Name:    "Gavin Thomas",
+			Email:   "test@example.com",
+			Message: "This is a test message.",
+			FormID:  "wedding-enquiry",
+			Fields:  map[string]string{"venue": "Kyoto"},
+		})
+		if err != nil {
+			t.Fatalf("SendEmail() with template[%s] returned error [%v]", test.templateID, err)
+		}
+		if payload != test.expectedPayload {
+			t.Errorf("payload with template[%s] actual[%s], does not match expected[%s]", test.templateID, payload, test.expectedPayload)
+		}
+	}
+}
+
+func TestRenderSendGridSettings(t *testing.T) {
+	type testSpec struct {
+		name     string
+		cfg      configuration.ContactFormConfiguration
+		formID   string
+		expected map[string]string
+	}
+
+	testSpecs := []testSpec{
+		{
+			name: "unset",
+			expected: map[string]string{
+				"custom_args": `{"request_id":"req-123","submission_id":"sub-456"}`,
+			},
+		},
+		{
+			name:   "categories with form ID",
+			cfg:    configuration.ContactFormConfiguration{SendGridCategories: []string{"contact-form", "website"}},
+			formID: "wedding-enquiry",
+			expected: map[string]string{
+				"categories": `["contact-form","website","wedding-enquiry"]`,
+			},
+		},
+		{
+			name:   "categories full",
+			cfg:    configuration.ContactFormConfiguration{SendGridCategories: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}},
+			formID: "wedding-enquiry",
+			expected: map[string]string{
+				"categories": `["1","2","3","4","5","6","7","8","9","10"]`,
+			},
+		},
+		{
+			name: "asm",
+			cfg:  configuration.ContactFormConfiguration{SendGridASMGroupID: 123, SendGridASMGroupsToDisplay: []int{123, 456}},
+			expected: map[string]string{
+				"asm": `{"group_id":123,"groups_to_display":[123,456]}`,
+			},
+		},
+		{
+			name: "tracking off",
+			cfg:  configuration.ContactFormConfiguration{SendGridDisableClickTracking: true, SendGridDisableOpenTracking: true},
+			expected: map[string]string{
+				"tracking_settings": `{"click_tracking":{"enable":false,"enable_text":false},"open_tracking":{"enable":false}}`,
+			},
+		},
+		{
+			name: "send delay",
+			cfg:  configuration.ContactFormConfiguration{SendGridSendDelay: 15 * time.Minute},
+			expected: map[string]string{
+				"send_at": `1714556700`,
+			},
+		},
+	}
+
+	for _, test := range testSpecs {
+		m := NewSendGridMailer(&test.cfg)
+		m.now = func() time.Time { return time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC) }
+		ctx := store.NewContext(requestid.NewContext(context.Background(), "req-123"), "sub-456")
+		body, err := m.Render(ctx, &api.EmailFormRequest{
+			Name:    "Gavin Thomas",
+			Email:   "test@example.com",
+			Message: "This is a test message.",
+			FormID:  test.formID,
+		})
+		if err != nil {
+			t.Fatalf("Render() returned error [%v]", err)
+		}
+		var rendered map[string]json.RawMessage
+		if err := json.Unmarshal(body, &rendered); err != nil {
+			t.Fatalf("Render() body is not JSON [%v]", err)
+		}
+		for key, expected := range test.expected {
+			if actual := string(rendered[key]); actual != expected {
+				t.Errorf("%s: %s actual[%s], does not match expected[%s]", test.name, key, actual, expected)
+			}
+		}
+		for _, key := range []string{"categories", "asm", "tracking_settings", "send_at"} {
+			if _, ok := test.expected[key]; !ok && rendered[key] != nil {
+				t.Errorf("%s: %s actual[%s], SHOULD NOT be sent", test.name, key, rendered[key])
+			}
+		}
+	}
+}
+
+func TestSendEmailReusesConnectionsToBaseURL(t *testing.T) {
+	var paths []string
+	var connections int32
+	standIn := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	standIn.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&connections, 1)
+		}
+	}
+	standIn.Start()
+	defer standIn.Close()
+
+	cfg := &configuration.ContactFormConfiguration{SendGridApiKey: "valid-api-key", SendGridBaseURL: standIn.URL}
+	client := standIn.Client()
+	request := &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+	// A mailer per send, as for each function invocation.
+	for i := 0; i < 3; i++ {
+		m := NewSendGridMailer(cfg, WithLogger(slog.New(logging.NewRecorder())), WithHTTPClient(client))
+		if err := m.SendEmail(context.Background(), request); err != nil {
+			t.Fatalf("SendEmail() returned error [%v]", err)
+		}
+	}
+
+	if !reflect.DeepEqual(paths, []string{"/v3/mail/send", "/v3/mail/send", "/v3/mail/send"}) {
+		t.Errorf("stand-in paths actual[%v], SHOULD be the send endpoint for every email", paths)
+	}
+	if actual := atomic.LoadInt32(&connections); actual != 1 {
+		t.Errorf("connections actual[%d], does not match expected[1]", actual)
+	}
+}
+
+// Support functions
+
+type recordingTransport struct {
+	bodies []string
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	rt.bodies = append(rt.bodies, string(body))
+	return &http.Response{
+		StatusCode: http.StatusAccepted,
+		Body:       io.NopCloser(strings.NewReader("")),
+		Header:     make(http.Header),
+		Request:    req,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"sort"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+const mailgunProvider = "mailgun"
+
+// MailgunMailer sends through the Mailgun messages API.
+type MailgunMailer struct {
+	base
+}
+
+func NewMailgunMailer(cfg *configuration.ContactFormConfiguration, opts ...Option) *MailgunMailer {
+	return &MailgunMailer{base: newBase(mailgunProvider, cfg, mentionsAddress(http.StatusBadRequest), opts)}
+}
+
+func (m *MailgunMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	msg := newMessage(ctx, request)
+	if m.configuration.MailMode == configuration.MailModeLogOnly {
+		return m.logOnly(ctx, msg.Subject, msg.ReplyTo, msg.Text, msg.Attachments)
+	}
+	body, contentType, err := m.encode(msg)
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(ctx, m.configuration.Mailgun.BaseURL+"/v3/"+url.PathEscape(m.configuration.Mailgun.Domain)+"/messages",
+		contentType, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth("api", m.configuration.Mailgun.APIKey)
+	return m.send(ctx, req)
+}
+
+// Render returns the Mailgun request body for request.
+func (m *MailgunMailer) Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error) {
+	if err := checkHeaders(request); err != nil {
+		return nil, err
+	}
+	body, _, err := m.encode(newMessage(ctx, request))
+	return body, err
+}
+
+// encode returns the request body for msg, and its content type. Messages with
+// attachments are multipart/form-data, with a file part for each. Inline
+// attachments are referenced by their filename, as Mailgun sets it as their
+// Content-ID.
+func (m *MailgunMailer) encode(msg message) ([]byte, string, error) {
+	form := m.form(msg)
+	if len(msg.Attachments) == 0 {
+		return []byte(form.Encode()), "application/x-www-form-urlencoded", nil
+	}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, name := range sortedFormKeys(form) {
+		for _, value := range form[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, file := range msg.Attachments {
+		disposition := "attachment"
+		if file.ContentID != "" {
+			disposition = "inline"
+		}
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", mime.FormatMediaType("form-data",
+			map[string]string{"name": disposition, "filename": file.Filename}))
+		header.Set("Content-Type", file.ContentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := part.Write(file.Content); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+func sortedFormKeys(form url.Values) []string {
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// form returns msg as Mailgun form fields. Headers are h: fields, and the
+// metadata v: fields, returned as user-variables in Mailgun events. In sandbox
+// mode, Mailgun test mode accepts the message without delivering it.
+func (m *MailgunMailer) form(msg message) url.Values {
+	form := url.Values{
+		"from":       {msg.From},
+		"to":         {msg.To},
+		"subject":    {msg.Subject},
+		"text":       {msg.Text},
+		"h:Reply-To": {msg.ReplyTo},
+	}
+	if msg.HTML != "" {
+		form.Set("html", msg.HTML)
+	}
+	for name, value := range msg.headers() {
+		form.Set("h:"+name, value)
+	}
+	for name, value := range msg.metadata() {
+		form.Set("v:"+name, value)
+	}
+	if m.configuration.MailMode == configuration.MailModeSandbox {
+		form.Set("o:testmode", "yes")
+	}
+	return form
+}
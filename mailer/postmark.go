@@ -0,0 +1,117 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+const (
+	postmarkProvider = "postmark"
+	// postmarkTestToken is accepted by Postmark without delivering the email.
+	postmarkTestToken = "POSTMARK_API_TEST"
+)
+
+// PostmarkMailer sends through the Postmark email API.
+type PostmarkMailer struct {
+	base
+}
+
+func NewPostmarkMailer(cfg *configuration.ContactFormConfiguration, opts ...Option) *PostmarkMailer {
+	return &PostmarkMailer{base: newBase(postmarkProvider, cfg, postmarkRejectsRecipient, opts)}
+}
+
+type postmarkHeader struct {
+	Name  string
+	Value string
+}
+
+// postmarkAttachment has its content base64 encoded, as []byte is in JSON.
+type postmarkAttachment struct {
+	Name        string
+	Content     []byte
+	ContentType string
+	// ContentID is the "cid:" URL of an inline attachment.
+	ContentID string `json:",omitempty"`
+}
+
+type postmarkEmail struct {
+	From          string
+	To            string
+	ReplyTo       string
+	Subject       string
+	TextBody      string
+	HtmlBody      string `json:",omitempty"`
+	MessageStream string
+	Headers       []postmarkHeader
+	Metadata      map[string]string
+	Attachments   []postmarkAttachment `json:",omitempty"`
+}
+
+func (m *PostmarkMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	msg := newMessage(ctx, request)
+	if m.configuration.MailMode == configuration.MailModeLogOnly {
+		return m.logOnly(ctx, msg.Subject, msg.ReplyTo, msg.Text, msg.Attachments)
+	}
+	body, err := m.Render(ctx, request)
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(ctx, m.configuration.Postmark.BaseURL+"/email", "application/json", body)
+	if err != nil {
+		return err
+	}
+	// In sandbox mode, the test token has Postmark validate the email without delivering it.
+	token := m.configuration.Postmark.ServerToken
+	if m.configuration.MailMode == configuration.MailModeSandbox {
+		token = postmarkTestToken
+	}
+	req.Header.Set("X-Postmark-Server-Token", token)
+	return m.send(ctx, req)
+}
+
+// Render returns the Postmark request body for request.
+func (m *PostmarkMailer) Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error) {
+	if err := checkHeaders(request); err != nil {
+		return nil, err
+	}
+	msg := newMessage(ctx, request)
+	email := postmarkEmail{
+		From:          msg.From,
+		To:            msg.To,
+		ReplyTo:       msg.ReplyTo,
+		Subject:       msg.Subject,
+		TextBody:      msg.Text,
+		HtmlBody:      msg.HTML,
+		MessageStream: m.configuration.Postmark.MessageStream,
+		Headers:       []postmarkHeader{},
+		Metadata:      msg.metadata(),
+	}
+	headers := msg.headers()
+	for _, name := range sortedKeys(headers) {
+		email.Headers = append(email.Headers, postmarkHeader{Name: name, Value: headers[name]})
+	}
+	for _, file := range msg.Attachments {
+		attached := postmarkAttachment{Name: file.Filename, Content: file.Content, ContentType: file.ContentType}
+		if file.ContentID != "" {
+			attached.ContentID = "cid:" + file.ContentID
+		}
+		email.Attachments = append(email.Attachments, attached)
+	}
+	return json.Marshal(email)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,212 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/tracing"
+)
+
+// New returns the Mailer of the configured MailProvider.
+func New(cfg *configuration.ContactFormConfiguration, opts ...Option) (Mailer, error) {
+	switch cfg.MailProvider {
+	case configuration.MailProviderSendGrid:
+		return NewSendGridMailer(cfg, opts...), nil
+	case configuration.MailProviderMailgun:
+		return NewMailgunMailer(cfg, opts...), nil
+	case configuration.MailProviderPostmark:
+		return NewPostmarkMailer(cfg, opts...), nil
+	case configuration.MailProviderSES:
+		return NewSESMailer(cfg, opts...), nil
+	case configuration.MailProviderResend:
+		return NewResendMailer(cfg, opts...), nil
+	default:
+		return nil, fmt.Errorf("unknown mail provider %q", cfg.MailProvider)
+	}
+}
+
+// base holds what every Mailer calling a provider's HTTP API shares: the
+// options, and sending, measuring and logging a request.
+type base struct {
+	provider       string
+	configuration  *configuration.ContactFormConfiguration
+	logger         *slog.Logger
+	meter          metrics.Meter
+	tracerProvider trace.TracerProvider
+	httpClient     *http.Client
+	now            func() time.Time
+	// rejectsRecipient recognises the provider's invalid recipient responses.
+	rejectsRecipient func(statusCode int, body string) bool
+}
+
+func newBase(provider string, cfg *configuration.ContactFormConfiguration, rejectsRecipient func(int, string) bool,
+	opts []Option) base {
+	b := base{provider: provider, configuration: cfg, logger: logging.ForPolicy(cfg.LogPIIPolicy), meter: metrics.Noop{},
+		httpClient: defaultHTTPClient, now: time.Now, rejectsRecipient: rejectsRecipient}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	// The copy only wraps the transport with tracing. Its connections are still
+	// those of the shared transport.
+	traced := *b.httpClient
+	traced.Transport = tracing.Transport(b.httpClient.Transport, b.tracerProvider)
+	b.httpClient = &traced
+	return b
+}
+
+// send sends req, returning a ProviderError unless the provider accepts it with
+// a 2xx status. Errors are classified, eg. as ErrProviderRateLimited.
+func (b *base) send(ctx context.Context, req *http.Request) error {
+	start := time.Now()
+	res, err := b.httpClient.Do(req.WithContext(ctx))
+	var body []byte
+	if err == nil {
+		body, err = io.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	latency := time.Since(start)
+	statusCode := "error"
+	if err == nil {
+		statusCode = strconv.Itoa(res.StatusCode)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		tracing.AttrProvider.String(b.provider),
+		tracing.AttrProviderStatus.String(statusCode))
+	b.meter.ObserveHistogram(ctx, metrics.MailProviderLatency, latency.Seconds(), metrics.Labels{
+		metrics.LabelProvider:   b.provider,
+		metrics.LabelStatusCode: statusCode,
+	})
+	logAttrs := []any{
+		logging.KeyStage, logging.StageMail,
+		logging.KeyProvider, b.provider,
+		logging.KeyMailMode, b.configuration.MailMode,
+		logging.KeyLatency, latency.Milliseconds(),
+	}
+	if err != nil {
+		err = transportError(b.provider, err)
+		b.logger.ErrorContext(ctx, "error sending email",
+			append(logAttrs, logging.KeyOutcome, "error", logging.KeyError, err)...)
+		return err
+	}
+	logAttrs = append(logAttrs, logging.KeyStatusCode, res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		providerErr := &ProviderError{Provider: b.provider, StatusCode: res.StatusCode, Body: truncate(string(body), maxErrorBodyBytes),
+			Err: classify(res.StatusCode, string(body), b.rejectsRecipient)}
+		b.logger.ErrorContext(ctx, "email rejected by provider",
+			append(logAttrs, logging.KeyOutcome, "rejected", "response_body", providerErr.Body)...)
+		return providerErr
+	}
+	b.logger.InfoContext(ctx, "email accepted by provider", append(logAttrs, logging.KeyOutcome, "accepted")...)
+	return nil
+}
+
+// logOnly logs the message instead of sending it. Personal data is redacted
+// by the logger, as for every other log. Attachments are only counted.
+func (b *base) logOnly(ctx context.Context, subject, replyTo, body string, attachments []api.Attachment) error {
+	trace.SpanFromContext(ctx).SetAttributes(
+		tracing.AttrProvider.String(b.provider),
+		tracing.AttrProviderStatus.String(configuration.MailModeLogOnly))
+	b.logger.InfoContext(ctx, "email not sent, mail mode is log-only",
+		logging.KeyStage, logging.StageMail,
+		logging.KeyProvider, b.provider,
+		logging.KeyMailMode, configuration.MailModeLogOnly,
+		logging.KeyOutcome, "logged",
+		"subject", subject,
+		"reply_to", replyTo,
+		"body", body,
+		"attachments", len(attachments),
+		"attachments_bytes", attachment.TotalSize(attachments))
+	return nil
+}
+
+// newRequest returns a POST of body to url, with the given content type.
+func newRequest(ctx context.Context, url, contentType string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// message is the email sent for a request, by every provider other than
+// SendGrid. It matches the SendGrid plain-text email.
+type message struct {
+	From    string
+	To      string
+	ReplyTo string
+	Subject string
+	Text    string
+	// HTML is the HTML alternative showing the inline attachments, or "".
+	HTML         string
+	RequestID    string
+	SubmissionID string
+	// Attachments have sniffed content types, and sanitised filenames.
+	Attachments []api.Attachment
+}
+
+func newMessage(ctx context.Context, request *api.EmailFormRequest) message {
+	attachments := attachment.Prepare(request.Attachments)
+	return message{
+		From:         formatAddress(fmt.Sprintf("%s Contact Form", websiteUrl), contactEmailAddress),
+		To:           formatAddress("ippoippo Photography", contactEmailAddress),
+		ReplyTo:      formatAddress(request.Name, request.Email),
+		Subject:      fmt.Sprintf("Contact Message from %s", websiteUrl),
+		Text:         request.Message,
+		HTML:         htmlBody(request.Message, attachments),
+		RequestID:    requestid.FromContext(ctx),
+		SubmissionID: store.IDFromContext(ctx),
+		Attachments:  attachments,
+	}
+}
+
+// headers are the custom headers of the message.
+func (m message) headers() map[string]string {
+	if m.RequestID == "" {
+		return map[string]string{}
+	}
+	return map[string]string{requestid.Header: m.RequestID}
+}
+
+// metadata correlates provider events with the request and submission, as
+// SendGrid's custom_args do.
+func (m message) metadata() map[string]string {
+	metadata := map[string]string{}
+	if m.RequestID != "" {
+		metadata[customArgRequestID] = m.RequestID
+	}
+	if m.SubmissionID != "" {
+		metadata[customArgSubmissionID] = m.SubmissionID
+	}
+	return metadata
+}
+
+// formatAddress formats a name and address as a header value, quoting the name as needed.
+func formatAddress(name, address string) string {
+	return (&mail.Address{Name: name, Address: address}).String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,540 @@
+package mailer_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+const (
+	fromAddress    = `"https://ippoippophotography.com Contact Form" <contact@ippoippophotography.com>`
+	toAddress      = `"ippoippo Photography" <contact@ippoippophotography.com>`
+	replyToAddress = `"Gavin Thomas" <test@example.com>`
+)
+
+func TestProviderMailers(t *testing.T) {
+	type testSpec struct {
+		provider        string
+		expectedPath    string
+		expectedHeaders map[string]string
+		expectedBody    string
+	}
+
+	testSpecs := []testSpec{
+		{
+			provider:        configuration.MailProviderMailgun,
+			expectedPath:    "/v3/mg.example.com/messages",
+			expectedHeaders: map[string]string{"Authorization": "Basic YXBpOm1nLWtleQ==", "Content-Type": "application/x-www-form-urlencoded"},
+			expectedBody: "from=%22https%3A%2F%2Fippoippophotography.com+Contact+Form%22+%3Ccontact%40ippoippophotography.com%3E" +
+				"&h%3AReply-To=%22Gavin+Thomas%22+%3Ctest%40example.com%3E&h%3AX-Request-Id=req-123" +
+				"&subject=Contact+Message+from+https%3A%2F%2Fippoippophotography.com&text=This+is+a+test+message." +
+				"&to=%22ippoippo+Photography%22+%3Ccontact%40ippoippophotography.com%3E&v%3Arequest_id=req-123&v%3Asubmission_id=sub-456",
+		},
+		{
+			provider:        configuration.MailProviderPostmark,
+			expectedPath:    "/email",
+			expectedHeaders: map[string]string{"X-Postmark-Server-Token": "pm-token", "Content-Type": "application/json"},
+			expectedBody: `{"From":"` + jsonQuoted(fromAddress) + `","To":"` + jsonQuoted(toAddress) + `","ReplyTo":"` + jsonQuoted(replyToAddress) + `",` +
+				`"Subject":"Contact Message from https://ippoippophotography.com","TextBody":"This is a test message.","MessageStream":"outbound",` +
+				`"Headers":[{"Name":"X-Request-Id","Value":"req-123"}],"Metadata":{"request_id":"req-123","submission_id":"sub-456"}}`,
+		},
+		{
+			provider:     configuration.MailProviderSES,
+			expectedPath: "/v2/email/outbound-emails",
+			expectedHeaders: map[string]string{
+				"Authorization": "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/",
+				"Content-Type":  "application/json",
+				"X-Amz-Date":    "",
+			},
+			expectedBody: `{"FromEmailAddress":"` + jsonQuoted(fromAddress) + `","Destination":{"ToAddresses":["` + jsonQuoted(toAddress) + `"]},` +
+				`"ReplyToAddresses":["` + jsonQuoted(replyToAddress) + `"],"Content":{"Simple":{` +
+				`"Subject":{"Data":"Contact Message from https://ippoippophotography.com","Charset":"UTF-8"},` +
+				`"Body":{"Text":{"Data":"This is a test message.","Charset":"UTF-8"}},"Headers":[{"Name":"X-Request-Id","Value":"req-123"}]}},` +
+				`"EmailTags":[{"Name":"request_id","Value":"req-123"},{"Name":"submission_id","Value":"sub-456"}]}`,
+		},
+		{
+			provider:        configuration.MailProviderResend,
+			expectedPath:    "/emails",
+			expectedHeaders: map[string]string{"Authorization": "Bearer re-key", "Content-Type": "application/json"},
+			expectedBody: `{"from":"` + jsonQuoted(fromAddress) + `","to":["` + jsonQuoted(toAddress) + `"],"reply_to":"` + jsonQuoted(replyToAddress) + `",` +
+				`"subject":"Contact Message from https://ippoippophotography.com","text":"This is a test message.",` +
+				`"headers":{"X-Request-Id":"req-123"},"tags":[{"name":"request_id","value":"req-123"},{"name":"submission_id","value":"sub-456"}]}`,
+		},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusOK)
+			defer standIn.Close()
+
+			m, err := mailer.New(providerConfiguration(test.provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			if err != nil {
+				t.Fatalf("New() returned error [%v]", err)
+			}
+			if err := m.SendEmail(testContext(), testRequest()); err != nil {
+				t.Fatalf("SendEmail() returned error [%v]", err)
+			}
+
+			if standIn.request.URL.Path != test.expectedPath {
+				t.Errorf("path actual[%s], does not match expected[%s]", standIn.request.URL.Path, test.expectedPath)
+			}
+			for name, expected := range test.expectedHeaders {
+				if actual := standIn.request.Header.Get(name); !strings.HasPrefix(actual, expected) || actual == "" {
+					t.Errorf("%s header actual[%s], SHOULD start with [%s]", name, actual, expected)
+				}
+			}
+			if standIn.body != test.expectedBody {
+				t.Errorf("body actual[%s], does not match expected[%s]", standIn.body, test.expectedBody)
+			}
+		})
+	}
+}
+
+func TestProviderMailersSanitizeTags(t *testing.T) {
+	type testSpec struct {
+		provider     string
+		expectedBody string
+	}
+
+	testSpecs := []testSpec{
+		{provider: configuration.MailProviderSES, expectedBody: `"EmailTags":[{"Name":"request_id","Value":"req.123_a"}`},
+		{provider: configuration.MailProviderResend, expectedBody: `"tags":[{"name":"request_id","value":"req_123_a"}`},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusOK)
+			defer standIn.Close()
+
+			m, err := mailer.New(providerConfiguration(test.provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			if err != nil {
+				t.Fatalf("New() returned error [%v]", err)
+			}
+			ctx := store.NewContext(requestid.NewContext(context.Background(), "req.123:a"), "sub-456")
+			if err := m.SendEmail(ctx, testRequest()); err != nil {
+				t.Fatalf("SendEmail() returned error [%v]", err)
+			}
+			if !strings.Contains(standIn.body, test.expectedBody) {
+				t.Errorf("body actual[%s], SHOULD contain [%s]", standIn.body, test.expectedBody)
+			}
+		})
+	}
+}
+
+func TestProviderMailersSendAttachments(t *testing.T) {
+	content := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	encoded := base64.StdEncoding.EncodeToString(content)
+	type testSpec struct {
+		provider     string
+		expectedBody string
+	}
+
+	testSpecs := []testSpec{
+		{
+			provider:     configuration.MailProviderSendGrid,
+			expectedBody: `"attachments":[{"content":"` + encoded + `","type":"image/jpeg","filename":"venue.jpg","disposition":"attachment"}]`,
+		},
+		{
+			provider:     configuration.MailProviderPostmark,
+			expectedBody: `"Attachments":[{"Name":"venue.jpg","Content":"` + encoded + `","ContentType":"image/jpeg"}]`,
+		},
+		{
+			provider: configuration.MailProviderSES,
+			expectedBody: `"Attachments":[{"FileName":"venue.jpg","RawContent":"` + encoded + `","ContentType":"image/jpeg",` +
+				`"ContentDisposition":"ATTACHMENT"}]`,
+		},
+		{
+			provider:     configuration.MailProviderResend,
+			expectedBody: `"attachments":[{"filename":"venue.jpg","content":"` + encoded + `","content_type":"image/jpeg"}]`,
+		},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusOK)
+			defer standIn.Close()
+
+			m, err := mailer.New(providerConfiguration(test.provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			if err != nil {
+				t.Fatalf("New() returned error [%v]", err)
+			}
+			request := testRequest()
+			request.Attachments = []api.Attachment{{Filename: "../venue", ContentType: "application/pdf", Content: content}}
+			if err := m.SendEmail(testContext(), request); err != nil {
+				t.Fatalf("SendEmail() returned error [%v]", err)
+			}
+			if !strings.Contains(standIn.body, test.expectedBody) {
+				t.Errorf("body actual[%s], SHOULD contain [%s]", standIn.body, test.expectedBody)
+			}
+		})
+	}
+}
+
+func TestProviderMailersSendInlineThumbnails(t *testing.T) {
+	type testSpec struct {
+		provider       string
+		expectedBodies []string
+	}
+
+	testSpecs := []testSpec{
+		{
+			provider: configuration.MailProviderSendGrid,
+			expectedBodies: []string{`"type":"text/html"`, `\u003cimg src=\"cid:thumbnail-1-venue.jpg\"`,
+				`"filename":"thumbnail-1-venue.jpg","disposition":"inline","content_id":"thumbnail-1-venue.jpg"`},
+		},
+		{
+			provider: configuration.MailProviderMailgun,
+			expectedBodies: []string{`name="html"`, `<img src="cid:thumbnail-1-venue.jpg"`,
+				"filename=thumbnail-1-venue.jpg; name=inline", "filename=venue.jpg; name=attachment"},
+		},
+		{
+			provider:       configuration.MailProviderPostmark,
+			expectedBodies: []string{`"HtmlBody":"`, `"Name":"thumbnail-1-venue.jpg"`, `"ContentID":"cid:thumbnail-1-venue.jpg"`},
+		},
+		{
+			provider: configuration.MailProviderSES,
+			expectedBodies: []string{`"Html":{"Data":"`,
+				`"ContentDisposition":"INLINE","ContentId":"thumbnail-1-venue.jpg"`, `"ContentDisposition":"ATTACHMENT"}`},
+		},
+		{
+			provider:       configuration.MailProviderResend,
+			expectedBodies: []string{`"html":"`, `"content_id":"thumbnail-1-venue.jpg"`},
+		},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusOK)
+			defer standIn.Close()
+
+			m, err := mailer.New(providerConfiguration(test.provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			if err != nil {
+				t.Fatalf("New() returned error [%v]", err)
+			}
+			request := testRequest()
+			request.Message = "<b>Hello</b>"
+			request.Attachments = []api.Attachment{
+				{Filename: "venue.jpg", Content: []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")},
+				{Filename: "thumbnail-1-venue.jpg", Content: []byte("\xff\xd8\xff\xdb"), ContentID: "thumbnail-1-venue.jpg"},
+			}
+			if err := m.SendEmail(testContext(), request); err != nil {
+				t.Fatalf("SendEmail() returned error [%v]", err)
+			}
+			for _, expected := range test.expectedBodies {
+				if !strings.Contains(standIn.body, expected) {
+					t.Errorf("body actual[%s], SHOULD contain [%s]", standIn.body, expected)
+				}
+			}
+			if !strings.Contains(standIn.body, "&lt;b&gt;Hello") && !strings.Contains(standIn.body, `\u0026lt;b\u0026gt;Hello`) {
+				t.Errorf("body actual[%s], SHOULD escape the message in HTML", standIn.body)
+			}
+		})
+	}
+}
+
+func TestMailgunMailerSendsAttachmentsAsMultipart(t *testing.T) {
+	standIn := newStandIn(http.StatusOK)
+	defer standIn.Close()
+	content := []byte("%PDF-1.7\n")
+
+	m := mailer.NewMailgunMailer(providerConfiguration(configuration.MailProviderMailgun, standIn.URL), mailer.WithLogger(logging.Discard()))
+	request := testRequest()
+	request.Attachments = []api.Attachment{{Filename: "brief", Content: content}}
+	if err := m.SendEmail(testContext(), request); err != nil {
+		t.Fatalf("SendEmail() returned error [%v]", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(standIn.request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		t.Fatalf("Content-Type actual[%s], does not match expected[multipart/form-data]", standIn.request.Header.Get("Content-Type"))
+	}
+	form, err := multipart.NewReader(strings.NewReader(standIn.body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("ReadForm() returned error [%v]", err)
+	}
+	if actual := form.Value["text"]; len(actual) != 1 || actual[0] != request.Message {
+		t.Errorf("text actual[%v], does not match expected[%s]", actual, request.Message)
+	}
+	if actual := form.Value["v:submission_id"]; len(actual) != 1 || actual[0] != "sub-456" {
+		t.Errorf("v:submission_id actual[%v], does not match expected[sub-456]", actual)
+	}
+	files := form.File["attachment"]
+	if len(files) != 1 {
+		t.Fatalf("attachment parts actual[%d], does not match expected[1]", len(files))
+	}
+	if files[0].Filename != "brief.pdf" || files[0].Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("attachment actual[%s, %s], does not match expected[brief.pdf, application/pdf]",
+			files[0].Filename, files[0].Header.Get("Content-Type"))
+	}
+	file, _ := files[0].Open()
+	defer file.Close()
+	if actual, _ := io.ReadAll(file); string(actual) != string(content) {
+		t.Errorf("attachment content actual[%q], does not match expected[%q]", actual, content)
+	}
+}
+
+func TestProviderMailersReturnProviderErrors(t *testing.T) {
+	for _, provider := range configuration.MailProviders {
+		t.Run(provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusUnprocessableEntity)
+			defer standIn.Close()
+
+			m, err := mailer.New(providerConfiguration(provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			if err != nil {
+				t.Fatalf("New() returned error [%v]", err)
+			}
+			err = m.SendEmail(testContext(), testRequest())
+			var providerErr *mailer.ProviderError
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("SendEmail() actual[%v], SHOULD be a *mailer.ProviderError", err)
+			}
+			expected := mailer.ProviderError{Provider: provider, StatusCode: http.StatusUnprocessableEntity, Body: `{"message":"rejected"}`}
+			if *providerErr != expected {
+				t.Errorf("ProviderError actual[%+v], does not match expected[%+v]", *providerErr, expected)
+			}
+		})
+	}
+}
+
+func TestProviderErrorsAreClassified(t *testing.T) {
+	type testSpec struct {
+		provider          string
+		statusCode        int
+		responseBody      string
+		expectedErr       error
+		expectedRetryable bool
+	}
+
+	testSpecs := []testSpec{
+		{provider: "sendgrid", statusCode: 401, responseBody: `{"errors":[{"message":"authorization required"}]}`, expectedErr: mailer.ErrProviderAuth},
+		{provider: "postmark", statusCode: 403, expectedErr: mailer.ErrProviderAuth},
+		{provider: "mailgun", statusCode: 429, expectedErr: mailer.ErrProviderRateLimited, expectedRetryable: true},
+		{provider: "resend", statusCode: 500, expectedErr: mailer.ErrProviderUnavailable, expectedRetryable: true},
+		{provider: "ses", statusCode: 503, expectedErr: mailer.ErrProviderUnavailable, expectedRetryable: true},
+		{provider: "sendgrid", statusCode: 504, expectedErr: mailer.ErrProviderTimeout, expectedRetryable: true},
+		{
+			provider:     "sendgrid",
+			statusCode:   400,
+			responseBody: `{"errors":[{"message":"Does not contain a valid address.","field":"reply_to.email"}]}`,
+			expectedErr:  mailer.ErrInvalidRecipient,
+		},
+		{provider: "sendgrid", statusCode: 400, responseBody: `{"errors":[{"message":"The subject is required.","field":"subject"}]}`},
+		{provider: "postmark", statusCode: 422, responseBody: `{"ErrorCode":406,"Message":"You tried to send to recipient(s) that have been marked as inactive."}`,
+			expectedErr: mailer.ErrInvalidRecipient},
+		{provider: "postmark", statusCode: 422, responseBody: `{"ErrorCode":300,"Message":"Invalid 'ReplyTo' address: 'nope'."}`,
+			expectedErr: mailer.ErrInvalidRecipient},
+		{provider: "mailgun", statusCode: 400, responseBody: `{"message":"to parameter is not a valid address. please check documentation"}`,
+			expectedErr: mailer.ErrInvalidRecipient},
+		{provider: "ses", statusCode: 400, responseBody: `{"message":"Email address is not verified."}`, expectedErr: mailer.ErrInvalidRecipient},
+		{provider: "resend", statusCode: 422, responseBody: `{"name":"validation_error","message":"Invalid ` + "`to`" + ` field. The email address needs to follow the ` + "`email@example.com`" + ` format."}`,
+			expectedErr: mailer.ErrInvalidRecipient},
+		{provider: "resend", statusCode: 422, responseBody: `{"name":"validation_error","message":"Missing ` + "`subject`" + ` field."}`},
+	}
+
+	classes := []error{mailer.ErrProviderAuth, mailer.ErrProviderRateLimited, mailer.ErrProviderUnavailable, mailer.ErrProviderTimeout,
+		mailer.ErrInvalidRecipient}
+	for _, test := range testSpecs {
+		t.Run(fmt.Sprintf("%s %d %s", test.provider, test.statusCode, test.responseBody), func(t *testing.T) {
+			standIn := newStandInResponding(test.statusCode, test.responseBody)
+			defer standIn.Close()
+
+			m, _ := mailer.New(providerConfiguration(test.provider, standIn.URL), mailer.WithLogger(logging.Discard()))
+			err := m.SendEmail(testContext(), testRequest())
+			var providerErr *mailer.ProviderError
+			if !errors.As(err, &providerErr) || providerErr.StatusCode != test.statusCode {
+				t.Fatalf("SendEmail() actual[%v], SHOULD be a *mailer.ProviderError with status %d", err, test.statusCode)
+			}
+			for _, class := range classes {
+				if actual, expected := errors.Is(err, class), class == test.expectedErr; actual != expected {
+					t.Errorf("errors.Is(%v) actual[%v], does not match expected[%v]", class, actual, expected)
+				}
+			}
+			if actual := mailer.Retryable(err); actual != test.expectedRetryable {
+				t.Errorf("Retryable() actual[%v], does not match expected[%v]", actual, test.expectedRetryable)
+			}
+		})
+	}
+}
+
+func TestTransportErrorsAreClassified(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	type testSpec struct {
+		name        string
+		baseURL     string
+		expectedErr error
+	}
+
+	testSpecs := []testSpec{
+		{name: "timeout", baseURL: slow.URL, expectedErr: mailer.ErrProviderTimeout},
+		{name: "connection refused", baseURL: closed.URL, expectedErr: mailer.ErrProviderUnavailable},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			m, _ := mailer.New(providerConfiguration(configuration.MailProviderResend, test.baseURL), mailer.WithLogger(logging.Discard()),
+				mailer.WithHTTPClient(&http.Client{Timeout: 50 * time.Millisecond}))
+			err := m.SendEmail(testContext(), testRequest())
+			if !errors.Is(err, test.expectedErr) {
+				t.Errorf("SendEmail() actual[%v], SHOULD wrap [%v]", err, test.expectedErr)
+			}
+			if !mailer.Retryable(err) {
+				t.Errorf("Retryable(%v) SHOULD be true", err)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	if !mailer.Retryable(errors.New("unknown")) {
+		t.Errorf("Retryable() of an unclassified error SHOULD be true")
+	}
+	if mailer.Retryable(&mailer.ProviderError{Provider: "sendgrid", StatusCode: 400}) {
+		t.Errorf("Retryable() of an unclassified rejection SHOULD be false")
+	}
+	if mailer.Retryable(fmt.Errorf("sending: %w", &mailer.ProviderError{StatusCode: 401, Err: mailer.ErrProviderAuth})) {
+		t.Errorf("Retryable() of a wrapped ErrProviderAuth SHOULD be false")
+	}
+	if mailer.Retryable(fmt.Errorf("%w: name", mailer.ErrHeaderInjection)) {
+		t.Errorf("Retryable() of ErrHeaderInjection SHOULD be false")
+	}
+}
+
+func TestProviderMailersSandbox(t *testing.T) {
+	type testSpec struct {
+		provider string
+		expected string
+	}
+
+	testSpecs := []testSpec{
+		{provider: configuration.MailProviderSendGrid, expected: `"sandbox_mode":{"enable":true}`},
+		{provider: configuration.MailProviderMailgun, expected: "o%3Atestmode=yes"},
+		{provider: configuration.MailProviderPostmark, expected: "POSTMARK_API_TEST"},
+		{provider: configuration.MailProviderSES, expected: `"ToAddresses":["success@simulator.amazonses.com"]`},
+		{provider: configuration.MailProviderResend, expected: `"to":["delivered@resend.dev"]`},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.provider, func(t *testing.T) {
+			standIn := newStandIn(http.StatusOK)
+			defer standIn.Close()
+
+			cfg := providerConfiguration(test.provider, standIn.URL)
+			cfg.MailMode = configuration.MailModeSandbox
+			m, _ := mailer.New(cfg, mailer.WithLogger(logging.Discard()))
+			if err := m.SendEmail(testContext(), testRequest()); err != nil {
+				t.Fatalf("SendEmail() returned error [%v]", err)
+			}
+			sent := standIn.body + " " + standIn.request.Header.Get("X-Postmark-Server-Token")
+			if !strings.Contains(sent, test.expected) {
+				t.Errorf("sandbox request actual[%s], SHOULD contain [%s]", sent, test.expected)
+			}
+		})
+	}
+}
+
+func TestNewSelectsProvider(t *testing.T) {
+	expectedTypes := map[string]string{
+		configuration.MailProviderSendGrid: "*mailer.SendGridMailer",
+		configuration.MailProviderMailgun:  "*mailer.MailgunMailer",
+		configuration.MailProviderPostmark: "*mailer.PostmarkMailer",
+		configuration.MailProviderSES:      "*mailer.SESMailer",
+		configuration.MailProviderResend:   "*mailer.ResendMailer",
+	}
+	for provider, expected := range expectedTypes {
+		m, err := mailer.New(&configuration.ContactFormConfiguration{MailProvider: provider})
+		if err != nil {
+			t.Fatalf("New(%s) returned error [%v]", provider, err)
+		}
+		if actual := fmt.Sprintf("%T", m); actual != expected {
+			t.Errorf("New(%s) actual[%s], does not match expected[%s]", provider, actual, expected)
+		}
+		if _, ok := m.(mailer.Renderer); !ok {
+			t.Errorf("New(%s) SHOULD return a mailer.Renderer", provider)
+		}
+	}
+	if _, err := mailer.New(&configuration.ContactFormConfiguration{MailProvider: "carrier-pigeon"}); err == nil {
+		t.Errorf("New(carrier-pigeon) SHOULD return an error")
+	}
+}
+
+// Support functions
+
+type standIn struct {
+	*httptest.Server
+	request *http.Request
+	body    string
+}
+
+// newStandIn returns a local server standing in for a provider's API, responding with statusCode.
+func newStandIn(statusCode int) *standIn {
+	responseBody := ""
+	if statusCode >= 400 {
+		responseBody = `{"message":"rejected"}`
+	}
+	return newStandInResponding(statusCode, responseBody)
+}
+
+// newStandInResponding returns a stand-in responding with statusCode and responseBody.
+func newStandInResponding(statusCode int, responseBody string) *standIn {
+	s := &standIn{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.request, s.body = r, string(body)
+		w.WriteHeader(statusCode)
+		fmt.Fprint(w, responseBody)
+	}))
+	return s
+}
+
+func providerConfiguration(provider, baseURL string) *configuration.ContactFormConfiguration {
+	return &configuration.ContactFormConfiguration{
+		MailProvider:    provider,
+		MailMode:        configuration.MailModeOff,
+		SendGridApiKey:  "sg-key",
+		SendGridBaseURL: baseURL,
+		Mailgun:         configuration.MailgunConfiguration{APIKey: "mg-key", Domain: "mg.example.com", BaseURL: baseURL},
+		Postmark:        configuration.PostmarkConfiguration{ServerToken: "pm-token", MessageStream: "outbound", BaseURL: baseURL},
+		SES: configuration.SESConfiguration{Region: "eu-west-1", AccessKeyID: "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", BaseURL: baseURL},
+		Resend: configuration.ResendConfiguration{APIKey: "re-key", BaseURL: baseURL},
+	}
+}
+
+func testContext() context.Context {
+	return store.NewContext(requestid.NewContext(context.Background(), "req-123"), "sub-456")
+}
+
+func testRequest() *api.EmailFormRequest {
+	return &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+}
+
+// jsonQuoted escapes an address as encoding/json does, without the surrounding quotes.
+func jsonQuoted(address string) string {
+	quoted, _ := json.Marshal(address)
+	return string(quoted[1 : len(quoted)-1])
+}
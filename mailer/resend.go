@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+const (
+	resendProvider = "resend"
+	// resendTestAddress is Resend's test recipient, simulating a delivery.
+	resendTestAddress = "delivered@resend.dev"
+)
+
+// ResendMailer sends through the Resend emails API.
+type ResendMailer struct {
+	base
+}
+
+func NewResendMailer(cfg *configuration.ContactFormConfiguration, opts ...Option) *ResendMailer {
+	return &ResendMailer{base: newBase(resendProvider, cfg, mentionsAddress(http.StatusUnprocessableEntity), opts)}
+}
+
+// resendTagInvalid matches the characters not allowed in Resend tags, such as
+// the '.' and ':' a client's X-Request-Id may have.
+var resendTagInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+type resendTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// resendAttachment has its content base64 encoded, as []byte is in JSON.
+type resendAttachment struct {
+	Filename    string `json:"filename"`
+	Content     []byte `json:"content"`
+	ContentType string `json:"content_type"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+type resendEmail struct {
+	From        string             `json:"from"`
+	To          []string           `json:"to"`
+	ReplyTo     string             `json:"reply_to"`
+	Subject     string             `json:"subject"`
+	Text        string             `json:"text"`
+	HTML        string             `json:"html,omitempty"`
+	Headers     map[string]string  `json:"headers"`
+	Tags        []resendTag        `json:"tags"`
+	Attachments []resendAttachment `json:"attachments,omitempty"`
+}
+
+func (m *ResendMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	msg := newMessage(ctx, request)
+	if m.configuration.MailMode == configuration.MailModeLogOnly {
+		return m.logOnly(ctx, msg.Subject, msg.ReplyTo, msg.Text, msg.Attachments)
+	}
+	body, err := m.Render(ctx, request)
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(ctx, m.configuration.Resend.BaseURL+"/emails", "application/json", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.configuration.Resend.APIKey)
+	return m.send(ctx, req)
+}
+
+// Render returns the Resend request body for request. Metadata is sent as tags,
+// returned in Resend's webhook events. In sandbox mode, the email is sent to
+// Resend's test address instead.
+func (m *ResendMailer) Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error) {
+	if err := checkHeaders(request); err != nil {
+		return nil, err
+	}
+	msg := newMessage(ctx, request)
+	to := msg.To
+	if m.configuration.MailMode == configuration.MailModeSandbox {
+		to = resendTestAddress
+	}
+	email := resendEmail{
+		From:    msg.From,
+		To:      []string{to},
+		ReplyTo: msg.ReplyTo,
+		Subject: msg.Subject,
+		Text:    msg.Text,
+		HTML:    msg.HTML,
+		Headers: msg.headers(),
+		Tags:    []resendTag{},
+	}
+	metadata := msg.metadata()
+	for _, name := range sortedKeys(metadata) {
+		email.Tags = append(email.Tags, resendTag{Name: name, Value: resendTagInvalid.ReplaceAllString(metadata[name], "_")})
+	}
+	for _, file := range msg.Attachments {
+		email.Attachments = append(email.Attachments, resendAttachment{Filename: file.Filename, Content: file.Content,
+			ContentType: file.ContentType, ContentID: file.ContentID})
+	}
+	return json.Marshal(email)
+}
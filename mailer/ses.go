@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+const (
+	sesProvider = "ses"
+	// sesSimulatorAddress is the SES mailbox simulator, accepting the email without delivering it.
+	sesSimulatorAddress = "success@simulator.amazonses.com"
+)
+
+// sesTagInvalid matches the characters not allowed in SES email tags.
+var sesTagInvalid = regexp.MustCompile(`[^A-Za-z0-9_.@-]`)
+
+// SESMailer sends through the Amazon SES v2 API, signing requests with SigV4.
+type SESMailer struct {
+	base
+}
+
+func NewSESMailer(cfg *configuration.ContactFormConfiguration, opts ...Option) *SESMailer {
+	return &SESMailer{base: newBase(sesProvider, cfg, mentionsAddress(http.StatusBadRequest), opts)}
+}
+
+type sesContent struct {
+	Data    string
+	Charset string
+}
+
+type sesNameValue struct {
+	Name  string
+	Value string
+}
+
+// sesAttachment has its raw content base64 encoded, as []byte is in JSON.
+type sesAttachment struct {
+	FileName           string
+	RawContent         []byte
+	ContentType        string
+	ContentDisposition string
+	ContentId          string `json:",omitempty"`
+}
+
+type sesEmail struct {
+	FromEmailAddress string
+	Destination      struct {
+		ToAddresses []string
+	}
+	ReplyToAddresses []string
+	Content          struct {
+		Simple struct {
+			Subject sesContent
+			Body    struct {
+				Text sesContent
+				Html *sesContent `json:",omitempty"`
+			}
+			Headers     []sesNameValue
+			Attachments []sesAttachment `json:",omitempty"`
+		}
+	}
+	EmailTags            []sesNameValue
+	ConfigurationSetName string `json:",omitempty"`
+}
+
+func (m *SESMailer) SendEmail(ctx context.Context, request *api.EmailFormRequest) error {
+	if err := checkHeaders(request); err != nil {
+		return err
+	}
+	msg := newMessage(ctx, request)
+	if m.configuration.MailMode == configuration.MailModeLogOnly {
+		return m.logOnly(ctx, msg.Subject, msg.ReplyTo, msg.Text, msg.Attachments)
+	}
+	body, err := m.Render(ctx, request)
+	if err != nil {
+		return err
+	}
+	req, err := newRequest(ctx, m.configuration.SES.BaseURL+"/v2/email/outbound-emails", "application/json", body)
+	if err != nil {
+		return err
+	}
+	signV4(req, body, awsCredentials{
+		AccessKeyID:     m.configuration.SES.AccessKeyID,
+		SecretAccessKey: m.configuration.SES.SecretAccessKey,
+		SessionToken:    m.configuration.SES.SessionToken,
+	}, m.configuration.SES.Region, "ses", m.now())
+	return m.send(ctx, req)
+}
+
+// Render returns the SES request body for request. Metadata is sent as email
+// tags, returned in SES event publishing. In sandbox mode, the email is sent to
+// the SES mailbox simulator instead.
+func (m *SESMailer) Render(ctx context.Context, request *api.EmailFormRequest) ([]byte, error) {
+	if err := checkHeaders(request); err != nil {
+		return nil, err
+	}
+	msg := newMessage(ctx, request)
+	var email sesEmail
+	email.FromEmailAddress = msg.From
+	email.Destination.ToAddresses = []string{msg.To}
+	if m.configuration.MailMode == configuration.MailModeSandbox {
+		email.Destination.ToAddresses = []string{sesSimulatorAddress}
+	}
+	email.ReplyToAddresses = []string{msg.ReplyTo}
+	email.Content.Simple.Subject = sesContent{Data: msg.Subject, Charset: "UTF-8"}
+	email.Content.Simple.Body.Text = sesContent{Data: msg.Text, Charset: "UTF-8"}
+	if msg.HTML != "" {
+		email.Content.Simple.Body.Html = &sesContent{Data: msg.HTML, Charset: "UTF-8"}
+	}
+	email.Content.Simple.Headers = []sesNameValue{}
+	headers := msg.headers()
+	for _, name := range sortedKeys(headers) {
+		email.Content.Simple.Headers = append(email.Content.Simple.Headers, sesNameValue{Name: name, Value: headers[name]})
+	}
+	for _, file := range msg.Attachments {
+		attached := sesAttachment{FileName: file.Filename, RawContent: file.Content, ContentType: file.ContentType,
+			ContentDisposition: "ATTACHMENT"}
+		if file.ContentID != "" {
+			attached.ContentDisposition, attached.ContentId = "INLINE", file.ContentID
+		}
+		email.Content.Simple.Attachments = append(email.Content.Simple.Attachments, attached)
+	}
+	email.EmailTags = []sesNameValue{}
+	metadata := msg.metadata()
+	for _, name := range sortedKeys(metadata) {
+		email.EmailTags = append(email.EmailTags, sesNameValue{Name: name, Value: sesTagInvalid.ReplaceAllString(metadata[name], "_")})
+	}
+	email.ConfigurationSetName = m.configuration.SES.ConfigurationSet
+	return json.Marshal(email)
+}
@@ -0,0 +1,68 @@
+package mailer
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestSignV4 checks signatures against examples from the AWS documentation and
+// the AWS Signature Version 4 test suite.
+func TestSignV4(t *testing.T) {
+	type testSpec struct {
+		name         string
+		url          string
+		contentType  string
+		region       string
+		service      string
+		expectedAuth string
+	}
+
+	credentials := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	testSpecs := []testSpec{
+		{
+			name:    "get-vanilla",
+			url:     "https://example.amazonaws.com/",
+			region:  "us-east-1",
+			service: "service",
+			expectedAuth: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:        "iam list users",
+			url:         "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			contentType: "application/x-www-form-urlencoded; charset=utf-8",
+			region:      "us-east-1",
+			service:     "iam",
+			expectedAuth: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, test := range testSpecs {
+		req, err := http.NewRequest(http.MethodGet, test.url, nil)
+		if err != nil {
+			t.Fatalf("NewRequest() returned error [%v]", err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		signV4(req, nil, credentials, test.region, test.service, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+		if actual := req.Header.Get("Authorization"); actual != test.expectedAuth {
+			t.Errorf("%s: Authorization actual[%s], does not match expected[%s]", test.name, actual, test.expectedAuth)
+		}
+	}
+}
+
+func TestSignV4SessionToken(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://email.eu-west-1.amazonaws.com/v2/email/outbound-emails", nil)
+	signV4(req, []byte("{}"), awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"},
+		"eu-west-1", "ses", time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC))
+	if actual := req.Header.Get("X-Amz-Security-Token"); actual != "token" {
+		t.Errorf("X-Amz-Security-Token actual[%s], does not match expected[token]", actual)
+	}
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20240501/eu-west-1/ses/aws4_request, SignedHeaders=host;x-amz-date;x-amz-security-token, "
+	if actual := req.Header.Get("Authorization"); len(actual) < len(expected) || actual[:len(expected)] != expected {
+		t.Errorf("Authorization actual[%s], SHOULD start with [%s]", actual, expected)
+	}
+}
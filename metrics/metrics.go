@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Metric names.
+const (
+	SubmissionsTotal        = "contact_submissions_total"
+	ValidationFailuresTotal = "contact_validation_failures_total"
+	MailProviderLatency     = "contact_mail_provider_latency_seconds"
+	MailEventsTotal         = "contact_mail_events_total"
+	// MailBreakerState is 0 while the mail circuit breaker is closed, 1 while
+	// it is half-open, and 2 while it is open.
+	MailBreakerState = "contact_mail_breaker_state"
+	// MailBreakerRejectionsTotal counts emails failed fast by an open breaker.
+	MailBreakerRejectionsTotal = "contact_mail_breaker_rejections_total"
+	// AttachmentScansTotal counts the attachments scanned for malware, by
+	// outcome: clean, infected or error.
+	AttachmentScansTotal = "contact_attachment_scans_total"
+)
+
+// Label names.
+const (
+	LabelOutcome    = "outcome"
+	LabelField      = "field"
+	LabelProvider   = "provider"
+	LabelStatusCode = "status_code"
+	LabelEvent      = "event"
+)
+
+// Labels are the dimensions of a single series.
+type Labels map[string]string
+
+// Meter records metrics. Implementations must be safe for concurrent use.
+type Meter interface {
+	IncCounter(ctx context.Context, name string, labels Labels)
+	ObserveHistogram(ctx context.Context, name string, value float64, labels Labels)
+	SetGauge(ctx context.Context, name string, value float64, labels Labels)
+}
+
+// Noop discards every measurement. It is the default Meter.
+type Noop struct{}
+
+func (Noop) IncCounter(_ context.Context, _ string, _ Labels) {}
+
+func (Noop) ObserveHistogram(_ context.Context, _ string, _ float64, _ Labels) {}
+
+func (Noop) SetGauge(_ context.Context, _ string, _ float64, _ Labels) {}
+
+// seriesKey identifies a series by name and sorted labels, eg. name{a="1",b="2"}.
+func seriesKey(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+`="`+escapeLabelValue(labels[key])+`"`)
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// OTelMeter records through an OpenTelemetry meter, so any OTel exporter can be used.
+type OTelMeter struct {
+	meter      metric.Meter
+	mu         sync.Mutex
+	counters   map[string]metric.Float64Counter
+	histograms map[string]metric.Float64Histogram
+	gauges     map[string]metric.Float64Gauge
+}
+
+func NewOTelMeter(meter metric.Meter) *OTelMeter {
+	return &OTelMeter{
+		meter:      meter,
+		counters:   make(map[string]metric.Float64Counter),
+		histograms: make(map[string]metric.Float64Histogram),
+		gauges:     make(map[string]metric.Float64Gauge),
+	}
+}
+
+func (m *OTelMeter) IncCounter(ctx context.Context, name string, labels Labels) {
+	m.mu.Lock()
+	c, ok := m.counters[name]
+	if !ok {
+		var err error
+		if c, err = m.meter.Float64Counter(name); err != nil {
+			m.mu.Unlock()
+			return
+		}
+		m.counters[name] = c
+	}
+	m.mu.Unlock()
+	c.Add(ctx, 1, metric.WithAttributes(toAttributes(labels)...))
+}
+
+func (m *OTelMeter) ObserveHistogram(ctx context.Context, name string, value float64, labels Labels) {
+	m.mu.Lock()
+	h, ok := m.histograms[name]
+	if !ok {
+		var err error
+		if h, err = m.meter.Float64Histogram(name, metric.WithUnit("s")); err != nil {
+			m.mu.Unlock()
+			return
+		}
+		m.histograms[name] = h
+	}
+	m.mu.Unlock()
+	h.Record(ctx, value, metric.WithAttributes(toAttributes(labels)...))
+}
+
+func (m *OTelMeter) SetGauge(ctx context.Context, name string, value float64, labels Labels) {
+	m.mu.Lock()
+	g, ok := m.gauges[name]
+	if !ok {
+		var err error
+		if g, err = m.meter.Float64Gauge(name); err != nil {
+			m.mu.Unlock()
+			return
+		}
+		m.gauges[name] = g
+	}
+	m.mu.Unlock()
+	g.Record(ctx, value, metric.WithAttributes(toAttributes(labels)...))
+}
+
+func toAttributes(labels Labels) []attribute.KeyValue {
+	attributes := make([]attribute.KeyValue, 0, len(labels))
+	for key, value := range labels {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attributes
+}
@@ -0,0 +1,38 @@
+package metrics_test
+
+import (
+	"context"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+)
+
+func TestOTelMeterExportsThroughReader(t *testing.T) {
+	ctx := context.Background()
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	meter := metrics.NewOTelMeter(provider.Meter("contact"))
+
+	meter.IncCounter(ctx, metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "success"})
+	meter.ObserveHistogram(ctx, metrics.MailProviderLatency, 0.2, metrics.Labels{metrics.LabelProvider: "sendgrid"})
+	meter.SetGauge(ctx, metrics.MailBreakerState, 2, metrics.Labels{metrics.LabelProvider: "sendgrid"})
+
+	var collected metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &collected); err != nil {
+		t.Fatalf("Collect() returned error [%v]", err)
+	}
+	names := make(map[string]bool)
+	for _, scope := range collected.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			names[m.Name] = true
+		}
+	}
+	for _, name := range []string{metrics.SubmissionsTotal, metrics.MailProviderLatency, metrics.MailBreakerState} {
+		if !names[name] {
+			t.Errorf("metric [%s] SHOULD be exported", name)
+		}
+	}
+}
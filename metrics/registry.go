@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram upper bounds, in seconds.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry is an in-memory Meter. It can be read directly in tests, or
+// exposed in the Prometheus text format.
+type Registry struct {
+	mu         sync.Mutex
+	buckets    []float64
+	counters   map[string]*counter
+	histograms map[string]*histogram
+	gauges     map[string]*gauge
+}
+
+type counter struct {
+	name   string
+	labels Labels
+	value  float64
+}
+
+type gauge struct {
+	name   string
+	labels Labels
+	value  float64
+}
+
+type histogram struct {
+	name   string
+	labels Labels
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets:    DefaultBuckets,
+		counters:   make(map[string]*counter),
+		histograms: make(map[string]*histogram),
+		gauges:     make(map[string]*gauge),
+	}
+}
+
+func (r *Registry) IncCounter(_ context.Context, name string, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey(name, labels)
+	c, ok := r.counters[key]
+	if !ok {
+		c = &counter{name: name, labels: copyLabels(labels)}
+		r.counters[key] = c
+	}
+	c.value++
+}
+
+func (r *Registry) ObserveHistogram(_ context.Context, name string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey(name, labels)
+	h, ok := r.histograms[key]
+	if !ok {
+		h = &histogram{name: name, labels: copyLabels(labels), counts: make([]uint64, len(r.buckets))}
+		r.histograms[key] = h
+	}
+	for i, bound := range r.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (r *Registry) SetGauge(_ context.Context, name string, value float64, labels Labels) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey(name, labels)
+	g, ok := r.gauges[key]
+	if !ok {
+		g = &gauge{name: name, labels: copyLabels(labels)}
+		r.gauges[key] = g
+	}
+	g.value = value
+}
+
+// Counter returns the current value of a counter series, or 0.
+func (r *Registry) Counter(name string, labels Labels) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if c, ok := r.counters[seriesKey(name, labels)]; ok {
+		return c.value
+	}
+	return 0
+}
+
+// Gauge returns the last value of a gauge series, or 0.
+func (r *Registry) Gauge(name string, labels Labels) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if g, ok := r.gauges[seriesKey(name, labels)]; ok {
+		return g.value
+	}
+	return 0
+}
+
+// Histogram returns the observation count and sum of a histogram series.
+func (r *Registry) Histogram(name string, labels Labels) (count uint64, sum float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if h, ok := r.histograms[seriesKey(name, labels)]; ok {
+		return h.count, h.sum
+	}
+	return 0, 0
+}
+
+// WritePrometheus writes every series in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range sortedNames(r.counters, func(c *counter) string { return c.name }) {
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		for _, key := range sortedKeys(r.counters) {
+			if c := r.counters[key]; c.name == name {
+				fmt.Fprintf(&b, "%s %s\n", key, formatFloat(c.value))
+			}
+		}
+	}
+	for _, name := range sortedNames(r.gauges, func(g *gauge) string { return g.name }) {
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+		for _, key := range sortedKeys(r.gauges) {
+			if g := r.gauges[key]; g.name == name {
+				fmt.Fprintf(&b, "%s %s\n", key, formatFloat(g.value))
+			}
+		}
+	}
+	for _, name := range sortedNames(r.histograms, func(h *histogram) string { return h.name }) {
+		fmt.Fprintf(&b, "# TYPE %s histogram\n", name)
+		for _, key := range sortedKeys(r.histograms) {
+			h := r.histograms[key]
+			if h.name != name {
+				continue
+			}
+			for i, bound := range r.buckets {
+				fmt.Fprintf(&b, "%s %d\n", seriesKey(name+"_bucket", withLabel(h.labels, "le", formatFloat(bound))), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s %d\n", seriesKey(name+"_bucket", withLabel(h.labels, "le", "+Inf")), h.count)
+			fmt.Fprintf(&b, "%s %s\n", seriesKey(name+"_sum", h.labels), formatFloat(h.sum))
+			fmt.Fprintf(&b, "%s %d\n", seriesKey(name+"_count", h.labels), h.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP exposes the registry for Prometheus to scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(w)
+}
+
+func copyLabels(labels Labels) Labels {
+	copied := make(Labels, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return copied
+}
+
+func withLabel(labels Labels, key, value string) Labels {
+	copied := copyLabels(labels)
+	copied[key] = value
+	return copied
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[T any](series map[string]T) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedNames[T any](series map[string]T, name func(T) string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range series {
+		if n := name(s); !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
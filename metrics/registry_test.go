@@ -0,0 +1,89 @@
+package metrics_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+)
+
+func TestRegistryCounter(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+
+	registry.IncCounter(ctx, metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "success"})
+	registry.IncCounter(ctx, metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "success"})
+	registry.IncCounter(ctx, metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "mail_error"})
+
+	if actual := registry.Counter(metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "success"}); actual != 2 {
+		t.Errorf("Counter(success) actual[%v], does not match expected[2]", actual)
+	}
+	if actual := registry.Counter(metrics.SubmissionsTotal, metrics.Labels{metrics.LabelOutcome: "spam"}); actual != 0 {
+		t.Errorf("Counter(spam) actual[%v], does not match expected[0]", actual)
+	}
+}
+
+func TestRegistryHistogram(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	labels := metrics.Labels{metrics.LabelProvider: "sendgrid", metrics.LabelStatusCode: "202"}
+
+	registry.ObserveHistogram(ctx, metrics.MailProviderLatency, 0.2, labels)
+	registry.ObserveHistogram(ctx, metrics.MailProviderLatency, 0.3, labels)
+
+	count, sum := registry.Histogram(metrics.MailProviderLatency, labels)
+	if count != 2 || sum != 0.5 {
+		t.Errorf("Histogram() actual[%d, %v], does not match expected[2, 0.5]", count, sum)
+	}
+}
+
+func TestRegistryGauge(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	labels := metrics.Labels{metrics.LabelProvider: "sendgrid"}
+
+	registry.SetGauge(ctx, metrics.MailBreakerState, 2, labels)
+	registry.SetGauge(ctx, metrics.MailBreakerState, 1, labels)
+
+	if actual := registry.Gauge(metrics.MailBreakerState, labels); actual != 1 {
+		t.Errorf("Gauge() actual[%v], does not match expected[1]", actual)
+	}
+}
+
+func TestRegistryPrometheusExposition(t *testing.T) {
+	ctx := context.Background()
+	registry := metrics.NewRegistry()
+	registry.IncCounter(ctx, metrics.ValidationFailuresTotal, metrics.Labels{metrics.LabelField: "email"})
+	registry.SetGauge(ctx, metrics.MailBreakerState, 2, metrics.Labels{metrics.LabelProvider: "sendgrid"})
+	registry.ObserveHistogram(ctx, metrics.MailProviderLatency, 0.2,
+		metrics.Labels{metrics.LabelProvider: "sendgrid", metrics.LabelStatusCode: "202"})
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# TYPE contact_validation_failures_total counter
+contact_validation_failures_total{field="email"} 1
+# TYPE contact_mail_breaker_state gauge
+contact_mail_breaker_state{provider="sendgrid"} 2
+# TYPE contact_mail_provider_latency_seconds histogram
+contact_mail_provider_latency_seconds_bucket{le="0.05",provider="sendgrid",status_code="202"} 0
+contact_mail_provider_latency_seconds_bucket{le="0.1",provider="sendgrid",status_code="202"} 0
+contact_mail_provider_latency_seconds_bucket{le="0.25",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="0.5",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="1",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="2.5",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="5",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="10",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_bucket{le="+Inf",provider="sendgrid",status_code="202"} 1
+contact_mail_provider_latency_seconds_sum{provider="sendgrid",status_code="202"} 0.2
+contact_mail_provider_latency_seconds_count{provider="sendgrid",status_code="202"} 1
+`
+	if actual := recorder.Body.String(); actual != expected {
+		t.Errorf("ServeHTTP() actual[%s], does not match expected[%s]", actual, expected)
+	}
+	if actual := recorder.Header().Get("Content-Type"); !strings.HasPrefix(actual, "text/plain") {
+		t.Errorf("Content-Type actual[%s], SHOULD be text/plain", actual)
+	}
+}
@@ -0,0 +1,257 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/breaker"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+const (
+	defaultBatchSize  = 50
+	maxRetryBackoff   = 6 * time.Hour
+	logStageOutbox    = "outbox"
+	outcomeSent       = "sent"
+	outcomeRetry      = "retry"
+	outcomeDeadLetter = "dead_letter"
+	outcomeReplayed   = "replayed"
+	outcomeDiscarded  = "discarded"
+	outcomeSkipped    = "skipped"
+)
+
+// Result summarises a Drain.
+type Result struct {
+	Sent         int
+	Retried      int
+	DeadLettered int
+}
+
+// Worker delivers queued submissions. Delivery is at-least-once: a submission
+// is only marked sent after the mailer succeeds, so a worker stopping between
+// the two sends it again once its claim expires.
+type Worker struct {
+	store        store.SubmissionStore
+	mailer       mailer.Mailer
+	logger       *slog.Logger
+	maxAttempts  int
+	retryBackoff time.Duration
+	claimTimeout time.Duration
+	batchSize    int
+	retention    store.RetentionPolicy
+	now          func() time.Time
+}
+
+type Option func(*Worker)
+
+// WithLogger sets the logger. Without it, logging.Default() is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *Worker) {
+		w.logger = logger
+	}
+}
+
+// WithClock sets the time source, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(w *Worker) {
+		w.now = now
+	}
+}
+
+func NewWorker(cfg *configuration.ContactFormConfiguration, submissionStore store.SubmissionStore, m mailer.Mailer, opts ...Option) *Worker {
+	w := &Worker{
+		store:        submissionStore,
+		mailer:       m,
+		logger:       logging.Default(),
+		maxAttempts:  cfg.OutboxMaxAttempts,
+		retryBackoff: cfg.OutboxRetryBackoff,
+		claimTimeout: cfg.OutboxClaimTimeout,
+		batchSize:    defaultBatchSize,
+		retention:    store.Retention(cfg),
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Drain delivers every due submission once, eg. from a scheduled function.
+func (w *Worker) Drain(ctx context.Context) (Result, error) {
+	var result Result
+	for {
+		due, err := w.store.ListDue(ctx, w.now().UTC(), w.batchSize)
+		if err != nil {
+			return result, err
+		}
+		delivered := 0
+		for _, submission := range due {
+			if err := ctx.Err(); err != nil {
+				return result, err
+			}
+			outcome, err := w.deliver(ctx, submission)
+			if err != nil {
+				return result, err
+			}
+			switch outcome {
+			case outcomeSent:
+				result.Sent++
+			case outcomeRetry:
+				result.Retried++
+			case outcomeDeadLetter:
+				result.DeadLettered++
+			}
+			if outcome != "" {
+				delivered++
+			}
+		}
+		if len(due) < w.batchSize || delivered == 0 {
+			return result, nil
+		}
+	}
+}
+
+// Purge deletes the submissions kept longer than the configured
+// SubmissionRetention for their status, and returns how many were deleted.
+func (w *Worker) Purge(ctx context.Context) (int, error) {
+	return store.PurgeExpired(ctx, w.store, w.retention, w.now().UTC())
+}
+
+// Run drains the outbox, and purges expired submissions, every interval until
+// ctx is done, eg. from a long-running command.
+func (w *Worker) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		result, err := w.Drain(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.ErrorContext(ctx, "error draining outbox", logging.KeyStage, logStageOutbox, logging.KeyError, err.Error())
+		} else if result != (Result{}) {
+			w.logger.InfoContext(ctx, "outbox drained", logging.KeyStage, logStageOutbox,
+				"sent", result.Sent, "retried", result.Retried, "dead_lettered", result.DeadLettered)
+		}
+		purged, err := w.Purge(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.logger.ErrorContext(ctx, "error purging submissions", logging.KeyStage, logStageOutbox, logging.KeyError, err.Error())
+		} else if purged > 0 {
+			w.logger.InfoContext(ctx, "submissions purged", logging.KeyStage, logStageOutbox, "purged", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliver claims and sends a submission. It returns "" when another worker claimed it first.
+func (w *Worker) deliver(ctx context.Context, submission *store.Submission) (string, error) {
+	now := w.now().UTC()
+	claimed, err := w.store.Claim(ctx, submission.ID, now, now.Add(w.claimTimeout))
+	if err != nil || !claimed {
+		return "", err
+	}
+	attempt := submission.Attempts + 1
+
+	ctx = store.NewContext(requestid.NewContext(ctx, submission.RequestID), submission.ID)
+	sendErr := w.mailer.SendEmail(ctx, submission.Request())
+	logAttrs := []any{logging.KeyStage, logStageOutbox, "submission_id", submission.ID, "attempt", attempt}
+
+	var openErr *breaker.OpenError
+	switch {
+	case sendErr == nil:
+		w.logger.InfoContext(ctx, "outbox submission sent", append(logAttrs, logging.KeyOutcome, outcomeSent)...)
+		return outcomeSent, w.store.UpdateStatus(ctx, submission.ID, store.StatusSent, "")
+	case errors.As(sendErr, &openErr):
+		// The provider was not called, so the attempt is not counted: an outage
+		// outlasting the attempts must not dead-letter the queue.
+		next := now.Add(openErr.RetryAfter())
+		w.logger.WarnContext(ctx, "outbox submission deferred while the mail circuit is open",
+			append(logAttrs, logging.KeyOutcome, outcomeRetry, logging.KeyError, sendErr.Error(), "next_attempt_at", next)...)
+		return outcomeRetry, w.store.Release(ctx, submission.ID, sendErr.Error(), next)
+	case attempt >= w.maxAttempts || !mailer.Retryable(sendErr):
+		w.logger.ErrorContext(ctx, "outbox submission dead-lettered",
+			append(logAttrs, logging.KeyOutcome, outcomeDeadLetter, logging.KeyError, sendErr.Error())...)
+		return outcomeDeadLetter, w.store.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, sendErr.Error())
+	default:
+		next := now.Add(w.backoff(attempt))
+		w.logger.WarnContext(ctx, "outbox submission will be retried",
+			append(logAttrs, logging.KeyOutcome, outcomeRetry, logging.KeyError, sendErr.Error(), "next_attempt_at", next)...)
+		return outcomeRetry, w.store.Retry(ctx, submission.ID, sendErr.Error(), next)
+	}
+}
+
+// Replay sends a dead-lettered submission again, once. It returns false,
+// without sending, when the submission is not dead-lettered, eg. because it was
+// already replayed, so replaying twice is safe. A failed replay is
+// dead-lettered again, and its error returned.
+func (w *Worker) Replay(ctx context.Context, id string) (bool, error) {
+	submission, err := w.store.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	ctx = requestid.NewContext(ctx, submission.RequestID)
+	logAttrs := []any{logging.KeyStage, logStageOutbox, "submission_id", id, "status", submission.Status}
+
+	now := w.now().UTC()
+	claimed, err := w.store.ClaimDeadLetter(ctx, id, now, now.Add(w.claimTimeout))
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		w.logger.InfoContext(ctx, "replay skipped, submission is not dead-lettered",
+			append(logAttrs, logging.KeyOutcome, outcomeSkipped)...)
+		return false, nil
+	}
+
+	logAttrs = append(logAttrs, "attempt", submission.Attempts+1)
+	if err := w.mailer.SendEmail(store.NewContext(ctx, id), submission.Request()); err != nil {
+		w.logger.ErrorContext(ctx, "replayed submission dead-lettered",
+			append(logAttrs, logging.KeyOutcome, outcomeDeadLetter, logging.KeyError, err.Error())...)
+		if updateErr := w.store.UpdateStatus(ctx, id, store.StatusDeadLetter, err.Error()); updateErr != nil {
+			return false, updateErr
+		}
+		return false, err
+	}
+	w.logger.InfoContext(ctx, "submission replayed", append(logAttrs, logging.KeyOutcome, outcomeReplayed)...)
+	return true, w.store.UpdateStatus(ctx, id, store.StatusSent, "")
+}
+
+// Discard gives up on a dead-lettered submission. Like Replay, it returns false
+// when the submission is not dead-lettered.
+func (w *Worker) Discard(ctx context.Context, id string) (bool, error) {
+	submission, err := w.store.Get(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	ctx = requestid.NewContext(ctx, submission.RequestID)
+	discarded, err := w.store.Discard(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	msg, outcome := "dead-lettered submission discarded", outcomeDiscarded
+	if !discarded {
+		msg, outcome = "discard skipped, submission is not dead-lettered", outcomeSkipped
+	}
+	w.logger.InfoContext(ctx, msg, logging.KeyStage, logStageOutbox,
+		"submission_id", id, "status", submission.Status, logging.KeyOutcome, outcome)
+	return discarded, nil
+}
+
+// backoff doubles the retry delay with each attempt, up to maxRetryBackoff.
+func (w *Worker) backoff(attempt int) time.Duration {
+	delay := w.retryBackoff
+	for i := 1; i < attempt && delay < maxRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return delay
+}
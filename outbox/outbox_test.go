@@ -0,0 +1,419 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/breaker"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/mailer"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/outbox"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+func TestDrain(t *testing.T) {
+	type testSpec struct {
+		failures       int
+		drains         int
+		expectedStatus store.Status
+		expectedCalls  int
+		expectedResult outbox.Result
+	}
+
+	testSpecs := []testSpec{
+		{failures: 0, drains: 1, expectedStatus: store.StatusSent, expectedCalls: 1, expectedResult: outbox.Result{Sent: 1}},
+		{failures: 1, drains: 1, expectedStatus: store.StatusFailed, expectedCalls: 1, expectedResult: outbox.Result{Retried: 1}},
+		{failures: 1, drains: 2, expectedStatus: store.StatusSent, expectedCalls: 2, expectedResult: outbox.Result{Sent: 1}},
+		{failures: 3, drains: 3, expectedStatus: store.StatusDeadLetter, expectedCalls: 3, expectedResult: outbox.Result{DeadLettered: 1}},
+		{failures: 3, drains: 5, expectedStatus: store.StatusDeadLetter, expectedCalls: 3, expectedResult: outbox.Result{}},
+	}
+
+	for _, test := range testSpecs {
+		ctx := context.Background()
+		cfg := setupConfiguration(t)
+		submissionStore, submission := setupStore(t, ctx)
+		mockedMailer := &MockMailer{Failures: test.failures}
+		clock := &testClock{now: submission.CreatedAt}
+
+		worker := outbox.NewWorker(cfg, submissionStore, mockedMailer,
+			outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+
+		var result outbox.Result
+		for i := 0; i < test.drains; i++ {
+			var err error
+			result, err = worker.Drain(ctx)
+			if err != nil {
+				t.Fatalf("Drain() returned error [%v]", err)
+			}
+			clock.now = clock.now.Add(time.Hour)
+		}
+
+		if result != test.expectedResult {
+			t.Errorf("last Drain() actual[%+v], does not match expected[%+v]", result, test.expectedResult)
+		}
+		if mockedMailer.Calls != test.expectedCalls {
+			t.Errorf("SendEmail() calls actual[%d], does not match expected[%d]", mockedMailer.Calls, test.expectedCalls)
+		}
+		if mockedMailer.RequestID != submission.RequestID {
+			t.Errorf("SendEmail() request ID actual[%s], does not match expected[%s]", mockedMailer.RequestID, submission.RequestID)
+		}
+		if mockedMailer.SubmissionID != submission.ID {
+			t.Errorf("SendEmail() submission ID actual[%s], does not match expected[%s]", mockedMailer.SubmissionID, submission.ID)
+		}
+		stored, err := submissionStore.Get(ctx, submission.ID)
+		if err != nil {
+			t.Fatalf("Get() returned error [%v]", err)
+		}
+		if stored.Status != test.expectedStatus {
+			t.Errorf("Status actual[%s], does not match expected[%s]", stored.Status, test.expectedStatus)
+		}
+		if stored.Attempts != test.expectedCalls {
+			t.Errorf("Attempts actual[%d], does not match expected[%d]", stored.Attempts, test.expectedCalls)
+		}
+	}
+}
+
+func TestDrainDeadLettersPermanentFailures(t *testing.T) {
+	type testSpec struct {
+		err            error
+		expectedStatus store.Status
+	}
+
+	testSpecs := []testSpec{
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 401, Err: mailer.ErrProviderAuth}, expectedStatus: store.StatusDeadLetter},
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 400}, expectedStatus: store.StatusDeadLetter},
+		{err: &mailer.ProviderError{Provider: "sendgrid", StatusCode: 429, Err: mailer.ErrProviderRateLimited}, expectedStatus: store.StatusFailed},
+		{err: mailer.ErrProviderTimeout, expectedStatus: store.StatusFailed},
+	}
+
+	for _, test := range testSpecs {
+		ctx := context.Background()
+		submissionStore, submission := setupStore(t, ctx)
+		worker := outbox.NewWorker(setupConfiguration(t), submissionStore, &MockMailer{Failures: 1, Err: test.err},
+			outbox.WithLogger(logging.Discard()), outbox.WithClock((&testClock{now: submission.CreatedAt}).Now))
+
+		if _, err := worker.Drain(ctx); err != nil {
+			t.Fatalf("Drain() returned error [%v]", err)
+		}
+		stored, _ := submissionStore.Get(ctx, submission.ID)
+		if stored.Status != test.expectedStatus {
+			t.Errorf("%v: Status actual[%s], does not match expected[%s]", test.err, stored.Status, test.expectedStatus)
+		}
+	}
+}
+
+func TestDrainBacksOffExponentially(t *testing.T) {
+	ctx := context.Background()
+	cfg := setupConfiguration(t)
+	submissionStore, submission := setupStore(t, ctx)
+	clock := &testClock{now: submission.CreatedAt}
+
+	worker := outbox.NewWorker(cfg, submissionStore, &MockMailer{Failures: 3},
+		outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+
+	expectedDelays := []time.Duration{time.Minute, 2 * time.Minute}
+	for _, expected := range expectedDelays {
+		if _, err := worker.Drain(ctx); err != nil {
+			t.Fatalf("Drain() returned error [%v]", err)
+		}
+		stored, _ := submissionStore.Get(ctx, submission.ID)
+		if actual := stored.NextAttemptAt.Sub(clock.now); actual != expected {
+			t.Errorf("retry delay actual[%v], does not match expected[%v]", actual, expected)
+		}
+
+		clock.now = stored.NextAttemptAt.Add(-time.Second)
+		if result, _ := worker.Drain(ctx); result != (outbox.Result{}) {
+			t.Errorf("Drain() before NextAttemptAt actual[%+v], SHOULD NOT deliver", result)
+		}
+		clock.now = stored.NextAttemptAt
+	}
+}
+
+func TestDrainDefersWhileBreakerOpen(t *testing.T) {
+	ctx := context.Background()
+	cfg := setupConfiguration(t)
+	cfg.MailBreakerFailures = 1
+	cfg.MailBreakerOpenFor = 30 * time.Second
+	submissionStore, submission := setupStore(t, ctx)
+	clock := &testClock{now: submission.CreatedAt}
+	outage := &mailer.ProviderError{Provider: "sendgrid", StatusCode: 503, Err: mailer.ErrProviderUnavailable}
+	mockedMailer := &MockMailer{Failures: 1, Err: outage}
+	m := breaker.New(mockedMailer, cfg, breaker.WithLogger(logging.Discard()), breaker.WithClock(clock.Now))
+	worker := outbox.NewWorker(cfg, submissionStore, m, outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+
+	// Another email finds the outage, opening the circuit.
+	_ = m.SendEmail(ctx, &api.EmailFormRequest{})
+	clock.now = clock.now.Add(10 * time.Second)
+
+	if result, err := worker.Drain(ctx); err != nil || result != (outbox.Result{Retried: 1}) {
+		t.Fatalf("Drain() while open actual[%+v, %v], does not match expected[{Retried:1}, <nil>]", result, err)
+	}
+	if mockedMailer.Calls != 1 {
+		t.Errorf("SendEmail() calls actual[%d], SHOULD NOT call the provider while open", mockedMailer.Calls)
+	}
+	stored, _ := submissionStore.Get(ctx, submission.ID)
+	if stored.Status != store.StatusFailed || stored.Attempts != 0 {
+		t.Errorf("submission actual[%s, %d attempts], does not match expected[failed, 0 attempts]", stored.Status, stored.Attempts)
+	}
+	if actual := stored.NextAttemptAt.Sub(clock.now); actual != 20*time.Second {
+		t.Errorf("deferred for actual[%v], does not match expected[20s], when the circuit lets a probe through", actual)
+	}
+
+	clock.now = stored.NextAttemptAt
+	if result, err := worker.Drain(ctx); err != nil || result != (outbox.Result{Sent: 1}) {
+		t.Errorf("Drain() once half-open actual[%+v, %v], does not match expected[{Sent:1}, <nil>]", result, err)
+	}
+}
+
+func TestDrainSkipsClaimedSubmissions(t *testing.T) {
+	ctx := context.Background()
+	cfg := setupConfiguration(t)
+	submissionStore, submission := setupStore(t, ctx)
+	now := submission.CreatedAt
+
+	claimed, err := submissionStore.Claim(ctx, submission.ID, now, now.Add(cfg.OutboxClaimTimeout))
+	if err != nil || !claimed {
+		t.Fatalf("Claim() actual[%v, %v], does not match expected[true, <nil>]", claimed, err)
+	}
+
+	mockedMailer := &MockMailer{}
+	clock := &testClock{now: now}
+	worker := outbox.NewWorker(cfg, submissionStore, mockedMailer,
+		outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+
+	if _, err := worker.Drain(ctx); err != nil {
+		t.Fatalf("Drain() returned error [%v]", err)
+	}
+	if mockedMailer.Calls != 0 {
+		t.Error("SendEmail() SHOULD NOT be called while another worker holds the claim")
+	}
+
+	// The other worker stopped before recording the result, so it is sent again.
+	clock.now = now.Add(cfg.OutboxClaimTimeout)
+	result, err := worker.Drain(ctx)
+	if err != nil {
+		t.Fatalf("Drain() returned error [%v]", err)
+	}
+	if result.Sent != 1 || mockedMailer.Calls != 1 {
+		t.Errorf("Drain() after the claim timeout actual[%+v], SHOULD send the submission", result)
+	}
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+	cfg := setupConfiguration(t)
+	submissionStore, _ := setupStore(t, context.Background())
+	mockedMailer := &MockMailer{}
+
+	worker := outbox.NewWorker(cfg, submissionStore, mockedMailer, outbox.WithLogger(logging.Discard()))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := worker.Run(ctx, 10*time.Millisecond); err != nil {
+		t.Errorf("Run() returned error [%v]", err)
+	}
+	if mockedMailer.Calls != 1 {
+		t.Errorf("SendEmail() calls actual[%d], does not match expected[1]", mockedMailer.Calls)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("SUBMISSION_RETENTION_DEAD_LETTER", "24h")
+	cfg := setupConfiguration(t)
+	submissionStore, submission := setupStore(t, ctx)
+	kept := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"},
+		"kept-request-id", time.Now().UTC())
+	submissionStore.Create(ctx, kept)
+	submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "mailer error")
+
+	clock := &testClock{now: time.Now().UTC().Add(12 * time.Hour)}
+	worker := outbox.NewWorker(cfg, submissionStore, &MockMailer{}, outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+	if purged, err := worker.Purge(ctx); err != nil || purged != 0 {
+		t.Errorf("Purge() within the retention actual[%d, %v], does not match expected[0, <nil>]", purged, err)
+	}
+	clock.now = clock.now.Add(24 * time.Hour)
+	if purged, err := worker.Purge(ctx); err != nil || purged != 1 {
+		t.Errorf("Purge() actual[%d, %v], does not match expected[1, <nil>]", purged, err)
+	}
+	if _, err := submissionStore.Get(ctx, submission.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() of a purged submission error actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+	if _, err := submissionStore.Get(ctx, kept.ID); err != nil {
+		t.Errorf("Get() of a received submission returned error [%v], SHOULD be kept without a retention", err)
+	}
+}
+
+func TestRunPurgesExpiredSubmissions(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("SUBMISSION_RETENTION_DEAD_LETTER", "24h")
+	cfg := setupConfiguration(t)
+	submissionStore, submission := setupStore(t, ctx)
+	submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "mailer error")
+
+	clock := &testClock{now: time.Now().UTC().Add(48 * time.Hour)}
+	worker := outbox.NewWorker(cfg, submissionStore, &MockMailer{}, outbox.WithLogger(logging.Discard()), outbox.WithClock(clock.Now))
+	runCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := worker.Run(runCtx, 10*time.Millisecond); err != nil {
+		t.Errorf("Run() returned error [%v]", err)
+	}
+	if _, err := submissionStore.Get(ctx, submission.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get() after Run() error actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	type testSpec struct {
+		failures         int
+		expectedReplayed bool
+		expectedError    bool
+		expectedStatus   store.Status
+		expectedCalls    int
+		expectedOutcomes []string
+	}
+
+	testSpecs := []testSpec{
+		{failures: 0, expectedReplayed: true, expectedStatus: store.StatusSent, expectedCalls: 1,
+			expectedOutcomes: []string{"replayed", "skipped"}},
+		{failures: 1, expectedError: true, expectedStatus: store.StatusDeadLetter, expectedCalls: 2,
+			expectedOutcomes: []string{"dead_letter", "replayed"}},
+	}
+
+	for _, test := range testSpecs {
+		ctx := context.Background()
+		cfg := setupConfiguration(t)
+		submissionStore, submission := setupStore(t, ctx)
+		if err := submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "mailer error"); err != nil {
+			t.Fatalf("UpdateStatus() returned error [%v]", err)
+		}
+		mockedMailer := &MockMailer{Failures: test.failures}
+		recorder := logging.NewRecorder()
+
+		worker := outbox.NewWorker(cfg, submissionStore, mockedMailer, outbox.WithLogger(slog.New(recorder)))
+
+		replayed, err := worker.Replay(ctx, submission.ID)
+		if replayed != test.expectedReplayed || (err != nil) != test.expectedError {
+			t.Errorf("Replay() actual[%v, %v], does not match expected[%v, error=%v]", replayed, err, test.expectedReplayed, test.expectedError)
+		}
+		stored, _ := submissionStore.Get(ctx, submission.ID)
+		if stored.Status != test.expectedStatus {
+			t.Errorf("Status actual[%s], does not match expected[%s]", stored.Status, test.expectedStatus)
+		}
+
+		// Replaying again only sends a submission that is still dead-lettered.
+		worker.Replay(ctx, submission.ID)
+		if mockedMailer.Calls != test.expectedCalls {
+			t.Errorf("SendEmail() calls actual[%d], does not match expected[%d]", mockedMailer.Calls, test.expectedCalls)
+		}
+		if mockedMailer.RequestID != submission.RequestID {
+			t.Errorf("SendEmail() request ID actual[%s], does not match expected[%s]", mockedMailer.RequestID, submission.RequestID)
+		}
+
+		var outcomes []string
+		for _, record := range recorder.Records() {
+			attrs := logging.Attrs(record)
+			outcomes = append(outcomes, attrs[logging.KeyOutcome].String())
+			if attrs["submission_id"].String() != submission.ID {
+				t.Errorf("log submission_id actual[%s], does not match expected[%s]", attrs["submission_id"], submission.ID)
+			}
+		}
+		if !reflect.DeepEqual(outcomes, test.expectedOutcomes) {
+			t.Errorf("logged outcomes actual[%v], does not match expected[%v]", outcomes, test.expectedOutcomes)
+		}
+	}
+}
+
+func TestReplayUnknownSubmission(t *testing.T) {
+	ctx := context.Background()
+	submissionStore, _ := setupStore(t, ctx)
+	worker := outbox.NewWorker(setupConfiguration(t), submissionStore, &MockMailer{}, outbox.WithLogger(logging.Discard()))
+
+	if _, err := worker.Replay(ctx, "unknown"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Replay() error actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+	if _, err := worker.Discard(ctx, "unknown"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Discard() error actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	ctx := context.Background()
+	submissionStore, submission := setupStore(t, ctx)
+	mockedMailer := &MockMailer{}
+	worker := outbox.NewWorker(setupConfiguration(t), submissionStore, mockedMailer, outbox.WithLogger(logging.Discard()))
+
+	if discarded, err := worker.Discard(ctx, submission.ID); err != nil || discarded {
+		t.Errorf("Discard() of a received submission actual[%v, %v], does not match expected[false, <nil>]", discarded, err)
+	}
+	submissionStore.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "mailer error")
+	if discarded, err := worker.Discard(ctx, submission.ID); err != nil || !discarded {
+		t.Errorf("Discard() actual[%v, %v], does not match expected[true, <nil>]", discarded, err)
+	}
+	if replayed, err := worker.Replay(ctx, submission.ID); err != nil || replayed {
+		t.Errorf("Replay() of a discarded submission actual[%v, %v], does not match expected[false, <nil>]", replayed, err)
+	}
+	if mockedMailer.Calls != 0 {
+		t.Error("SendEmail() SHOULD NOT be called for a discarded submission")
+	}
+}
+
+// Support functions
+
+func setupConfiguration(t *testing.T) *configuration.ContactFormConfiguration {
+	t.Setenv("OUTBOX_MAX_ATTEMPTS", "3")
+	t.Setenv("OUTBOX_RETRY_BACKOFF", "1m")
+	t.Setenv("OUTBOX_CLAIM_TIMEOUT", "5m")
+	return configuration.NewContactFormConfiguration()
+}
+
+func setupStore(t *testing.T, ctx context.Context) (store.SubmissionStore, *store.Submission) {
+	submissionStore, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	submission := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"},
+		"test-request-id", time.Now().UTC().Truncate(time.Second))
+	if err := submissionStore.Create(ctx, submission); err != nil {
+		t.Fatalf("Create() returned error [%v]", err)
+	}
+	return submissionStore, submission
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// Mocks
+
+type MockMailer struct {
+	Failures int
+	// Err is returned by the failures. Without it, an unclassified error is returned.
+	Err          error
+	Calls        int
+	RequestID    string
+	SubmissionID string
+}
+
+func (m *MockMailer) SendEmail(ctx context.Context, _ *api.EmailFormRequest) error {
+	m.Calls++
+	m.RequestID = requestid.FromContext(ctx)
+	m.SubmissionID = store.IDFromContext(ctx)
+	if m.Calls <= m.Failures {
+		if m.Err != nil {
+			return m.Err
+		}
+		return errors.New("mailer error")
+	}
+	return nil
+}
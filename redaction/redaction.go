@@ -0,0 +1,173 @@
+package redaction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Policy controls how much personal data reaches the logs.
+type Policy string
+
+const (
+	// PolicyNone removes personal data entirely. This is the default.
+	PolicyNone Policy = "none"
+	// PolicyMasked pseudonymises personal data: hashed emails and names, truncated text.
+	PolicyMasked Policy = "masked"
+	// PolicyFullDebug logs personal data as is. Secrets are still removed.
+	PolicyFullDebug Policy = "full-debug"
+)
+
+const (
+	Redacted          = "[REDACTED]"
+	maskedTextLength  = 64
+	maxFullTextLength = 2000
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// SendGrid API keys, and bearer/basic credentials.
+	secretPattern = regexp.MustCompile(`SG\.[A-Za-z0-9_\-]{16,}\.[A-Za-z0-9_\-]{16,}|(?i)(bearer|basic)\s+[A-Za-z0-9._~+/=\-]+`)
+)
+
+// Attribute keys, by the kind of data they hold.
+var (
+	emailKeys  = map[string]bool{"email": true, "reply_to": true, "from": true, "to": true}
+	nameKeys   = map[string]bool{"name": true}
+	bodyKeys   = map[string]bool{"message": true, "body": true, "response_body": true}
+	secretKeys = map[string]bool{"api_key": true, "authorization": true, "password": true, "secret": true, "token": true}
+	textKeys   = map[string]bool{"error": true, "global_error": true, "reason": true}
+	// Values that cannot be inspected safely are always dropped.
+	opaqueKeys = map[string]bool{"request": true}
+)
+
+// ParsePolicy parses a configured policy. Empty or unknown values fall back to PolicyNone.
+func ParsePolicy(value string) Policy {
+	switch Policy(strings.ToLower(strings.TrimSpace(value))) {
+	case PolicyMasked:
+		return PolicyMasked
+	case PolicyFullDebug:
+		return PolicyFullDebug
+	default:
+		return PolicyNone
+	}
+}
+
+type Redactor struct {
+	policy Policy
+}
+
+func New(policy Policy) *Redactor {
+	return &Redactor{policy: ParsePolicy(string(policy))}
+}
+
+func (r *Redactor) Policy() Policy {
+	return r.policy
+}
+
+// Email masks an email address: "t***@example.com#1a2b3c4d" when masked.
+func (r *Redactor) Email(email string) string {
+	switch r.policy {
+	case PolicyFullDebug:
+		return email
+	case PolicyMasked:
+		local, domain, found := strings.Cut(strings.TrimSpace(email), "@")
+		if !found {
+			return hash(email)
+		}
+		return fmt.Sprintf("%s***@%s#%s", firstRune(local), domain, hash(email))
+	default:
+		return Redacted
+	}
+}
+
+// Name masks a person's name: "#1a2b3c4d" when masked.
+func (r *Redactor) Name(name string) string {
+	switch r.policy {
+	case PolicyFullDebug:
+		return name
+	case PolicyMasked:
+		return "#" + hash(name)
+	default:
+		return Redacted
+	}
+}
+
+// Body truncates free text written by the visitor, such as the message.
+func (r *Redactor) Body(body string) string {
+	switch r.policy {
+	case PolicyFullDebug:
+		return truncate(Secret(body), maxFullTextLength)
+	case PolicyMasked:
+		return truncate(r.Text(body), maskedTextLength)
+	default:
+		return fmt.Sprintf("%s len=%d", Redacted, utf8.RuneCountInString(body))
+	}
+}
+
+// Text cleans system generated text, such as errors and provider responses,
+// which may echo personal data: email addresses are masked, and secrets removed.
+func (r *Redactor) Text(text string) string {
+	text = Secret(text)
+	if r.policy == PolicyFullDebug {
+		return truncate(text, maxFullTextLength)
+	}
+	return truncate(emailPattern.ReplaceAllStringFunc(text, r.Email), maxFullTextLength)
+}
+
+// Secret removes credentials from text, under every policy.
+func Secret(text string) string {
+	return secretPattern.ReplaceAllString(text, Redacted)
+}
+
+// Attr redacts a log attribute according to its key.
+func (r *Redactor) Attr(attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	switch {
+	case opaqueKeys[key]:
+		return slog.String(attr.Key, Redacted)
+	case secretKeys[key] || strings.HasSuffix(key, "_key") || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret"):
+		return slog.String(attr.Key, Redacted)
+	case emailKeys[key]:
+		return slog.String(attr.Key, r.Email(attr.Value.String()))
+	case nameKeys[key]:
+		return slog.String(attr.Key, r.Name(attr.Value.String()))
+	case bodyKeys[key]:
+		return slog.String(attr.Key, r.Body(attr.Value.String()))
+	case textKeys[key]:
+		return slog.String(attr.Key, r.Text(attr.Value.String()))
+	case attr.Value.Kind() == slog.KindGroup:
+		group := attr.Value.Group()
+		redactedGroup := make([]any, 0, len(group))
+		for _, member := range group {
+			redactedGroup = append(redactedGroup, r.Attr(member))
+		}
+		return slog.Group(attr.Key, redactedGroup...)
+	}
+	return attr
+}
+
+// hash is a short, stable pseudonym, so repeated submissions can be correlated.
+func hash(value string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return hex.EncodeToString(sum[:4])
+}
+
+func firstRune(value string) string {
+	r, size := utf8.DecodeRuneInString(value)
+	if size == 0 || r == utf8.RuneError {
+		return ""
+	}
+	return string(r)
+}
+
+func truncate(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n]) + "…"
+}
@@ -0,0 +1,92 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+)
+
+const (
+	Header    = "X-Request-Id"
+	maxLength = 128
+)
+
+// runtimeActivationIDKey is the plain string key the DigitalOcean Functions Go
+// runtime stores the activation ID under, as its docs read it with
+// ctx.Value("activation_id"). It is only read, as a fallback: contexts made
+// here use activationIDKey.
+const runtimeActivationIDKey = "activation_id"
+
+type contextKey struct{}
+
+type activationIDKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// NewActivationContext returns a copy of ctx carrying the activation ID of the
+// invocation, which Resolve falls back to.
+func NewActivationContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, activationIDKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Resolve picks the request ID for an invocation. In order of preference:
+// an ID already in ctx, the incoming header, the DigitalOcean activation ID,
+// and finally a newly generated ID. Values that are not Valid are ignored.
+func Resolve(ctx context.Context, header string) string {
+	candidates := []string{FromContext(ctx), header, activationID(ctx)}
+	for _, candidate := range candidates {
+		if Valid(candidate) {
+			return candidate
+		}
+	}
+	return New()
+}
+
+// New generates a random 128 bit request ID, hex encoded.
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether id is safe to echo into logs and headers:
+// 1 to 128 characters of [A-Za-z0-9._:-].
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func activationID(ctx context.Context) string {
+	if ctx != nil {
+		for _, key := range []any{activationIDKey{}, runtimeActivationIDKey} {
+			if id, ok := ctx.Value(key).(string); ok && id != "" {
+				return id
+			}
+		}
+	}
+	return os.Getenv("__OW_ACTIVATION_ID")
+}
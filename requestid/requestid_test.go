@@ -0,0 +1,77 @@
+package requestid_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+func TestNewGeneratesUniqueValidIDs(t *testing.T) {
+	first := requestid.New()
+	second := requestid.New()
+	if !requestid.Valid(first) || !requestid.Valid(second) {
+		t.Errorf("New() SHOULD generate valid IDs, got [%s] and [%s]", first, second)
+	}
+	if first == second {
+		t.Errorf("New() SHOULD generate unique IDs, got [%s] twice", first)
+	}
+}
+
+func TestValid(t *testing.T) {
+	type testSpec struct {
+		id       string
+		expected bool
+	}
+
+	testSpecs := []testSpec{
+		{id: "", expected: false},
+		{id: "abc-123_DEF.4:5", expected: true},
+		{id: "has space", expected: false},
+		{id: "inject\r\nBcc: victim@example.com", expected: false},
+		{id: strings.Repeat("a", 128), expected: true},
+		{id: strings.Repeat("a", 129), expected: false},
+	}
+
+	for _, test := range testSpecs {
+		if actual := requestid.Valid(test.id); actual != test.expected {
+			t.Errorf("Valid(%q) actual[%v], does not match expected[%v]", test.id, actual, test.expected)
+		}
+	}
+}
+
+func TestResolvePreference(t *testing.T) {
+	t.Setenv("__OW_ACTIVATION_ID", "")
+
+	fromContext := requestid.NewContext(context.Background(), "from-context")
+	if actual := requestid.Resolve(fromContext, "from-header"); actual != "from-context" {
+		t.Errorf("Resolve() actual[%s], does not match expected[%s]", actual, "from-context")
+	}
+
+	if actual := requestid.Resolve(context.Background(), "from-header"); actual != "from-header" {
+		t.Errorf("Resolve() actual[%s], does not match expected[%s]", actual, "from-header")
+	}
+
+	activation := requestid.NewActivationContext(context.Background(), "from-activation")
+	if actual := requestid.Resolve(activation, "bad header\n"); actual != "from-activation" {
+		t.Errorf("Resolve() actual[%s], does not match expected[%s]", actual, "from-activation")
+	}
+
+	// The DigitalOcean runtime stores the activation ID under a plain string key.
+	//lint:ignore SA1029 mirrors the runtime's key
+	runtime := context.WithValue(context.Background(), "activation_id", "from-runtime")
+	if actual := requestid.Resolve(runtime, ""); actual != "from-runtime" {
+		t.Errorf("Resolve() actual[%s], does not match expected[%s]", actual, "from-runtime")
+	}
+
+	t.Setenv("__OW_ACTIVATION_ID", "from-env")
+	if actual := requestid.Resolve(context.Background(), ""); actual != "from-env" {
+		t.Errorf("Resolve() actual[%s], does not match expected[%s]", actual, "from-env")
+	}
+
+	t.Setenv("__OW_ACTIVATION_ID", "")
+	if actual := requestid.Resolve(context.Background(), ""); !requestid.Valid(actual) {
+		t.Errorf("Resolve() SHOULD generate a valid ID, got [%s]", actual)
+	}
+}
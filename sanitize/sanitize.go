@@ -0,0 +1,134 @@
+// Package sanitize normalises the text of contact form requests before they are
+// validated, so hostile characters never reach the email: control and
+// bidirectional characters, which can forge headers or disguise text, and
+// invisible or stacked characters.
+package sanitize
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+// Sanitizer normalises the text fields of requests, each by its Policy.
+type Sanitizer struct {
+	policies map[string]Policy
+}
+
+type Option func(*Sanitizer)
+
+// WithPolicy sets the policy of field, eg. validation.NameField. The policy of
+// validation.FieldsField applies to the values of custom fields, whose names
+// are single line.
+func WithPolicy(field string, policy Policy) Option {
+	return func(s *Sanitizer) {
+		s.policies[field] = policy
+	}
+}
+
+// New returns a Sanitizer with the default policies, overridden by the
+// configured InputPolicies:
+//
+//   - name and custom field names collapse their whitespace into single spaces.
+//   - message and custom field values keep their line breaks.
+//   - email and formId are rejected, rather than stripped, as they are not
+//     free text.
+//
+// Every field limits its combining marks to InputMaxCombiningMarks.
+func New(cfg *configuration.ContactFormConfiguration, opts ...Option) *Sanitizer {
+	marks := cfg.InputMaxCombiningMarks
+	s := &Sanitizer{policies: map[string]Policy{
+		validation.NameField:    {MaxCombiningMarks: marks},
+		validation.EmailField:   {Reject: true, MaxCombiningMarks: marks},
+		validation.MessageField: {Multiline: true, MaxCombiningMarks: marks},
+		validation.FormIDField:  {Reject: true, MaxCombiningMarks: marks},
+		validation.FieldsField:  {Multiline: true, MaxCombiningMarks: marks},
+	}}
+	for field, policy := range cfg.InputPolicies {
+		if fieldPolicy, ok := s.policies[field]; ok {
+			fieldPolicy.Reject = policy == configuration.InputPolicyReject
+			s.policies[field] = fieldPolicy
+		}
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Sanitize normalises the text fields of request in place. It returns the
+// field errors of those their policies reject, which are left as they were.
+// Names and emails with line breaks or encoded words are always rejected.
+func (s *Sanitizer) Sanitize(request *api.EmailFormRequest) map[string]string {
+	if request == nil {
+		return nil
+	}
+	fieldErrors := make(map[string]string)
+	normalize := func(field string, text *string, policy Policy) {
+		normalized, err := Normalize(*text, policy)
+		if err != nil {
+			if _, exists := fieldErrors[field]; !exists {
+				fieldErrors[field] = fieldError(field, policy, err)
+			}
+			return
+		}
+		*text = normalized
+	}
+	// The name and email become the Reply-To header, where line breaks and
+	// encoded words are injection attempts, rejected whatever the policy.
+	for field, text := range map[string]*string{validation.NameField: &request.Name, validation.EmailField: &request.Email} {
+		original := *text
+		if validation.ValidHeaderValue(original) {
+			normalize(field, text, s.policies[field])
+		}
+		// Removing hidden characters can join an encoded word, eg. "=?utf-8?q?x?\u200b=".
+		if !validation.ValidHeaderValue(*text) {
+			*text = original
+			fieldErrors[field] = validation.HeaderValueErrorMsg(field)
+		}
+	}
+	normalize(validation.MessageField, &request.Message, s.policies[validation.MessageField])
+	normalize(validation.FormIDField, &request.FormID, s.policies[validation.FormIDField])
+	if len(request.Fields) > 0 {
+		request.Fields = s.sanitizeFields(request.Fields, normalize)
+	}
+	if len(fieldErrors) == 0 {
+		return nil
+	}
+	return fieldErrors
+}
+
+// sanitizeFields normalises the names and values of custom fields. Names that
+// become the same keep the first, in sorted order.
+func (s *Sanitizer) sanitizeFields(fields map[string]string, normalize func(string, *string, Policy)) map[string]string {
+	valuePolicy := s.policies[validation.FieldsField]
+	namePolicy := valuePolicy
+	namePolicy.Multiline = false
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sanitized := make(map[string]string, len(fields))
+	for _, name := range names {
+		value, normalizedName := fields[name], name
+		normalize(validation.FieldsField, &normalizedName, namePolicy)
+		normalize(validation.FieldsField, &value, valuePolicy)
+		if _, exists := sanitized[normalizedName]; !exists {
+			sanitized[normalizedName] = value
+		}
+	}
+	return sanitized
+}
+
+func fieldError(field string, policy Policy, err error) string {
+	if errors.Is(err, ErrCombiningMarks) {
+		return fmt.Sprintf("%s must have at most %d combining marks on each character", field, policy.MaxCombiningMarks)
+	}
+	return fmt.Sprintf("%s must not contain control, bidirectional or invisible characters", field)
+}
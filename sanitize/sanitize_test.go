@@ -0,0 +1,171 @@
+package sanitize_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/sanitize"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+const (
+	hiddenCharacters = "must not contain control, bidirectional or invisible characters"
+	headerInjection  = "must not contain line breaks or encoded words"
+)
+
+func newConfiguration(policies map[string]string) *configuration.ContactFormConfiguration {
+	return &configuration.ContactFormConfiguration{InputPolicies: policies, InputMaxCombiningMarks: 4}
+}
+
+func TestSanitize(t *testing.T) {
+	type testSpec struct {
+		name                string
+		cfg                 *configuration.ContactFormConfiguration
+		opts                []sanitize.Option
+		request             api.EmailFormRequest
+		expectedRequest     api.EmailFormRequest
+		expectedFieldErrors map[string]string
+	}
+
+	testSpecs := []testSpec{
+		{
+			name: "default policies",
+			cfg:  newConfiguration(nil),
+			request: api.EmailFormRequest{Name: " Jose\u0301\t Thomas\u200b ", Email: " bob@example.com ",
+				Message: "Hello\r\n\u202eworld\u202c\r\n", FormID: "wedding", Fields: map[string]string{" venue\n": "Kyoto\r\nJapan\u200b"}},
+			expectedRequest: api.EmailFormRequest{Name: "José Thomas", Email: "bob@example.com",
+				Message: "Hello\nworld", FormID: "wedding", Fields: map[string]string{"venue": "Kyoto\nJapan"}},
+		},
+		{
+			name:                "email rejected",
+			cfg:                 newConfiguration(nil),
+			request:             api.EmailFormRequest{Name: "Bob", Email: "bob@exa\u200bmple.com", Message: "Hi"},
+			expectedRequest:     api.EmailFormRequest{Name: "Bob", Email: "bob@exa\u200bmple.com", Message: "Hi"},
+			expectedFieldErrors: map[string]string{validation.EmailField: "email " + hiddenCharacters},
+		},
+		{
+			name:                "form ID rejected",
+			cfg:                 newConfiguration(nil),
+			request:             api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi", FormID: "wedding\x00"},
+			expectedRequest:     api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi", FormID: "wedding\x00"},
+			expectedFieldErrors: map[string]string{validation.FormIDField: "formId " + hiddenCharacters},
+		},
+		{
+			name:                "configured to reject names",
+			cfg:                 newConfiguration(map[string]string{"name": configuration.InputPolicyReject, "email": configuration.InputPolicyStrip}),
+			request:             api.EmailFormRequest{Name: "\u202eBob", Email: "bob@exa\u200bmple.com", Message: "Hi"},
+			expectedRequest:     api.EmailFormRequest{Name: "\u202eBob", Email: "bob@example.com", Message: "Hi"},
+			expectedFieldErrors: map[string]string{validation.NameField: "name " + hiddenCharacters},
+		},
+		{
+			name:    "header injection rejected whatever the policy",
+			cfg:     newConfiguration(map[string]string{"email": configuration.InputPolicyStrip}),
+			request: api.EmailFormRequest{Name: "Bob\r\nBcc: eve@example.com", Email: "=?utf-8?q?eve=40evil.example?=@example.com", Message: "Hi\r\n"},
+			expectedRequest: api.EmailFormRequest{Name: "Bob\r\nBcc: eve@example.com", Email: "=?utf-8?q?eve=40evil.example?=@example.com",
+				Message: "Hi"},
+			expectedFieldErrors: map[string]string{validation.NameField: "name " + headerInjection,
+				validation.EmailField: "email " + headerInjection},
+		},
+		{
+			name:                "encoded word left by stripping",
+			cfg:                 newConfiguration(nil),
+			request:             api.EmailFormRequest{Name: "=?utf-8?q?Bob?\u200b=", Email: "bob@example.com", Message: "Hi"},
+			expectedRequest:     api.EmailFormRequest{Name: "=?utf-8?q?Bob?\u200b=", Email: "bob@example.com", Message: "Hi"},
+			expectedFieldErrors: map[string]string{validation.NameField: "name " + headerInjection},
+		},
+		{
+			name:    "combining marks",
+			cfg:     newConfiguration(map[string]string{"message": configuration.InputPolicyReject}),
+			request: api.EmailFormRequest{Name: "Z\u0363\u0364\u0365\u0366\u0367", Email: "bob@example.com", Message: "Z\u0363\u0364\u0365\u0366\u0367"},
+			expectedRequest: api.EmailFormRequest{Name: "Z\u0363\u0364\u0365\u0366", Email: "bob@example.com",
+				Message: "Z\u0363\u0364\u0365\u0366\u0367"},
+			expectedFieldErrors: map[string]string{validation.MessageField: "message must have at most 4 combining marks on each character"},
+		},
+		{
+			name: "custom field names that become the same",
+			cfg:  newConfiguration(nil),
+			request: api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi",
+				Fields: map[string]string{"venue": "Kyoto", "venue\u200b": "Osaka"}},
+			expectedRequest: api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi",
+				Fields: map[string]string{"venue": "Kyoto"}},
+		},
+		{
+			name: "custom field rejected",
+			cfg:  newConfiguration(map[string]string{"fields": configuration.InputPolicyReject}),
+			request: api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi",
+				Fields: map[string]string{"venue": "Kyoto\u2066", "date": "2025-04-12\r\n"}},
+			expectedRequest: api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hi",
+				Fields: map[string]string{"venue": "Kyoto\u2066", "date": "2025-04-12"}},
+			expectedFieldErrors: map[string]string{validation.FieldsField: "fields " + hiddenCharacters},
+		},
+		{
+			name:            "option policy",
+			cfg:             newConfiguration(nil),
+			opts:            []sanitize.Option{sanitize.WithPolicy(validation.MessageField, sanitize.Policy{})},
+			request:         api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hello\r\n\r\nworld"},
+			expectedRequest: api.EmailFormRequest{Name: "Bob", Email: "bob@example.com", Message: "Hello world"},
+		},
+	}
+
+	for _, test := range testSpecs {
+		request := test.request
+		actual := sanitize.New(test.cfg, test.opts...).Sanitize(&request)
+		if !reflect.DeepEqual(actual, test.expectedFieldErrors) {
+			t.Errorf("%s: field errors actual[%v], does not match expected[%v]", test.name, actual, test.expectedFieldErrors)
+		}
+		if !reflect.DeepEqual(request, test.expectedRequest) {
+			t.Errorf("%s: request actual[%+q], does not match expected[%+q]", test.name, request, test.expectedRequest)
+		}
+	}
+}
+
+func TestSanitizeNilRequest(t *testing.T) {
+	if actual := sanitize.New(newConfiguration(nil)).Sanitize(nil); actual != nil {
+		t.Errorf("field errors actual[%v], SHOULD be nil", actual)
+	}
+}
+
+func FuzzSanitize(f *testing.F) {
+	f.Add("Gavin\r\nBcc: eve@example.com", "bob@example.com", "Hello\r\nworld", "venue\n", "Kyoto\u202e")
+	f.Add("=?utf-8?q?Gavin?\u200b=", "=?utf-8?b?ZXZl?=@example.com", "Hi", "venue", "Kyoto")
+	f.Add("\u3164", "bob@exa\u200bmple.com", "Z\u0363\u0364\u0365\u0366\u0367", "\u200b", "\xff")
+
+	sanitizer := sanitize.New(newConfiguration(nil))
+	f.Fuzz(func(t *testing.T, name, email, message, fieldName, fieldValue string) {
+		request := api.EmailFormRequest{Name: name, Email: email, Message: message, Fields: map[string]string{fieldName: fieldValue}}
+		fieldErrors := sanitizer.Sanitize(&request)
+
+		if _, rejected := fieldErrors[validation.NameField]; rejected {
+			if request.Name != name {
+				t.Errorf("rejected name actual[%+q], SHOULD be left as it was [%+q]", request.Name, name)
+			}
+		} else if !validation.ValidHeaderValue(request.Name) {
+			t.Errorf("name actual[%+q], SHOULD NOT contain line breaks or encoded words", request.Name)
+		}
+		if strings.ContainsRune(request.Message, '\r') {
+			t.Errorf("message actual[%+q], SHOULD NOT contain carriage returns", request.Message)
+		}
+		for fieldName := range request.Fields {
+			if strings.ContainsAny(fieldName, "\r\n") {
+				t.Errorf("field name actual[%+q], SHOULD NOT contain line breaks", fieldName)
+			}
+		}
+		if _, rejected := fieldErrors[validation.EmailField]; rejected {
+			if request.Email != email {
+				t.Errorf("rejected email actual[%+q], SHOULD be left as it was [%+q]", request.Email, email)
+			}
+		} else if !validation.ValidHeaderValue(request.Email) {
+			t.Errorf("email actual[%+q], SHOULD NOT contain line breaks or encoded words", request.Email)
+		}
+
+		sanitized := request
+		if fieldErrors == nil {
+			if again := sanitizer.Sanitize(&sanitized); again != nil || !reflect.DeepEqual(sanitized, request) {
+				t.Errorf("Sanitize(%+q) actual[%+q, %v], SHOULD keep a sanitized request", request, sanitized, again)
+			}
+		}
+	})
+}
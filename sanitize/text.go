@@ -0,0 +1,163 @@
+package sanitize
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Errors of the text a Policy rejects.
+var (
+	// ErrHiddenCharacters reports control, bidirectional or invisible
+	// characters, or invalid UTF-8.
+	ErrHiddenCharacters = errors.New("text contains control, bidirectional or invisible characters")
+	// ErrCombiningMarks reports more combining marks on a character than the
+	// Policy allows.
+	ErrCombiningMarks = errors.New("text contains too many combining marks on a character")
+)
+
+const (
+	zeroWidthNonJoiner = '\u200c'
+	zeroWidthJoiner    = '\u200d'
+)
+
+// invisible are letters and marks that show nothing, used to pass blank names
+// off as text.
+var invisible = map[rune]bool{
+	'\u034f': true, // combining grapheme joiner
+	'\u115f': true, // Hangul choseong filler
+	'\u1160': true, // Hangul jungseong filler
+	'\u17b4': true, // Khmer vowel inherent aq
+	'\u17b5': true, // Khmer vowel inherent aa
+	'\u2800': true, // Braille pattern blank
+	'\u3164': true, // Hangul filler
+	'\uffa0': true, // halfwidth Hangul filler
+}
+
+// Policy is how the text of a field is normalised.
+type Policy struct {
+	// Reject rejects text with control, bidirectional or invisible
+	// characters, invalid UTF-8, or too many combining marks, instead of
+	// removing them.
+	Reject bool
+	// Multiline keeps line breaks, as \n, and tabs. Otherwise every run of
+	// whitespace, line breaks included, becomes a single space.
+	Multiline bool
+	// MaxCombiningMarks limits the combining marks on each character. Zero
+	// does not limit them.
+	MaxCombiningMarks int
+}
+
+// Normalize returns text in Unicode normalisation form C, without leading and
+// trailing whitespace, control characters other than the line breaks and tabs
+// of Multiline text, bidirectional controls, or zero width and invisible
+// characters. Zero width joiners are kept between characters, as in emoji
+// sequences and Persian words. CRLF and lone CRs become \n, or spaces.
+//
+// Text a Reject policy rejects returns ErrHiddenCharacters or
+// ErrCombiningMarks.
+func Normalize(text string, policy Policy) (string, error) {
+	stripped, hidden := strip(text, policy.Multiline)
+	if hidden && policy.Reject {
+		return "", ErrHiddenCharacters
+	}
+	normalized := norm.NFC.String(stripped)
+	limited, excess := limitMarks(normalized, policy.MaxCombiningMarks)
+	if excess && policy.Reject {
+		return "", ErrCombiningMarks
+	}
+	if excess {
+		// Removing marks can unblock the composition of those left.
+		normalized = norm.NFC.String(limited)
+	}
+	return normalized, nil
+}
+
+// strip removes the hidden characters of text, and normalises its whitespace.
+// It reports whether any hidden characters were removed.
+func strip(text string, multiline bool) (string, bool) {
+	var b strings.Builder
+	b.Grow(len(text))
+	hidden, space := false, false
+	// joiner is a zero width joiner or non-joiner, kept if the next character
+	// written can be joined.
+	var last, joiner rune
+	write := func(r rune) {
+		if joiner != 0 {
+			if space || !joinable(r) {
+				hidden = true
+			} else {
+				b.WriteRune(joiner)
+			}
+			joiner = 0
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+		last = r
+	}
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		switch {
+		case r == utf8.RuneError && size == 1:
+			hidden = true
+		case multiline && r == '\r' && strings.HasPrefix(text[i:], "\n"):
+		case multiline && (r == '\r' || r == '\n' || r == '\u0085' || r == '\u2028' || r == '\u2029'):
+			write('\n')
+		case multiline && (r == '\t' || r != '\v' && r != '\f' && unicode.IsSpace(r)):
+			write(r)
+		case unicode.IsSpace(r):
+			space = true
+		case r == zeroWidthJoiner || r == zeroWidthNonJoiner:
+			if space || joiner != 0 || last == 0 || unicode.IsSpace(last) {
+				hidden = true
+			} else {
+				joiner = r
+			}
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r) || invisible[r]:
+			hidden = true
+		default:
+			write(r)
+		}
+	}
+	return strings.TrimSpace(b.String()), hidden || joiner != 0
+}
+
+// joinable reports whether a zero width joiner or non-joiner joins r to the
+// character before it.
+func joinable(r rune) bool {
+	return unicode.IsGraphic(r) && !unicode.IsSpace(r) && !isMark(r)
+}
+
+// limitMarks removes the combining marks after the first max on a character.
+// It reports whether any were removed.
+func limitMarks(text string, max int) (string, bool) {
+	if max <= 0 {
+		return text, false
+	}
+	var b strings.Builder
+	excess, marks := false, 0
+	for _, r := range text {
+		if !isMark(r) {
+			marks = 0
+		} else if marks++; marks > max {
+			excess = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if !excess {
+		return text, false
+	}
+	return b.String(), true
+}
+
+func isMark(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me)
+}
@@ -0,0 +1,140 @@
+package sanitize_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/sanitize"
+)
+
+var (
+	singleLine = sanitize.Policy{MaxCombiningMarks: 4}
+	multiline  = sanitize.Policy{Multiline: true, MaxCombiningMarks: 4}
+	rejecting  = sanitize.Policy{Reject: true, MaxCombiningMarks: 4}
+)
+
+func TestNormalize(t *testing.T) {
+	type testSpec struct {
+		name          string
+		text          string
+		policy        sanitize.Policy
+		expected      string
+		expectedError error
+	}
+
+	testSpecs := []testSpec{
+		{name: "plain", text: "Gavin Thomas", policy: singleLine, expected: "Gavin Thomas"},
+		{name: "decomposed to NFC", text: "Jose\u0301 Mu\u0308ller", policy: singleLine, expected: "José Müller"},
+		{name: "Japanese to NFC", text: "か\u3099ひ\u309a", policy: singleLine, expected: "がぴ"},
+		{name: "trimmed", text: " \t Gavin \u3000", policy: singleLine, expected: "Gavin"},
+		{name: "collapsed whitespace", text: "Gavin \u00a0 \t\u2003Thomas", policy: singleLine, expected: "Gavin Thomas"},
+		{name: "line breaks in a name", text: "Gavin\r\nBcc: eve@example.com\rX\nY", policy: singleLine,
+			expected: "Gavin Bcc: eve@example.com X Y"},
+		{name: "line breaks in a message", text: "Hello\r\nthere\rfriend\n\u2028bye\u0085", policy: multiline,
+			expected: "Hello\nthere\nfriend\n\nbye"},
+		{name: "tabs and ideographic spaces in a message", text: "a\tb\u3000c", policy: multiline, expected: "a\tb\u3000c"},
+		{name: "control characters", text: "Ga\x00vi\x1bn\x7f\u0080", policy: singleLine, expected: "Gavin"},
+		{name: "bidi overrides", text: "invoice\u202egpj.exe\u202c", policy: singleLine, expected: "invoicegpj.exe"},
+		{name: "bidi isolates and marks", text: "\u2066a\u2069\u200e\u200f\u061cb", policy: singleLine, expected: "ab"},
+		{name: "zero width characters", text: "G\u200ba\ufeffv\u2060i\u00adn", policy: singleLine, expected: "Gavin"},
+		{name: "invisible letters", text: "\u3164\u115f\u2800", policy: singleLine, expected: ""},
+		{name: "invalid UTF-8", text: "Ga\xffvin\xc3", policy: singleLine, expected: "Gavin"},
+		{name: "emoji joiner", text: "\U0001F468\u200d\U0001F469\u200d\U0001F467 ❤\ufe0f\u200d\U0001F525", policy: singleLine,
+			expected: "\U0001F468\u200d\U0001F469\u200d\U0001F467 ❤\ufe0f\u200d\U0001F525"},
+		{name: "Persian non-joiner", text: "می\u200cخواهم", policy: singleLine, expected: "می\u200cخواهم"},
+		{name: "joiner before invalid UTF-8", text: "\U0001F468\u200d\xff 0", policy: singleLine, expected: "\U0001F468 0"},
+		{name: "stray joiners", text: "\u200da \u200db\u200d \u200c\u200d", policy: singleLine, expected: "a b"},
+		{name: "joiner before a mark", text: "a\u200d\u0301", policy: singleLine, expected: "\u00e1"},
+		{name: "combining marks limited", text: "Z\u0363\u0364\u0365\u0366\u0367\u0368a", policy: singleLine,
+			expected: "Z\u0363\u0364\u0365\u0366a"},
+		{name: "combining marks unlimited", text: "Z\u0363\u0364\u0365\u0366\u0367", policy: sanitize.Policy{},
+			expected: "Z\u0363\u0364\u0365\u0366\u0367"},
+		{name: "Vietnamese", text: "Nguye\u0302\u0303n", policy: singleLine, expected: "Nguyễn"},
+		{name: "rejected control", text: "bob@example.com\x00", policy: rejecting, expectedError: sanitize.ErrHiddenCharacters},
+		{name: "rejected bidi", text: "\u202ebob@example.com", policy: rejecting, expectedError: sanitize.ErrHiddenCharacters},
+		{name: "rejected invalid UTF-8", text: "bob\xff@example.com", policy: rejecting, expectedError: sanitize.ErrHiddenCharacters},
+		{name: "rejected marks", text: "b\u0300\u0301\u0302\u0303\u0304", policy: rejecting, expectedError: sanitize.ErrCombiningMarks},
+		{name: "normalised when rejecting", text: " bob@example.com\r\n", policy: rejecting, expected: "bob@example.com"},
+	}
+
+	for _, test := range testSpecs {
+		actual, err := sanitize.Normalize(test.text, test.policy)
+		if !errors.Is(err, test.expectedError) {
+			t.Errorf("%s: error actual[%v], does not match expected[%v]", test.name, err, test.expectedError)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: actual[%+q], does not match expected[%+q]", test.name, actual, test.expected)
+		}
+	}
+}
+
+func FuzzNormalize(f *testing.F) {
+	for _, seed := range []string{
+		"Gavin Thomas", "José\r\nBcc: eve@example.com", "invoice\u202egpj.exe", "G\u200ba\ufeffvin",
+		"\U0001F468\u200d\U0001F469\u200d\U0001F467", "Z\u0351\u0352\u0353\u0354\u0355\u0356", "\u0344\u0344\u0344\u0344",
+		"a\u0316\u0301\u0316\u0316\u0316\u0316", "\xff\xfe", "\u3164", "か\u3099\u3099\u3099\u3099\u3099",
+	} {
+		f.Add(seed, false, false, 4)
+		f.Add(seed, true, true, 1)
+	}
+
+	f.Fuzz(func(t *testing.T, text string, multiline, reject bool, marks int) {
+		policy := sanitize.Policy{Multiline: multiline, Reject: reject, MaxCombiningMarks: marks % 8}
+		normalized, err := sanitize.Normalize(text, policy)
+		if err != nil {
+			if !reject {
+				t.Fatalf("Normalize(%+q) returned error [%v], SHOULD only reject with a Reject policy", text, err)
+			}
+			return
+		}
+		if !utf8.ValidString(normalized) {
+			t.Errorf("Normalize(%+q) actual[%+q], SHOULD be valid UTF-8", text, normalized)
+		}
+		if !norm.NFC.IsNormalString(normalized) {
+			t.Errorf("Normalize(%+q) actual[%+q], SHOULD be NFC", text, normalized)
+		}
+		if normalized != strings.TrimSpace(normalized) {
+			t.Errorf("Normalize(%+q) actual[%+q], SHOULD be trimmed", text, normalized)
+		}
+		marksInRow := 0
+		for _, r := range normalized {
+			switch {
+			case r == '\n' || r == '\t':
+				if !multiline {
+					t.Errorf("Normalize(%+q) actual[%+q], SHOULD NOT contain %+q in single line text", text, normalized, r)
+				}
+			case r == '\r' || unicode.IsControl(r) || unicode.Is(unicode.Cf, r) && r != '\u200c' && r != '\u200d':
+				t.Errorf("Normalize(%+q) actual[%+q], SHOULD NOT contain %+q", text, normalized, r)
+			}
+			if !multiline && unicode.IsSpace(r) && r != ' ' {
+				t.Errorf("Normalize(%+q) actual[%+q], SHOULD only contain spaces in single line text", text, normalized)
+			}
+			if unicode.In(r, unicode.Mn, unicode.Me) {
+				marksInRow++
+			} else {
+				marksInRow = 0
+			}
+			if policy.MaxCombiningMarks > 0 && marksInRow > policy.MaxCombiningMarks {
+				t.Errorf("Normalize(%+q) actual[%+q], SHOULD have at most %d combining marks on a character",
+					text, normalized, policy.MaxCombiningMarks)
+			}
+		}
+		if !multiline && strings.Contains(normalized, "  ") {
+			t.Errorf("Normalize(%+q) actual[%+q], SHOULD collapse whitespace", text, normalized)
+		}
+		if again, err := sanitize.Normalize(normalized, policy); err != nil || again != normalized {
+			t.Errorf("Normalize(%+q) actual[%+q, %v], SHOULD keep normalised text [%+q]", normalized, again, err, normalized)
+		}
+		if reject {
+			policy.Reject = false
+			if stripped, _ := sanitize.Normalize(text, policy); stripped != normalized {
+				t.Errorf("Normalize(%+q) actual[%+q], SHOULD match the stripped text [%+q] when not rejected", text, normalized, stripped)
+			}
+		}
+	})
+}
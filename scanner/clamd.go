@@ -0,0 +1,94 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// clamdChunkSize is the most content sent in each INSTREAM chunk.
+const clamdChunkSize = 64 << 10
+
+// ClamdScanner sends files to ClamAV's clamd daemon with its INSTREAM command,
+// over TCP or a unix socket. Files larger than clamd's StreamMaxLength cannot
+// be scanned, so it must allow validation.MaxAttachmentBytes (the default of
+// 25 MB does).
+type ClamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+func NewClamdScanner(cfg configuration.ClamdConfiguration) *ClamdScanner {
+	return &ClamdScanner{network: cfg.Network, address: cfg.Address, timeout: cfg.Timeout}
+}
+
+// Scan opens a connection to clamd for each file, as clamd closes it after an
+// INSTREAM reply.
+func (s *ClamdScanner) Scan(ctx context.Context, content []byte) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	conn, err := s.dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	reply, err := instream(conn, content)
+	if err != nil {
+		return fmt.Errorf("scanning with clamd: %w", err)
+	}
+	return parseReply(reply)
+}
+
+// instream sends content as a zINSTREAM command: chunks prefixed by their
+// length, as 4 bytes in network order, and then a zero length chunk. It
+// returns clamd's reply.
+func instream(conn net.Conn, content []byte) (string, error) {
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	for len(content) > 0 {
+		n := min(len(content), clamdChunkSize)
+		binary.Write(w, binary.BigEndian, uint32(n))
+		w.Write(content[:n])
+		content = content[n:]
+	}
+	w.Write([]byte{0, 0, 0, 0})
+	// clamd replies, and closes the connection, as soon as a stream is too
+	// long, so its reply is read even when writing failed.
+	writeErr := w.Flush()
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		if writeErr != nil {
+			return "", writeErr
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(reply, "\x00"), nil
+}
+
+// parseReply reads a reply to INSTREAM: "stream: OK", "stream: <signature>
+// FOUND", or "<reason> ERROR".
+func parseReply(reply string) error {
+	reply = strings.TrimSpace(reply)
+	switch {
+	case reply == "stream: OK":
+		return nil
+	case strings.HasPrefix(reply, "stream: ") && strings.HasSuffix(reply, " FOUND"):
+		return &InfectedError{Signature: strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")}
+	default:
+		return fmt.Errorf("clamd replied %q", reply)
+	}
+}
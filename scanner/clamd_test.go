@@ -0,0 +1,230 @@
+package scanner_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/scanner"
+)
+
+// eicar is the EICAR anti-virus test file, which every scanner detects.
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd answers INSTREAM commands like clamd, on a local listener.
+type fakeClamd struct {
+	listener net.Listener
+	// maxLength is clamd's StreamMaxLength. Zero is unlimited.
+	maxLength int
+	// silent reads the stream, but never replies.
+	silent bool
+
+	mu       sync.Mutex
+	commands []string
+	streams  [][]byte
+}
+
+func startFakeClamd(t *testing.T, network string) *fakeClamd {
+	t.Helper()
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("net.Listen() returned error [%v]", err)
+	}
+	clamd := &fakeClamd{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go clamd.serve()
+	return clamd
+}
+
+func (f *fakeClamd) configuration() configuration.ClamdConfiguration {
+	return configuration.ClamdConfiguration{Network: f.listener.Addr().Network(), Address: f.listener.Addr().String(),
+		Timeout: time.Second}
+}
+
+func (f *fakeClamd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	f.mu.Unlock()
+	var stream []byte
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return
+		}
+		if length == 0 {
+			break
+		}
+		if f.maxLength > 0 && len(stream)+int(length) > f.maxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		stream = append(stream, chunk...)
+	}
+	f.mu.Lock()
+	f.streams = append(f.streams, stream)
+	f.mu.Unlock()
+	if f.silent {
+		io.Copy(io.Discard, conn)
+		return
+	}
+	if bytes.Contains(stream, []byte(eicar)) {
+		conn.Write([]byte("stream: Win.Test.EICAR_HDB-1 FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamdScanner(t *testing.T) {
+	type testSpec struct {
+		name              string
+		network           string
+		content           []byte
+		expectedSignature string
+	}
+
+	testSpecs := []testSpec{
+		{name: "clean over tcp", network: "tcp", content: []byte("%PDF-1.7\n")},
+		{name: "clean over a unix socket", network: "unix", content: []byte("%PDF-1.7\n")},
+		{name: "infected", network: "tcp", content: []byte(eicar), expectedSignature: "Win.Test.EICAR_HDB-1"},
+		{name: "infected over a unix socket", network: "unix", content: []byte(eicar), expectedSignature: "Win.Test.EICAR_HDB-1"},
+		{name: "in several chunks", network: "tcp", content: append(bytes.Repeat([]byte{0xff}, 200<<10), eicar...),
+			expectedSignature: "Win.Test.EICAR_HDB-1"},
+		{name: "empty", network: "tcp", content: nil},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			clamd := startFakeClamd(t, test.network)
+			err := scanner.NewClamdScanner(clamd.configuration()).Scan(context.Background(), test.content)
+
+			var infected *scanner.InfectedError
+			switch {
+			case test.expectedSignature == "" && err != nil:
+				t.Errorf("Scan() returned error [%v]", err)
+			case test.expectedSignature != "" && !errors.As(err, &infected):
+				t.Errorf("Scan() actual[%v], does not match expected[*InfectedError]", err)
+			case test.expectedSignature != "" && infected.Signature != test.expectedSignature:
+				t.Errorf("Signature actual[%s], does not match expected[%s]", infected.Signature, test.expectedSignature)
+			}
+			clamd.mu.Lock()
+			defer clamd.mu.Unlock()
+			if len(clamd.commands) != 1 || clamd.commands[0] != "zINSTREAM\x00" {
+				t.Errorf("commands actual[%q], does not match expected[[zINSTREAM\\x00]]", clamd.commands)
+			}
+			if len(clamd.streams) != 1 || !bytes.Equal(clamd.streams[0], test.content) {
+				t.Errorf("clamd SHOULD receive the content in full")
+			}
+		})
+	}
+}
+
+func TestClamdScannerUnscannable(t *testing.T) {
+	type testSpec struct {
+		name          string
+		setup         func(t *testing.T) configuration.ClamdConfiguration
+		expectedError string
+	}
+
+	testSpecs := []testSpec{
+		{
+			name: "stream too long",
+			setup: func(t *testing.T) configuration.ClamdConfiguration {
+				clamd := startFakeClamd(t, "tcp")
+				clamd.maxLength = 1 << 10
+				return clamd.configuration()
+			},
+			expectedError: "size limit exceeded",
+		},
+		{
+			name: "no reply",
+			setup: func(t *testing.T) configuration.ClamdConfiguration {
+				clamd := startFakeClamd(t, "tcp")
+				clamd.silent = true
+				cfg := clamd.configuration()
+				cfg.Timeout = 50 * time.Millisecond
+				return cfg
+			},
+			expectedError: "timeout",
+		},
+		{
+			name: "not listening",
+			setup: func(t *testing.T) configuration.ClamdConfiguration {
+				clamd := startFakeClamd(t, "tcp")
+				clamd.listener.Close()
+				return clamd.configuration()
+			},
+			expectedError: "connecting to clamd",
+		},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			err := scanner.NewClamdScanner(test.setup(t)).Scan(context.Background(), bytes.Repeat([]byte("a"), 4<<10))
+			var infected *scanner.InfectedError
+			if err == nil || errors.As(err, &infected) {
+				t.Fatalf("Scan() actual[%v], SHOULD return an error other than *InfectedError", err)
+			}
+			if !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("Scan() actual[%v], SHOULD contain [%s]", err, test.expectedError)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	type testSpec struct {
+		scanner       string
+		expectedClamd bool
+		expectedError bool
+	}
+
+	testSpecs := []testSpec{
+		{scanner: configuration.AttachmentScannerNone},
+		{scanner: configuration.AttachmentScannerClamd, expectedClamd: true},
+		{scanner: "virustotal", expectedError: true},
+	}
+
+	for _, test := range testSpecs {
+		s, err := scanner.New(&configuration.ContactFormConfiguration{AttachmentScanner: test.scanner})
+		if (err != nil) != test.expectedError {
+			t.Errorf("New(%q) error actual[%v], does not match expected[%v]", test.scanner, err, test.expectedError)
+		}
+		if _, ok := s.(*scanner.ClamdScanner); ok != test.expectedClamd {
+			t.Errorf("New(%q) actual[%T], SHOULD be a ClamdScanner: %v", test.scanner, s, test.expectedClamd)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Package scanner checks attachments for malware, before they are stored or
+// mailed.
+package scanner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// Scanner checks files for malware. Implementations must be safe for
+// concurrent use.
+type Scanner interface {
+	// Scan returns an *InfectedError when content holds malware, and any other
+	// error when it could not be scanned.
+	Scan(ctx context.Context, content []byte) error
+}
+
+// InfectedError reports the malware found in a file.
+type InfectedError struct {
+	// Signature names the malware, eg. Win.Test.EICAR_HDB-1.
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return fmt.Sprintf("malware found: %s", e.Signature)
+}
+
+// New returns the configured Scanner, or nil when attachments are not scanned.
+func New(cfg *configuration.ContactFormConfiguration) (Scanner, error) {
+	switch cfg.AttachmentScanner {
+	case configuration.AttachmentScannerNone:
+		return nil, nil
+	case configuration.AttachmentScannerClamd:
+		return NewClamdScanner(cfg.Clamd), nil
+	default:
+		return nil, fmt.Errorf("unknown attachment scanner %q", cfg.AttachmentScanner)
+	}
+}
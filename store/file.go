@@ -0,0 +1,257 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps each submission as a JSON file in a directory. It suits a
+// single instance, or a shared volume.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+	now func() time.Time
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating submission store directory: %w", err)
+	}
+	return &FileStore{dir: dir, now: time.Now}, nil
+}
+
+func (s *FileStore) Create(_ context.Context, submission *Submission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.path(submission.ID)); err == nil {
+		return fmt.Errorf("submission %s already exists", submission.ID)
+	}
+	return s.write(submission)
+}
+
+func (s *FileStore) UpdateStatus(_ context.Context, id string, status Status, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	if status == StatusSent && reportedStatuses[submission.Status] {
+		return nil
+	}
+	transition(submission, status, lastError, s.now().UTC())
+	return s.write(submission)
+}
+
+func (s *FileStore) Get(_ context.Context, id string) (*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(id)
+}
+
+func (s *FileStore) List(_ context.Context, status Status) ([]*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var submissions []*Submission
+	for _, submission := range all {
+		if submission.Status == status {
+			submissions = append(submissions, submission)
+		}
+	}
+	return submissions, nil
+}
+
+func (s *FileStore) Purge(_ context.Context, status Status, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.readAll()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, submission := range all {
+		if submission.Status != status || !submission.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(s.path(submission.ID)); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *FileStore) ListDue(_ context.Context, now time.Time, limit int) ([]*Submission, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all, err := s.readAll()
+	if err != nil {
+		return nil, err
+	}
+	var submissions []*Submission
+	for _, submission := range all {
+		if len(submissions) == limit {
+			break
+		}
+		if submission.Due(now) {
+			submissions = append(submissions, submission)
+		}
+	}
+	return submissions, nil
+}
+
+func (s *FileStore) Claim(_ context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return false, err
+	}
+	if !submission.Due(now) {
+		return false, nil
+	}
+	return true, s.claim(submission, now, leaseUntil)
+}
+
+func (s *FileStore) Retry(_ context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	transition(submission, StatusFailed, lastError, s.now().UTC())
+	submission.NextAttemptAt = nextAttemptAt
+	return s.write(submission)
+}
+
+func (s *FileStore) Release(_ context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	transition(submission, StatusFailed, lastError, s.now().UTC())
+	submission.NextAttemptAt = nextAttemptAt
+	submission.Attempts = max(submission.Attempts-1, 0)
+	return s.write(submission)
+}
+
+func (s *FileStore) ClaimDeadLetter(_ context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return false, err
+	}
+	if submission.Status != StatusDeadLetter {
+		return false, nil
+	}
+	return true, s.claim(submission, now, leaseUntil)
+}
+
+func (s *FileStore) Discard(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	submission, err := s.read(id)
+	if err != nil {
+		return false, err
+	}
+	if submission.Status != StatusDeadLetter {
+		return false, nil
+	}
+	lastError := submission.LastError
+	transition(submission, StatusDiscarded, "", s.now().UTC())
+	submission.LastError = lastError
+	return true, s.write(submission)
+}
+
+// claim moves submission to StatusSending, keeping the last error of the previous attempt.
+func (s *FileStore) claim(submission *Submission, now, leaseUntil time.Time) error {
+	lastError := submission.LastError
+	submission.Attempts++
+	transition(submission, StatusSending, "", now.UTC())
+	submission.Transitions[len(submission.Transitions)-1].Attempt = submission.Attempts
+	submission.LastError = lastError
+	submission.NextAttemptAt = leaseUntil
+	return s.write(submission)
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
+
+func (s *FileStore) read(id string) (*Submission, error) {
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var submission Submission
+	if err := json.Unmarshal(data, &submission); err != nil {
+		return nil, fmt.Errorf("reading submission %s: %w", id, err)
+	}
+	return &submission, nil
+}
+
+func (s *FileStore) readAll() ([]*Submission, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var submissions []*Submission
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		submission, err := s.read(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+	sort.Slice(submissions, func(i, j int) bool {
+		return submissions[i].CreatedAt.Before(submissions[j].CreatedAt)
+	})
+	return submissions, nil
+}
+
+// write replaces the submission file atomically, so a crash never leaves a partial file.
+func (s *FileStore) write(submission *Submission) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".submission-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(submission.ID))
+}
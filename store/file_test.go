@@ -0,0 +1,39 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+func TestFileStore(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	testSubmissionStore(t, s)
+}
+
+func TestFileStoreOutboxClaims(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	testOutboxClaims(t, s)
+}
+
+func TestFileStoreDeadLetters(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	testDeadLetters(t, s)
+}
+
+func TestFileStoreKeepsReportedStatuses(t *testing.T) {
+	s, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	testReportedStatuses(t, s)
+}
@@ -0,0 +1,31 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+)
+
+// Open returns the configured SubmissionStore, or nil when none is configured.
+func Open(ctx context.Context, cfg *configuration.ContactFormConfiguration) (SubmissionStore, error) {
+	switch cfg.SubmissionStore {
+	case configuration.SubmissionStoreNone:
+		return nil, nil
+	case configuration.SubmissionStoreFile:
+		return NewFileStore(cfg.SubmissionStoreDir)
+	case configuration.SubmissionStorePostgres:
+		return OpenPostgres(ctx, cfg.SubmissionStoreDSN)
+	default:
+		return nil, fmt.Errorf("unknown submission store %q", cfg.SubmissionStore)
+	}
+}
+
+// Retention returns the configured RetentionPolicy.
+func Retention(cfg *configuration.ContactFormConfiguration) RetentionPolicy {
+	policy := make(RetentionPolicy)
+	for status, retention := range cfg.SubmissionRetention {
+		policy[Status(status)] = retention
+	}
+	return policy
+}
@@ -0,0 +1,297 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// Registers the "pgx" database/sql driver used by OpenPostgres.
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS contact_submissions (
+	id          TEXT PRIMARY KEY,
+	request_id  TEXT NOT NULL,
+	name        TEXT NOT NULL,
+	email       TEXT NOT NULL,
+	message     TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	last_error  TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL,
+	updated_at  TIMESTAMPTZ NOT NULL,
+	transitions JSONB NOT NULL DEFAULT '[]'
+);
+CREATE INDEX IF NOT EXISTS contact_submissions_status_idx ON contact_submissions (status, updated_at);
+ALTER TABLE contact_submissions ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE contact_submissions ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS contact_submissions_due_idx ON contact_submissions (status, next_attempt_at);
+ALTER TABLE contact_submissions ADD COLUMN IF NOT EXISTS form_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE contact_submissions ADD COLUMN IF NOT EXISTS fields JSONB;
+ALTER TABLE contact_submissions ADD COLUMN IF NOT EXISTS attachments JSONB;
+`
+
+const submissionColumns = `id, request_id, name, email, message, status, last_error, created_at, updated_at, transitions,
+	attempts, next_attempt_at, form_id, fields, attachments`
+
+// dueStatuses are the statuses an outbox worker may claim, see Submission.Due.
+const dueStatuses = `('received', 'failed', 'sending')`
+
+// reportedStatusList are the reportedStatuses, which a sent update does not replace.
+const reportedStatusList = `('delivered', 'bounced', 'dropped', 'spam_reported')`
+
+// PostgresStore keeps submissions in PostgreSQL. The caller opens db with a
+// driver of its choice, such as github.com/jackc/pgx/v5/stdlib.
+type PostgresStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, now: time.Now}
+}
+
+// OpenPostgres connects to dsn with the pgx driver, and migrates the schema.
+func OpenPostgres(ctx context.Context, dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+	s := NewPostgresStore(db)
+	if err := s.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating submission store: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *PostgresStore) Close() error {
+	return s.db.Close()
+}
+
+// Migrate creates the table and index, if they do not exist.
+func (s *PostgresStore) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, postgresSchema)
+	return err
+}
+
+func (s *PostgresStore) Create(ctx context.Context, submission *Submission) error {
+	transitions, err := json.Marshal(submission.Transitions)
+	if err != nil {
+		return err
+	}
+	fields, err := json.Marshal(submission.Fields)
+	if err != nil {
+		return err
+	}
+	attachments, err := json.Marshal(submission.Attachments)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO contact_submissions (`+submissionColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+		submission.ID, submission.RequestID, submission.Name, submission.Email, submission.Message,
+		submission.Status, submission.LastError, submission.CreatedAt, submission.UpdatedAt, transitions,
+		submission.Attempts, submission.NextAttemptAt, submission.FormID, fields, attachments)
+	return err
+}
+
+func (s *PostgresStore) UpdateStatus(ctx context.Context, id string, status Status, lastError string) error {
+	now := s.now().UTC()
+	transitions, err := json.Marshal([]Transition{{Status: status, At: now, Error: lastError}})
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE contact_submissions
+		SET status = $2, last_error = $3, updated_at = $4, transitions = transitions || $5::jsonb
+		WHERE id = $1 AND NOT ($2::text = 'sent' AND status IN `+reportedStatusList+`)`,
+		id, status, lastError, now, transitions)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		// The submission is missing, or its sent update was ignored.
+		_, err := s.Get(ctx, id)
+		return err
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(ctx context.Context, id string) (*Submission, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+submissionColumns+` FROM contact_submissions WHERE id = $1`, id)
+	submission, err := scanSubmission(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return submission, err
+}
+
+func (s *PostgresStore) List(ctx context.Context, status Status) ([]*Submission, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+submissionColumns+` FROM contact_submissions WHERE status = $1 ORDER BY created_at`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var submissions []*Submission
+	for rows.Next() {
+		submission, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, rows.Err()
+}
+
+func (s *PostgresStore) Purge(ctx context.Context, status Status, cutoff time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM contact_submissions WHERE status = $1 AND updated_at < $2`, status, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *PostgresStore) ListDue(ctx context.Context, now time.Time, limit int) ([]*Submission, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+submissionColumns+` FROM contact_submissions
+		WHERE status IN `+dueStatuses+` AND next_attempt_at <= $1 ORDER BY created_at LIMIT $2`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var submissions []*Submission
+	for rows.Next() {
+		submission, err := scanSubmission(rows)
+		if err != nil {
+			return nil, err
+		}
+		submissions = append(submissions, submission)
+	}
+	return submissions, rows.Err()
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	return s.claim(ctx, id, `status IN `+dueStatuses+` AND next_attempt_at <= $2`, now, leaseUntil)
+}
+
+func (s *PostgresStore) ClaimDeadLetter(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error) {
+	return s.claim(ctx, id, `status = 'dead_letter'`, now, leaseUntil)
+}
+
+// claim moves the submission to sending when condition holds, numbering the
+// attempt in its transition.
+func (s *PostgresStore) claim(ctx context.Context, id, condition string, now, leaseUntil time.Time) (bool, error) {
+	transition, err := json.Marshal(Transition{Status: StatusSending, At: now.UTC()})
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE contact_submissions
+		SET status = 'sending', attempts = attempts + 1, next_attempt_at = $3, updated_at = $2,
+			transitions = transitions || jsonb_build_array($4::jsonb || jsonb_build_object('attempt', attempts + 1))
+		WHERE id = $1 AND `+condition,
+		id, now.UTC(), leaseUntil, transition)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *PostgresStore) Discard(ctx context.Context, id string) (bool, error) {
+	now := s.now().UTC()
+	transitions, err := json.Marshal([]Transition{{Status: StatusDiscarded, At: now}})
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE contact_submissions
+		SET status = 'discarded', updated_at = $2, transitions = transitions || $3::jsonb
+		WHERE id = $1 AND status = 'dead_letter'`,
+		id, now, transitions)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func (s *PostgresStore) Retry(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	now := s.now().UTC()
+	transitions, err := json.Marshal([]Transition{{Status: StatusFailed, At: now, Error: lastError}})
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE contact_submissions
+		SET status = 'failed', last_error = $2, updated_at = $3, next_attempt_at = $4,
+			transitions = transitions || $5::jsonb
+		WHERE id = $1`,
+		id, lastError, now, nextAttemptAt, transitions)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStore) Release(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error {
+	now := s.now().UTC()
+	transitions, err := json.Marshal([]Transition{{Status: StatusFailed, At: now, Error: lastError}})
+	if err != nil {
+		return err
+	}
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE contact_submissions
+		SET status = 'failed', last_error = $2, updated_at = $3, next_attempt_at = $4, attempts = GREATEST(attempts - 1, 0),
+			transitions = transitions || $5::jsonb
+		WHERE id = $1`,
+		id, lastError, now, nextAttemptAt, transitions)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubmission(row scanner) (*Submission, error) {
+	var submission Submission
+	var transitions, fields, attachments []byte
+	err := row.Scan(&submission.ID, &submission.RequestID, &submission.Name, &submission.Email, &submission.Message,
+		&submission.Status, &submission.LastError, &submission.CreatedAt, &submission.UpdatedAt, &transitions,
+		&submission.Attempts, &submission.NextAttemptAt, &submission.FormID, &fields, &attachments)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(transitions, &submission.Transitions); err != nil {
+		return nil, fmt.Errorf("reading transitions of submission %s: %w", submission.ID, err)
+	}
+	if len(fields) > 0 {
+		if err := json.Unmarshal(fields, &submission.Fields); err != nil {
+			return nil, fmt.Errorf("reading fields of submission %s: %w", submission.ID, err)
+		}
+	}
+	if len(attachments) > 0 {
+		if err := json.Unmarshal(attachments, &submission.Attachments); err != nil {
+			return nil, fmt.Errorf("reading attachments of submission %s: %w", submission.ID, err)
+		}
+	}
+	return &submission, nil
+}
@@ -0,0 +1,197 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+)
+
+// Status of a submission. Submissions start as StatusReceived.
+type Status string
+
+const (
+	StatusReceived Status = "received"
+	// StatusSending is a submission claimed by an outbox worker.
+	StatusSending Status = "sending"
+	StatusSent    Status = "sent"
+	StatusFailed  Status = "failed"
+	// StatusQuarantined is a submission rejected for malware. It is never sent.
+	StatusQuarantined Status = "quarantined"
+	// StatusDeadLetter is a submission whose delivery attempts are exhausted.
+	// It stays there until it is replayed or discarded.
+	StatusDeadLetter Status = "dead_letter"
+	// StatusDiscarded is a dead-lettered submission that will not be sent.
+	StatusDiscarded Status = "discarded"
+	// StatusDelivered, StatusBounced, StatusDropped and StatusSpamReported are
+	// reported by SendGrid's Event Webhook, after the email was sent.
+	StatusDelivered    Status = "delivered"
+	StatusBounced      Status = "bounced"
+	StatusDropped      Status = "dropped"
+	StatusSpamReported Status = "spam_reported"
+)
+
+// Statuses lists every Status.
+var Statuses = []Status{StatusReceived, StatusSending, StatusSent, StatusFailed, StatusQuarantined, StatusDeadLetter,
+	StatusDiscarded, StatusDelivered, StatusBounced, StatusDropped, StatusSpamReported}
+
+// reportedStatuses are reported by provider events after the email was sent.
+// An event can arrive before its sender records StatusSent, so UpdateStatus
+// never moves them back to StatusSent.
+var reportedStatuses = map[Status]bool{StatusDelivered: true, StatusBounced: true, StatusDropped: true, StatusSpamReported: true}
+
+var ErrNotFound = errors.New("submission not found")
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the ID of the submission being mailed, so
+// mailers can correlate provider events with it.
+func NewContext(ctx context.Context, submissionID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, submissionID)
+}
+
+// IDFromContext returns the submission ID stored in ctx, or "" if there is none.
+func IDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Transition records a change of status.
+type Transition struct {
+	Status Status    `json:"status"`
+	At     time.Time `json:"at"`
+	Error  string    `json:"error,omitempty"`
+	// Attempt numbers the delivery attempt started by a StatusSending transition.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Submission is a contact form request that passed validation.
+type Submission struct {
+	ID        string            `json:"id"`
+	RequestID string            `json:"requestId"`
+	Name      string            `json:"name"`
+	Email     string            `json:"email"`
+	Message   string            `json:"message"`
+	FormID    string            `json:"formId,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	// Attachments are kept until the submission is purged, to send them again.
+	Attachments []api.Attachment `json:"attachments,omitempty"`
+	Status      Status           `json:"status"`
+	LastError   string           `json:"lastError,omitempty"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+	Transitions []Transition     `json:"transitions"`
+	// Attempts counts the claims by outbox workers.
+	Attempts int `json:"attempts"`
+	// NextAttemptAt is when an outbox worker may next claim the submission. For
+	// StatusSending, it is when the claim expires.
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+}
+
+// NewSubmission returns a received submission for request.
+func NewSubmission(request *api.EmailFormRequest, requestID string, now time.Time) *Submission {
+	return &Submission{
+		ID:            requestid.New(),
+		RequestID:     requestID,
+		Name:          request.Name,
+		Email:         request.Email,
+		Message:       request.Message,
+		FormID:        request.FormID,
+		Fields:        request.Fields,
+		Attachments:   request.Attachments,
+		Status:        StatusReceived,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+		Transitions:   []Transition{{Status: StatusReceived, At: now}},
+		NextAttemptAt: now,
+	}
+}
+
+// Quarantine moves a new submission to StatusQuarantined, for reason, eg. the
+// malware signature found. Its attachments are dropped, so malware is never
+// stored.
+func (s *Submission) Quarantine(reason string, now time.Time) {
+	s.Attachments = nil
+	transition(s, StatusQuarantined, reason, now)
+}
+
+// Due reports whether an outbox worker may claim the submission at now.
+func (s *Submission) Due(now time.Time) bool {
+	switch s.Status {
+	case StatusReceived, StatusFailed, StatusSending:
+		return !s.NextAttemptAt.After(now)
+	default:
+		return false
+	}
+}
+
+// Request rebuilds the contact form request, eg. to send it again.
+func (s *Submission) Request() *api.EmailFormRequest {
+	return &api.EmailFormRequest{Name: s.Name, Email: s.Email, Message: s.Message, FormID: s.FormID, Fields: s.Fields,
+		Attachments: s.Attachments}
+}
+
+// SubmissionStore persists submissions, so a message is never only in a log line.
+type SubmissionStore interface {
+	// Create stores a new submission.
+	Create(ctx context.Context, submission *Submission) error
+	// UpdateStatus appends a transition to status, and records lastError. It
+	// ignores StatusSent for a submission whose delivery events already arrived.
+	UpdateStatus(ctx context.Context, id string, status Status, lastError string) error
+	// Get returns the submission, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Submission, error)
+	// List returns the submissions with status, oldest first.
+	List(ctx context.Context, status Status) ([]*Submission, error)
+	// Purge deletes submissions with status last updated before cutoff, and returns the count.
+	Purge(ctx context.Context, status Status, cutoff time.Time) (int, error)
+	// ListDue returns up to limit submissions that are Due at now, oldest first.
+	ListDue(ctx context.Context, now time.Time, limit int) ([]*Submission, error)
+	// Claim moves a Due submission to StatusSending until leaseUntil, and counts
+	// the attempt. It returns false when the submission is no longer Due, eg.
+	// because another worker claimed it first.
+	Claim(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error)
+	// Retry moves a submission to StatusFailed, to be claimed again at nextAttemptAt.
+	Retry(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error
+	// Release is Retry for a claim whose attempt never reached the provider,
+	// eg. while its circuit breaker is open, so the attempt is not counted.
+	Release(ctx context.Context, id string, lastError string, nextAttemptAt time.Time) error
+	// ClaimDeadLetter is Claim for a StatusDeadLetter submission, eg. to replay
+	// it. It returns false when the submission is not dead-lettered.
+	ClaimDeadLetter(ctx context.Context, id string, now, leaseUntil time.Time) (bool, error)
+	// Discard moves a StatusDeadLetter submission to StatusDiscarded. It returns
+	// false when the submission is not dead-lettered.
+	Discard(ctx context.Context, id string) (bool, error)
+}
+
+// RetentionPolicy is how long submissions are kept, by status. Zero keeps them forever.
+type RetentionPolicy map[Status]time.Duration
+
+// PurgeExpired applies policy to s, and returns the number of deleted submissions.
+func PurgeExpired(ctx context.Context, s SubmissionStore, policy RetentionPolicy, now time.Time) (int, error) {
+	purged := 0
+	for _, status := range Statuses {
+		retention := policy[status]
+		if retention <= 0 {
+			continue
+		}
+		n, err := s.Purge(ctx, status, now.Add(-retention))
+		purged += n
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// transition applies a status change to submission.
+func transition(submission *Submission, status Status, lastError string, now time.Time) {
+	submission.Status = status
+	submission.LastError = lastError
+	submission.UpdatedAt = now
+	submission.Transitions = append(submission.Transitions, Transition{Status: status, At: now, Error: lastError})
+}
@@ -0,0 +1,259 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+// testSubmissionStore checks the SubmissionStore contract, for every implementation.
+func testSubmissionStore(t *testing.T, s store.SubmissionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	request := &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+
+	submission := store.NewSubmission(request, "req-123", now)
+	if err := s.Create(ctx, submission); err != nil {
+		t.Fatalf("Create() returned error [%v]", err)
+	}
+
+	got, err := s.Get(ctx, submission.ID)
+	if err != nil {
+		t.Fatalf("Get() returned error [%v]", err)
+	}
+	if got.Status != store.StatusReceived || got.Email != "test@example.com" || got.RequestID != "req-123" {
+		t.Errorf("Get() actual[%+v], does not match created submission", got)
+	}
+
+	withFields := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello",
+		FormID: "wedding-enquiry", Fields: map[string]string{"venue": "Kyoto"},
+		Attachments: []api.Attachment{{Filename: "venue.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.7\n")}}},
+		"req-fields", now)
+	if err := s.Create(ctx, withFields); err != nil {
+		t.Fatalf("Create() returned error [%v]", err)
+	}
+	got, _ = s.Get(ctx, withFields.ID)
+	if !reflect.DeepEqual(got.Request(), withFields.Request()) {
+		t.Errorf("Get().Request() actual[%+v], does not match expected[%+v]", got.Request(), withFields.Request())
+	}
+	if err := s.UpdateStatus(ctx, withFields.ID, store.StatusSent, ""); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+
+	if err := s.UpdateStatus(ctx, submission.ID, store.StatusFailed, "error sending email"); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+	if err := s.UpdateStatus(ctx, submission.ID, store.StatusSent, ""); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+	got, _ = s.Get(ctx, submission.ID)
+	if got.Status != store.StatusSent {
+		t.Errorf("Status actual[%s], does not match expected[%s]", got.Status, store.StatusSent)
+	}
+	expectedStatuses := []store.Status{store.StatusReceived, store.StatusFailed, store.StatusSent}
+	if len(got.Transitions) != len(expectedStatuses) {
+		t.Fatalf("len(Transitions) actual[%d], does not match expected[%d]", len(got.Transitions), len(expectedStatuses))
+	}
+	for i, status := range expectedStatuses {
+		if got.Transitions[i].Status != status {
+			t.Errorf("Transitions[%d] actual[%s], does not match expected[%s]", i, got.Transitions[i].Status, status)
+		}
+	}
+	if got.Transitions[1].Error != "error sending email" {
+		t.Errorf("Transitions[1].Error actual[%s], does not match expected[%s]", got.Transitions[1].Error, "error sending email")
+	}
+
+	if err := s.UpdateStatus(ctx, "missing", store.StatusSent, ""); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateStatus(missing) actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+	if _, err := s.Get(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get(missing) actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+
+	old := store.NewSubmission(request, "req-old", now.Add(-48*time.Hour))
+	if err := s.Create(ctx, old); err != nil {
+		t.Fatalf("Create() returned error [%v]", err)
+	}
+	received, err := s.List(ctx, store.StatusReceived)
+	if err != nil || len(received) != 1 || received[0].ID != old.ID {
+		t.Errorf("List(received) actual[%v, %v], SHOULD only contain the old submission", received, err)
+	}
+
+	purged, err := store.PurgeExpired(ctx, s, store.RetentionPolicy{store.StatusReceived: 24 * time.Hour}, now)
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeExpired() actual[%d, %v], does not match expected[1, <nil>]", purged, err)
+	}
+	if _, err := s.Get(ctx, old.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get(purged) actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+	if _, err := s.Get(ctx, submission.ID); err != nil {
+		t.Errorf("Get() SHOULD keep submissions without a retention period, got [%v]", err)
+	}
+}
+
+// testOutboxClaims checks the claim/retry contract used by outbox workers.
+func testOutboxClaims(t *testing.T, s store.SubmissionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	request := &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+
+	submission := store.NewSubmission(request, "req-outbox", now)
+	if err := s.Create(ctx, submission); err != nil {
+		t.Fatalf("Create() returned error [%v]", err)
+	}
+
+	due, err := s.ListDue(ctx, now, 10)
+	if err != nil || len(due) != 1 || due[0].ID != submission.ID {
+		t.Fatalf("ListDue() actual[%v, %v], SHOULD contain the received submission", due, err)
+	}
+
+	claimed, err := s.Claim(ctx, submission.ID, now, now.Add(time.Minute))
+	if err != nil || !claimed {
+		t.Fatalf("Claim() actual[%v, %v], does not match expected[true, <nil>]", claimed, err)
+	}
+	claimed, err = s.Claim(ctx, submission.ID, now, now.Add(time.Minute))
+	if err != nil || claimed {
+		t.Errorf("second Claim() actual[%v, %v], does not match expected[false, <nil>]", claimed, err)
+	}
+	if due, _ := s.ListDue(ctx, now, 10); len(due) != 0 {
+		t.Errorf("ListDue() SHOULD NOT contain claimed submissions, got [%d]", len(due))
+	}
+	if due, _ := s.ListDue(ctx, now.Add(2*time.Minute), 10); len(due) != 1 {
+		t.Errorf("ListDue() SHOULD contain submissions with an expired claim, got [%d]", len(due))
+	}
+
+	if err := s.Retry(ctx, submission.ID, "provider unavailable", now.Add(time.Hour)); err != nil {
+		t.Fatalf("Retry() returned error [%v]", err)
+	}
+	got, _ := s.Get(ctx, submission.ID)
+	if got.Status != store.StatusFailed || got.Attempts != 1 || got.LastError != "provider unavailable" {
+		t.Errorf("after Retry() actual[%+v], SHOULD be failed after 1 attempt", got)
+	}
+	if due, _ := s.ListDue(ctx, now.Add(30*time.Minute), 10); len(due) != 0 {
+		t.Errorf("ListDue() SHOULD NOT contain submissions before their next attempt, got [%d]", len(due))
+	}
+	claimed, err = s.Claim(ctx, submission.ID, now.Add(time.Hour), now.Add(time.Hour+time.Minute))
+	if err != nil || !claimed {
+		t.Errorf("Claim() after the retry time actual[%v, %v], does not match expected[true, <nil>]", claimed, err)
+	}
+
+	if err := s.Release(ctx, submission.ID, "mail circuit breaker is open", now.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Release() returned error [%v]", err)
+	}
+	got, _ = s.Get(ctx, submission.ID)
+	if got.Status != store.StatusFailed || got.Attempts != 1 || !got.NextAttemptAt.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("after Release() actual[%+v], SHOULD be failed after 1 attempt, until the release time", got)
+	}
+	claimed, err = s.Claim(ctx, submission.ID, now.Add(2*time.Hour), now.Add(2*time.Hour+time.Minute))
+	if err != nil || !claimed {
+		t.Errorf("Claim() after the release time actual[%v, %v], does not match expected[true, <nil>]", claimed, err)
+	}
+
+	if err := s.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "provider unavailable"); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+	if due, _ := s.ListDue(ctx, now.Add(24*time.Hour), 10); len(due) != 0 {
+		t.Errorf("ListDue() SHOULD NOT contain dead-lettered submissions, got [%d]", len(due))
+	}
+
+	got, _ = s.Get(ctx, submission.ID)
+	var attempts []int
+	for _, transition := range got.Transitions {
+		if transition.Status == store.StatusSending {
+			attempts = append(attempts, transition.Attempt)
+		}
+	}
+	// The released attempt is numbered again.
+	if !reflect.DeepEqual(attempts, []int{1, 2, 2}) {
+		t.Errorf("sending transition attempts actual[%v], does not match expected[[1 2 2]]", attempts)
+	}
+}
+
+func testDeadLetters(t *testing.T, s store.SubmissionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	request := &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+
+	replayed := store.NewSubmission(request, "req-replay", now)
+	discarded := store.NewSubmission(request, "req-discard", now)
+	for _, submission := range []*store.Submission{replayed, discarded} {
+		if err := s.Create(ctx, submission); err != nil {
+			t.Fatalf("Create() returned error [%v]", err)
+		}
+		if claimed, err := s.ClaimDeadLetter(ctx, submission.ID, now, now.Add(time.Minute)); err != nil || claimed {
+			t.Errorf("ClaimDeadLetter() of a received submission actual[%v, %v], does not match expected[false, <nil>]", claimed, err)
+		}
+		if ok, err := s.Discard(ctx, submission.ID); err != nil || ok {
+			t.Errorf("Discard() of a received submission actual[%v, %v], does not match expected[false, <nil>]", ok, err)
+		}
+		if err := s.UpdateStatus(ctx, submission.ID, store.StatusDeadLetter, "provider unavailable"); err != nil {
+			t.Fatalf("UpdateStatus() returned error [%v]", err)
+		}
+	}
+
+	claimed, err := s.ClaimDeadLetter(ctx, replayed.ID, now, now.Add(time.Minute))
+	if err != nil || !claimed {
+		t.Fatalf("ClaimDeadLetter() actual[%v, %v], does not match expected[true, <nil>]", claimed, err)
+	}
+	claimed, err = s.ClaimDeadLetter(ctx, replayed.ID, now, now.Add(time.Minute))
+	if err != nil || claimed {
+		t.Errorf("second ClaimDeadLetter() actual[%v, %v], does not match expected[false, <nil>]", claimed, err)
+	}
+	got, _ := s.Get(ctx, replayed.ID)
+	if got.Status != store.StatusSending || got.Attempts != 1 || got.LastError != "provider unavailable" {
+		t.Errorf("after ClaimDeadLetter() actual[%+v], SHOULD be sending and keep the last error", got)
+	}
+
+	ok, err := s.Discard(ctx, discarded.ID)
+	if err != nil || !ok {
+		t.Fatalf("Discard() actual[%v, %v], does not match expected[true, <nil>]", ok, err)
+	}
+	ok, err = s.Discard(ctx, discarded.ID)
+	if err != nil || ok {
+		t.Errorf("second Discard() actual[%v, %v], does not match expected[false, <nil>]", ok, err)
+	}
+	got, _ = s.Get(ctx, discarded.ID)
+	if got.Status != store.StatusDiscarded || got.LastError != "provider unavailable" {
+		t.Errorf("after Discard() actual[%+v], SHOULD be discarded and keep the last error", got)
+	}
+	if deadLetters, _ := s.List(ctx, store.StatusDeadLetter); len(deadLetters) != 0 {
+		t.Errorf("List(dead_letter) actual[%d], does not match expected[0]", len(deadLetters))
+	}
+}
+
+// testReportedStatuses checks that provider events arriving before the sender
+// records the email sent are kept.
+func testReportedStatuses(t *testing.T, s store.SubmissionStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	request := &api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "This is a test message."}
+
+	for _, status := range []store.Status{store.StatusDelivered, store.StatusBounced, store.StatusDropped, store.StatusSpamReported} {
+		submission := store.NewSubmission(request, "req-reported", now)
+		if err := s.Create(ctx, submission); err != nil {
+			t.Fatalf("Create() returned error [%v]", err)
+		}
+		if err := s.UpdateStatus(ctx, submission.ID, store.StatusSending, ""); err != nil {
+			t.Fatalf("UpdateStatus() returned error [%v]", err)
+		}
+		if err := s.UpdateStatus(ctx, submission.ID, status, ""); err != nil {
+			t.Fatalf("UpdateStatus() returned error [%v]", err)
+		}
+		if err := s.UpdateStatus(ctx, submission.ID, store.StatusSent, ""); err != nil {
+			t.Errorf("%s: UpdateStatus(sent) returned error [%v]", status, err)
+		}
+		got, _ := s.Get(ctx, submission.ID)
+		if got.Status != status || len(got.Transitions) != 3 {
+			t.Errorf("%s: after UpdateStatus(sent) actual[%s, %d transitions], SHOULD keep the event status",
+				status, got.Status, len(got.Transitions))
+		}
+	}
+	if err := s.UpdateStatus(ctx, "missing", store.StatusSent, ""); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("UpdateStatus() of a missing submission actual[%v], does not match expected[%v]", err, store.ErrNotFound)
+	}
+}
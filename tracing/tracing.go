@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the spans created by this module.
+const InstrumentationName = "github.com/ippoippo/ippoippophotography-com-functions-contact"
+
+// Span attribute keys. Values must never contain personal data.
+const (
+	AttrOutcome        = attribute.Key("contact.outcome")
+	AttrStatusCode     = attribute.Key("http.response.status_code")
+	AttrRequestID      = attribute.Key("contact.request_id")
+	AttrInvalidFields  = attribute.Key("contact.validation.invalid_fields")
+	AttrProvider       = attribute.Key("contact.mail.provider")
+	AttrProviderStatus = attribute.Key("contact.mail.provider_status_code")
+	AttrErrorType      = attribute.Key("exception.type")
+)
+
+var propagator = propagation.TraceContext{}
+
+// Tracer returns the tracer from tp, or from the global provider when tp is nil.
+func Tracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(InstrumentationName)
+}
+
+// Extract returns ctx with the remote span context from the W3C traceparent
+// and tracestate headers, so frontend traces continue into the function.
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	carrier := propagation.MapCarrier{}
+	for key, value := range headers {
+		carrier.Set(key, value)
+	}
+	return propagator.Extract(ctx, carrier)
+}
+
+// EndWithError records the type of err on the span, marks it failed, and ends
+// it. The message is left out, as it may hold personal data, eg. attachment
+// filenames or a provider's response naming the recipient.
+func EndWithError(span trace.Span, err error) {
+	if err != nil {
+		errorType := ErrorType(err)
+		span.AddEvent("exception", trace.WithAttributes(AttrErrorType.String(errorType)))
+		span.SetStatus(codes.Error, errorType)
+	}
+	span.End()
+}
+
+// ErrorType names the type of err, eg. "*mailer.ProviderError", skipping the
+// errors wrapping it with fmt.Errorf.
+func ErrorType(err error) string {
+	for {
+		name := fmt.Sprintf("%T", err)
+		next := errors.Unwrap(err)
+		if name != "*fmt.wrapError" || next == nil {
+			return name
+		}
+		err = next
+	}
+}
+
+// Transport traces outbound HTTP requests with client spans, and propagates
+// the trace context to the server.
+func Transport(base http.RoundTripper, tp trace.TracerProvider) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, tracer: Tracer(tp)}
+}
+
+type transport struct {
+	base   http.RoundTripper
+	tracer trace.Tracer
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		))
+	req = req.Clone(ctx)
+	propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		EndWithError(span, err)
+		return nil, err
+	}
+	span.SetAttributes(AttrStatusCode.Int(res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+	span.End()
+	return res, nil
+}
@@ -0,0 +1,115 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/tracing"
+)
+
+const incomingTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestExtractContinuesIncomingTrace(t *testing.T) {
+	ctx := tracing.Extract(context.Background(), map[string]string{"traceparent": incomingTraceparent})
+	spanContext := trace.SpanContextFromContext(ctx)
+	if actual := spanContext.TraceID().String(); actual != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceID() actual[%s], does not match expected[%s]", actual, "4bf92f3577b34da6a3ce929d0e0e4736")
+	}
+	if !spanContext.IsRemote() {
+		t.Error("IsRemote() SHOULD be true")
+	}
+}
+
+func TestExtractWithoutTraceparent(t *testing.T) {
+	ctx := tracing.Extract(context.Background(), map[string]string{"accept": "application/json"})
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("Extract() SHOULD NOT create a span context without traceparent")
+	}
+}
+
+func TestTransportTracesAndPropagates(t *testing.T) {
+	var receivedTraceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	client := &http.Client{Transport: tracing.Transport(nil, tp)}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/v3/mail/send?key=secret", nil)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("client.Do() returned error [%v]", err)
+	}
+	res.Body.Close()
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("len(Ended()) actual[%d], does not match expected[1]", len(spans))
+	}
+	span := spans[0]
+	if span.SpanKind() != trace.SpanKindClient {
+		t.Errorf("SpanKind() actual[%v], does not match expected[%v]", span.SpanKind(), trace.SpanKindClient)
+	}
+	if receivedTraceparent == "" || receivedTraceparent[3:35] != span.SpanContext().TraceID().String() {
+		t.Errorf("traceparent [%s] SHOULD carry trace ID [%s]", receivedTraceparent, span.SpanContext().TraceID())
+	}
+	attrs := make(map[string]string)
+	for _, attr := range span.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if attrs["http.response.status_code"] != "202" {
+		t.Errorf("http.response.status_code actual[%s], does not match expected[202]", attrs["http.response.status_code"])
+	}
+	if attrs["url.path"] != "/v3/mail/send" {
+		t.Errorf("url.path actual[%s], does not match expected[/v3/mail/send]", attrs["url.path"])
+	}
+}
+
+func TestEndWithErrorRecordsOnlyErrorType(t *testing.T) {
+	type testSpec struct {
+		err      error
+		expected string
+	}
+
+	testSpecs := []testSpec{
+		{err: errors.New("bob@example.com"), expected: "*errors.errorString"},
+		{err: fmt.Errorf("processing attachment bob.jpg: %w", &net.DNSError{Err: "bob"}), expected: "*net.DNSError"},
+		{err: fmt.Errorf("sending to bob@example.com: %w", fmt.Errorf("again bob: %w", context.Canceled)), expected: "*errors.errorString"},
+	}
+
+	for _, test := range testSpecs {
+		recorder := tracetest.NewSpanRecorder()
+		tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		_, span := tracing.Tracer(tp).Start(context.Background(), "test")
+		tracing.EndWithError(span, test.err)
+
+		ended := recorder.Ended()[0]
+		if ended.Status().Code != codes.Error || ended.Status().Description != test.expected {
+			t.Errorf("%v: status actual[%v, %s], does not match expected[Error, %s]", test.err,
+				ended.Status().Code, ended.Status().Description, test.expected)
+		}
+		for _, event := range ended.Events() {
+			for _, attr := range event.Attributes {
+				if strings.Contains(attr.Value.Emit(), "bob") {
+					t.Errorf("%v: event %s attribute %s actual[%s], SHOULD NOT contain the message", test.err,
+						event.Name, attr.Key, attr.Value.Emit())
+				}
+			}
+		}
+	}
+}
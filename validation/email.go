@@ -0,0 +1,201 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// Email address limits, from RFC 5321.
+const (
+	MaxEmailLength      = 254
+	MaxLocalPartLength  = 64
+	MaxDomainLength     = 253
+	MaxDomainLabelBytes = 63
+)
+
+// DefaultLookupTimeout bounds the mail server lookup of an email domain.
+const DefaultLookupTimeout = 2 * time.Second
+
+// Resolver looks up the mail servers of a domain. *net.Resolver implements it.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DisposableDomains are well-known disposable email services, used unless
+// WithDisposableDomains replaces them. Their subdomains are disposable too.
+var DisposableDomains = []string{
+	"10minutemail.com", "discard.email", "dispostable.com", "emailondeck.com", "fakeinbox.com", "getnada.com",
+	"guerrillamail.com", "guerrillamail.net", "mailinator.com", "maildrop.cc", "mailnesia.com", "mintemail.com",
+	"mohmal.com", "sharklasers.com", "temp-mail.org", "tempmail.com", "throwawaymail.com", "trashmail.com",
+	"yopmail.com",
+}
+
+// commonDomains are mailbox providers whose misspellings are suggested, eg.
+// gmial.com. Similar domains that are real providers themselves are listed
+// too, so they are not taken for typos.
+var commonDomains = []string{
+	"gmail.com", "googlemail.com", "yahoo.com", "ymail.com", "yahoo.co.jp", "yahoo.co.uk", "hotmail.com",
+	"hotmail.co.jp", "hotmail.co.uk", "hotmail.co.nz", "hotmail.com.au", "hotmail.fr", "hotmail.de", "hotmail.it",
+	"outlook.com", "outlook.jp", "outlook.co.jp", "outlook.fr", "outlook.de", "live.com", "live.jp", "live.co.uk",
+	"msn.com", "icloud.com", "me.com", "mac.com", "aol.com", "mail.com", "email.com", "gmx.com", "gmx.de",
+	"protonmail.com", "proton.me", "btinternet.com", "docomo.ne.jp", "ezweb.ne.jp", "au.com", "softbank.ne.jp",
+	"i.softbank.jp",
+}
+
+// emailAddress is a bare addr-spec, with its domain in ASCII (punycode).
+type emailAddress struct {
+	local  string
+	domain string
+}
+
+func (a emailAddress) String() string {
+	return a.local + "@" + a.domain
+}
+
+// parseEmail parses a bare addr-spec, such as bob@example.com, rejecting the
+// display names, angle brackets and comments net/mail also accepts, and IP
+// address literals. Internationalised domains are converted to ASCII.
+func parseEmail(email string) (emailAddress, bool) {
+	email = strings.TrimSpace(email)
+	if len(email) > MaxEmailLength*4 {
+		return emailAddress{}, false
+	}
+	parsed, err := mail.ParseAddress(email)
+	if err != nil || parsed.Name != "" || parsed.Address != email {
+		return emailAddress{}, false
+	}
+	at := strings.LastIndexByte(email, '@')
+	local, domain := email[:at], email[at+1:]
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil || len(local) > MaxLocalPartLength || !validDomain(ascii) {
+		return emailAddress{}, false
+	}
+	address := emailAddress{local: local, domain: ascii}
+	return address, len(address.String()) <= MaxEmailLength
+}
+
+// validDomain reports whether domain is a host name of at least two labels,
+// of letters, digits and hyphens, and not a numeric top level domain.
+func validDomain(domain string) bool {
+	labels := strings.Split(domain, ".")
+	if len(domain) > MaxDomainLength || len(labels) < 2 {
+		return false
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > MaxDomainLabelBytes || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return false
+			}
+		}
+	}
+	return strings.Trim(labels[len(labels)-1], "0123456789") != ""
+}
+
+// matchesDomain reports whether domain is one of domains, or their subdomain.
+func matchesDomain(domain string, domains []string) bool {
+	domain = strings.ToLower(domain)
+	for _, candidate := range domains {
+		if domain == candidate || strings.HasSuffix(domain, "."+candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestDomain returns the common domain that domain is likely a misspelling
+// of, or "". Up to one edit is a typo, or two in longer domains.
+func suggestDomain(domain string) string {
+	domain = strings.ToLower(domain)
+	maxEdits := 1
+	if len(domain) >= 12 {
+		maxEdits = 2
+	}
+	if len(domain) < 6 || matchesDomain(domain, commonDomains) {
+		return ""
+	}
+	suggestion, closest := "", maxEdits+1
+	for _, candidate := range commonDomains {
+		if sameProvider(domain, candidate) {
+			return ""
+		}
+		if edits := editDistance(domain, candidate); edits < closest {
+			suggestion, closest = candidate, edits
+		}
+	}
+	return suggestion
+}
+
+// sameProvider reports whether domain is candidate's provider in another
+// country, eg. hotmail.co.nz for hotmail.co.uk: the same name under a real
+// public suffix, rather than a misspelling of it.
+func sameProvider(domain, candidate string) bool {
+	suffix, icann := publicsuffix.PublicSuffix(domain)
+	if !icann {
+		return false
+	}
+	name := strings.TrimSuffix(domain, "."+suffix)
+	candidateSuffix, _ := publicsuffix.PublicSuffix(candidate)
+	return name != domain && name == strings.TrimSuffix(candidate, "."+candidateSuffix)
+}
+
+// editDistance is the optimal string alignment distance between a and b: the
+// insertions, deletions, substitutions and transpositions of adjacent bytes
+// that turn a into b.
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(a)][len(b)]
+}
+
+// receivesEmail reports whether domain has mail servers: MX records, or else
+// an address record, as RFC 5321 falls back to. A null MX (RFC 7505) accepts
+// no email. Lookups that fail for any reason other than the domain not
+// existing accept it, so a DNS outage does not reject visitors.
+func receivesEmail(ctx context.Context, resolver Resolver, domain string) bool {
+	records, err := resolver.LookupMX(ctx, domain)
+	if err == nil && len(records) > 0 {
+		return !(len(records) == 1 && (records[0].Host == "." || records[0].Host == ""))
+	}
+	if err != nil && !isNotFound(err) {
+		return true
+	}
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		return !isNotFound(err)
+	}
+	return len(hosts) > 0
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,224 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+const (
+	invalidEmail     = "email must be a valid email address"
+	disposableEmail  = "email must not be a disposable email address"
+	undeliverableMsg = "email must be an address that can receive email"
+)
+
+func emailError(t *testing.T, email string, opts ...validation.Option) string {
+	t.Helper()
+	validator := validation.NewContactFormValidator(opts...)
+	validator.Check(&api.EmailFormRequest{Name: "Gavin Thomas", Email: email, Message: "Valid Message"})
+	return validator.FieldErrors()[validation.EmailField]
+}
+
+func TestContactFormEmailAddresses(t *testing.T) {
+	type testSpec struct {
+		email    string
+		expected string
+	}
+
+	testSpecs := []testSpec{
+		{email: "test@example.com"},
+		{email: " test@example.com "},
+		{email: "o'brien+photos@example.co.uk"},
+		{email: "TEST@EXAMPLE.COM"},
+		{email: "hanako@例え.jp"},
+		{email: "bob@bücher.de"},
+		{email: "bob@xn--bcher-kva.de"},
+		{email: "Bob <bob@example.com>", expected: invalidEmail},
+		{email: "<bob@example.com>", expected: invalidEmail},
+		{email: "bob@example.com (Bob)", expected: invalidEmail},
+		{email: "bob@example.com, eve@example.com", expected: invalidEmail},
+		{email: "bob@localhost", expected: invalidEmail},
+		{email: "bob@[192.0.2.1]", expected: invalidEmail},
+		{email: "bob@192.0.2.1", expected: invalidEmail},
+		{email: "bob@-example.com", expected: invalidEmail},
+		{email: "bob@exa_mple.com", expected: invalidEmail},
+		{email: "bob@example..com", expected: invalidEmail},
+		{email: "bob@@example.com", expected: invalidEmail},
+		{email: "bob@ex ample.com", expected: invalidEmail},
+		{email: strings.Repeat("b", 65) + "@example.com", expected: invalidEmail},
+		{email: "bob@" + strings.Repeat("a", 64) + ".com", expected: invalidEmail},
+		{email: "bob@" + strings.Repeat(strings.Repeat("a", 60)+".", 5) + "com", expected: invalidEmail},
+		{email: "bob@gmial.com", expected: "email must be a valid email address, did you mean bob@gmail.com?"},
+		{email: "bob@gmail.con", expected: "email must be a valid email address, did you mean bob@gmail.com?"},
+		{email: "bob@hotnail.com", expected: "email must be a valid email address, did you mean bob@hotmail.com?"},
+		{email: "bob@yahooo.com", expected: "email must be a valid email address, did you mean bob@yahoo.com?"},
+		{email: "Bob@Outlok.com", expected: "email must be a valid email address, did you mean Bob@outlook.com?"},
+		{email: "bob@docomo.ne.pj", expected: "email must be a valid email address, did you mean bob@docomo.ne.jp?"},
+		{email: "bob@gmail.com"},
+		{email: "taro@hotmail.co.jp"},
+		{email: "bob@hotmail.co.nz"},
+		{email: "bob@hotmail.es"},
+		{email: "bob@outlook.co.jp"},
+		{email: "bob@outlook.es"},
+		{email: "bob@live.jp"},
+		{email: "bob@yahoo.co.nz"},
+		{email: "bob@email.com"},
+		{email: "bob@hotmail.co.pj", expected: "email must be a valid email address, did you mean bob@hotmail.co.jp?"},
+		{email: "bob@mail.com"},
+		{email: "bob@ymail.com"},
+		{email: "bob@me.com"},
+		{email: "bob@mailinator.com", expected: disposableEmail},
+		{email: "bob@eu.mailinator.com", expected: disposableEmail},
+		{email: "bob@YOPMAIL.com", expected: disposableEmail},
+	}
+
+	for _, test := range testSpecs {
+		if actual := emailError(t, test.email); actual != test.expected {
+			t.Errorf("email [%s] error actual[%s], does not match expected[%s]", test.email, actual, test.expected)
+		}
+	}
+}
+
+func TestContactFormEmailDisposableDomains(t *testing.T) {
+	replaced := validation.WithDisposableDomains([]string{" Example.ORG "})
+	if actual := emailError(t, "bob@example.org", replaced); actual != disposableEmail {
+		t.Errorf("error actual[%s], does not match expected[%s]", actual, disposableEmail)
+	}
+	if actual := emailError(t, "bob@mailinator.com", replaced); actual != "" {
+		t.Errorf("replaced domains SHOULD NOT include the built-in list, actual[%s]", actual)
+	}
+
+	configured := validation.WithConfiguration(&configuration.ContactFormConfiguration{EmailDisposableDomains: []string{"example.org"}})
+	if actual := emailError(t, "bob@sub.example.org", configured); actual != disposableEmail {
+		t.Errorf("error actual[%s], does not match expected[%s]", actual, disposableEmail)
+	}
+	if actual := emailError(t, "bob@mailinator.com", validation.WithConfiguration(&configuration.ContactFormConfiguration{})); actual != disposableEmail {
+		t.Errorf("error actual[%s], does not match expected[%s]", actual, disposableEmail)
+	}
+}
+
+// FakeResolver answers from records, by domain. Missing domains do not exist.
+type FakeResolver struct {
+	MX    map[string][]*net.MX
+	Hosts map[string][]string
+	Err   error
+	// Block waits for the lookup to time out.
+	Block bool
+
+	mu      sync.Mutex
+	Lookups []string
+}
+
+func (r *FakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	r.mu.Lock()
+	r.Lookups = append(r.Lookups, "MX "+name)
+	r.mu.Unlock()
+	if r.Block {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: ctx.Err().Error(), Name: name, IsTimeout: true}
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	if records, ok := r.MX[name]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *FakeResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	r.Lookups = append(r.Lookups, "A "+host)
+	r.mu.Unlock()
+	if hosts, ok := r.Hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestContactFormEmailMailServers(t *testing.T) {
+	resolver := &FakeResolver{
+		MX: map[string][]*net.MX{
+			"example.com":    {{Host: "mx1.example.com.", Pref: 10}, {Host: "mx2.example.com.", Pref: 20}},
+			"nomail.example": {{Host: ".", Pref: 0}},
+			"xn--r8jz45g.jp": {{Host: "mx.xn--r8jz45g.jp.", Pref: 10}},
+		},
+		Hosts: map[string][]string{"implicit.example": {"192.0.2.10"}},
+	}
+	type testSpec struct {
+		email           string
+		expected        string
+		expectedLookups []string
+	}
+
+	testSpecs := []testSpec{
+		{email: "bob@example.com", expectedLookups: []string{"MX example.com"}},
+		{email: "bob@nomail.example", expected: undeliverableMsg, expectedLookups: []string{"MX nomail.example"}},
+		{email: "bob@implicit.example", expectedLookups: []string{"MX implicit.example", "A implicit.example"}},
+		{email: "bob@missing.example", expected: undeliverableMsg,
+			expectedLookups: []string{"MX missing.example", "A missing.example"}},
+		{email: "hanako@例え.jp", expectedLookups: []string{"MX xn--r8jz45g.jp"}},
+		{email: "bob@gmial.com", expected: "email must be a valid email address, did you mean bob@gmail.com?"},
+		{email: "bob@mailinator.com", expected: disposableEmail},
+	}
+
+	for _, test := range testSpecs {
+		resolver.Lookups = nil
+		if actual := emailError(t, test.email, validation.WithResolver(resolver, time.Second)); actual != test.expected {
+			t.Errorf("email [%s] error actual[%s], does not match expected[%s]", test.email, actual, test.expected)
+		}
+		if strings.Join(resolver.Lookups, ",") != strings.Join(test.expectedLookups, ",") {
+			t.Errorf("email [%s] lookups actual[%v], does not match expected[%v]", test.email, resolver.Lookups, test.expectedLookups)
+		}
+	}
+}
+
+func TestContactFormEmailLookupFailuresAccept(t *testing.T) {
+	type testSpec struct {
+		name     string
+		resolver *FakeResolver
+	}
+
+	testSpecs := []testSpec{
+		{name: "server failure", resolver: &FakeResolver{Err: &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}}},
+		{name: "other error", resolver: &FakeResolver{Err: errors.New("network unreachable")}},
+		{name: "timeout", resolver: &FakeResolver{Block: true}},
+	}
+
+	for _, test := range testSpecs {
+		start := time.Now()
+		if actual := emailError(t, "bob@example.com", validation.WithResolver(test.resolver, 20*time.Millisecond)); actual != "" {
+			t.Errorf("%s: error actual[%s], SHOULD accept the address", test.name, actual)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%s: lookup took [%v], SHOULD stop at its timeout", test.name, elapsed)
+		}
+	}
+}
+
+func TestContactFormEmailLookupEndsWithContext(t *testing.T) {
+	resolver := &FakeResolver{Block: true}
+	validator := validation.NewContactFormValidator(validation.WithResolver(resolver, time.Minute))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	validator.CheckContext(ctx, &api.EmailFormRequest{Name: "Gavin Thomas", Email: "bob@example.com", Message: "Valid Message"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("lookup took [%v], SHOULD stop when the context is done", elapsed)
+	}
+	if actual := validator.FieldErrors()[validation.EmailField]; actual != "" {
+		t.Errorf("error actual[%s], SHOULD accept the address", actual)
+	}
+	if len(resolver.Lookups) == 0 {
+		t.Errorf("lookups actual[%v], SHOULD look up the domain", resolver.Lookups)
+	}
+}
@@ -0,0 +1,26 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// headerBreaks are the characters that end a header line, or the string it is
+// in, for some mail libraries and servers.
+const headerBreaks = "\r\n\x00\u0085\u2028\u2029"
+
+// encodedWord matches RFC 2047 encoded words, which mail clients decode in
+// display names, eg. into line breaks or a forged sender address.
+var encodedWord = regexp.MustCompile(`=\?[^?\s]+\?[BbQq]\?[^?\s]*\?=`)
+
+// ValidHeaderValue reports whether value, eg. a name or email address, is safe
+// to put in a mail header: without line breaks, NUL, or encoded words.
+func ValidHeaderValue(value string) bool {
+	return !strings.ContainsAny(value, headerBreaks) && !encodedWord.MatchString(value)
+}
+
+// HeaderValueErrorMsg is the field error of values ValidHeaderValue rejects.
+func HeaderValueErrorMsg(field string) string {
+	return fmt.Sprintf("%s must not contain line breaks or encoded words", field)
+}
@@ -0,0 +1,83 @@
+package validation_test
+
+import (
+	"testing"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
+)
+
+const (
+	nameHeaderError  = "name must not contain line breaks or encoded words"
+	emailHeaderError = "email must not contain line breaks or encoded words"
+)
+
+func TestContactFormHeaderInjection(t *testing.T) {
+	type testSpec struct {
+		name     string
+		email    string
+		expected map[string]string
+	}
+
+	testSpecs := []testSpec{
+		{name: "Gavin\r\nBcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\nBcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\rBcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\r\n\tfolded", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\r\n\r\nForged body", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\x00Bcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\u0085Bcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\u2028Bcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin\u2029Bcc: eve@example.com", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "=?utf-8?q?Gavin=0D=0ABcc:_eve@example.com?=", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "=?UTF-8?B?R2F2aW4NCkJjYzogZXZlQGV4YW1wbGUuY29t?=", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Support =?iso-8859-1?Q?=3Csupport=40bank.example=3E?=", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin =?utf-8*en?q?Thomas?=", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{name: "Gavin =?utf-8?b??=", expected: map[string]string{validation.NameField: nameHeaderError}},
+		{email: "bob@example.com\r\nBcc: eve@example.com", expected: map[string]string{validation.EmailField: emailHeaderError}},
+		{email: "bob@example.com\nCc: eve@example.com", expected: map[string]string{validation.EmailField: emailHeaderError}},
+		{email: "bob@example.com\x00", expected: map[string]string{validation.EmailField: emailHeaderError}},
+		{email: "=?utf-8?q?eve=40evil.example?=@example.com", expected: map[string]string{validation.EmailField: emailHeaderError}},
+		{email: "bob@example.com%0d%0aBcc:eve@example.com", expected: map[string]string{validation.EmailField: invalidEmail}},
+		{name: "Gavin\r\nBcc: eve@example.com", email: "=?utf-8?q?eve?=@example.com",
+			expected: map[string]string{validation.NameField: nameHeaderError, validation.EmailField: emailHeaderError}},
+		{name: "O'Brien <obrien@example.com>"},
+		{name: "Tanaka =? Taro ?="},
+		{name: "a=?b?c"},
+		{name: "=?utf-8?x?Gavin?="},
+		{name: "=?utf-8?q?Gavin Thomas?="},
+		{name: "Gavin\tThomas"},
+		{email: "o'brien=?@example.com"},
+	}
+
+	for _, test := range testSpecs {
+		request := api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Valid Message"}
+		if test.name != "" {
+			request.Name = test.name
+		}
+		if test.email != "" {
+			request.Email = test.email
+		}
+		validator := validation.NewContactFormValidator()
+		validator.Check(&request)
+		for _, field := range []string{validation.NameField, validation.EmailField} {
+			if actual := validator.FieldErrors()[field]; actual != test.expected[field] {
+				t.Errorf("name [%+q], email [%+q]: %s error actual[%s], does not match expected[%s]",
+					request.Name, request.Email, field, actual, test.expected[field])
+			}
+		}
+	}
+}
+
+func TestValidHeaderValue(t *testing.T) {
+	for _, value := range []string{"", "Gavin Thomas", "José", "山田 太郎", "bob@example.com", "100% =?", "?= =?"} {
+		if !validation.ValidHeaderValue(value) {
+			t.Errorf("ValidHeaderValue(%+q) SHOULD be true", value)
+		}
+	}
+	for _, value := range []string{"\r", "\n", "\x00", "a\u2028b", "=?a?Q?b?=", "x=?us-ascii?b?YQ==?=y"} {
+		if validation.ValidHeaderValue(value) {
+			t.Errorf("ValidHeaderValue(%+q) SHOULD be false", value)
+		}
+	}
+}
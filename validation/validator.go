@@ -1,12 +1,18 @@
 package validation
 
 import (
+	"context"
 	"fmt"
-	"net/mail"
+	"log/slog"
+	"net"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/attachment"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
 )
 
 const (
@@ -14,9 +20,26 @@ const (
 	MaxNameLength    = 100
 	MinMessageLength = 1
 	MaxMessageLength = 1000
-	NameField        = "name"
-	EmailField       = "email"
-	MessageField     = "message"
+	MaxFormIDLength  = 100
+	// MaxCustomFields limits the additional fields, and the length of their names and values.
+	MaxCustomFields           = 20
+	MaxCustomFieldNameLength  = 50
+	MaxCustomFieldValueLength = 1000
+	// MaxAttachments limits the attached files, of which at most
+	// MaxImageAttachments images.
+	MaxAttachments      = 6
+	MaxImageAttachments = 5
+	// MaxAttachmentBytes limits each attached file, and MaxAttachmentsBytes all
+	// of them. Base64 encoded, they stay within Postmark's 10 MB message limit,
+	// the smallest of the providers'.
+	MaxAttachmentBytes  = 5 << 20
+	MaxAttachmentsBytes = 7 << 20
+	NameField           = "name"
+	EmailField          = "email"
+	MessageField        = "message"
+	FormIDField         = "formId"
+	FieldsField         = "fields"
+	AttachmentsField    = "attachments"
 )
 
 // Define interface for validation
@@ -27,13 +50,71 @@ type Validator interface {
 	GlobalError() string
 }
 
+// ContextValidator is a Validator whose checks, eg. looking up mail servers,
+// can be bounded by the request's context. Check uses context.Background().
+type ContextValidator interface {
+	Validator
+	CheckContext(ctx context.Context, request any)
+}
+
 type ContactFormValidator struct {
-	fieldErrors map[string]string
-	globalError string
+	fieldErrors       map[string]string
+	globalError       string
+	logger            *slog.Logger
+	disposableDomains []string
+	resolver          Resolver
+	lookupTimeout     time.Duration
+}
+
+type Option func(*ContactFormValidator)
+
+// WithLogger sets the logger. Without it, logging.Default() is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(v *ContactFormValidator) {
+		v.logger = logger
+	}
+}
+
+// WithDisposableDomains replaces the DisposableDomains that email addresses
+// must not be at.
+func WithDisposableDomains(domains []string) Option {
+	return func(v *ContactFormValidator) {
+		v.disposableDomains = make([]string, 0, len(domains))
+		for _, domain := range domains {
+			v.disposableDomains = append(v.disposableDomains, strings.ToLower(strings.TrimSpace(domain)))
+		}
+	}
+}
+
+// WithResolver checks that the domains of email addresses have mail servers,
+// within timeout, or DefaultLookupTimeout when zero. Without it, domains are
+// not looked up.
+func WithResolver(resolver Resolver, timeout time.Duration) Option {
+	return func(v *ContactFormValidator) {
+		v.resolver = resolver
+		v.lookupTimeout = timeout
+	}
+}
+
+// WithConfiguration applies the email settings of cfg: its disposable domains,
+// and looking up mail servers with the system resolver.
+func WithConfiguration(cfg *configuration.ContactFormConfiguration) Option {
+	return func(v *ContactFormValidator) {
+		if len(cfg.EmailDisposableDomains) > 0 {
+			WithDisposableDomains(cfg.EmailDisposableDomains)(v)
+		}
+		if cfg.EmailCheckMX {
+			WithResolver(net.DefaultResolver, cfg.EmailLookupTimeout)(v)
+		}
+	}
 }
 
-func NewContactFormValidator() *ContactFormValidator {
-	return &ContactFormValidator{}
+func NewContactFormValidator(opts ...Option) *ContactFormValidator {
+	v := &ContactFormValidator{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
 }
 
 func (v *ContactFormValidator) Valid() bool {
@@ -49,19 +130,101 @@ func (v *ContactFormValidator) GlobalError() string {
 }
 
 func (v *ContactFormValidator) Check(request any) {
+	v.CheckContext(context.Background(), request)
+}
+
+// CheckContext checks request as Check does, ending the mail server lookup of
+// its email domain when ctx is done, or after the lookup timeout.
+func (v *ContactFormValidator) CheckContext(ctx context.Context, request any) {
 	efr, ok := request.(*api.EmailFormRequest)
 	if !ok {
-		fmt.Printf("request not expected type of *api.EmailFormRequest: [%v]", request)
+		v.log().WarnContext(ctx, "request not expected type of *api.EmailFormRequest",
+			logging.KeyStage, logging.StageValidation,
+			"type", fmt.Sprintf("%T", request))
 		v.globalError = "invalid request type"
 		return
 	}
 
+	// The name and email become the Reply-To header.
+	v.checkField(ValidHeaderValue(efr.Name), NameField, HeaderValueErrorMsg(NameField))
+	v.checkField(ValidHeaderValue(efr.Email), EmailField, HeaderValueErrorMsg(EmailField))
 	v.checkField(validMinMaxChars(efr.Name, MinNameLength, MaxNameLength), NameField,
 		validMinMaxCharsErrorMsg(NameField, MinNameLength, MaxNameLength))
 	v.checkField(validMinMaxChars(efr.Message, MinMessageLength, MaxMessageLength), MessageField,
 		validMinMaxCharsErrorMsg(MessageField, MinNameLength, MaxNameLength))
 
-	v.checkField(validEmail(efr.Email), EmailField, validMailErrorMsg(EmailField))
+	v.checkEmail(ctx, efr.Email)
+	v.checkField(validMaxChars(efr.FormID, MaxFormIDLength), FormIDField,
+		fmt.Sprintf("%s must be at most %d characters", FormIDField, MaxFormIDLength))
+	v.checkField(validCustomFields(efr.Fields), FieldsField,
+		fmt.Sprintf("%s must have at most %d fields, with names of 1 to %d characters and values of at most %d characters",
+			FieldsField, MaxCustomFields, MaxCustomFieldNameLength, MaxCustomFieldValueLength))
+	v.checkAttachments(efr.Attachments)
+}
+
+// checkEmail checks that email is a bare address, which is not a likely typo
+// of a common domain, nor disposable, and, with a Resolver, whose domain has
+// mail servers. Likely typos are corrected in the field error.
+func (v *ContactFormValidator) checkEmail(ctx context.Context, email string) {
+	address, ok := parseEmail(email)
+	if !ok {
+		v.addFieldError(EmailField, validMailErrorMsg(EmailField))
+		return
+	}
+	if suggestion := suggestDomain(address.domain); suggestion != "" {
+		v.addFieldError(EmailField, fmt.Sprintf("%s must be a valid email address, did you mean %s@%s?",
+			EmailField, address.local, suggestion))
+		return
+	}
+	disposableDomains := v.disposableDomains
+	if disposableDomains == nil {
+		disposableDomains = DisposableDomains
+	}
+	if matchesDomain(address.domain, disposableDomains) {
+		v.addFieldError(EmailField, fmt.Sprintf("%s must not be a disposable email address", EmailField))
+		return
+	}
+	if v.resolver == nil {
+		return
+	}
+	timeout := v.lookupTimeout
+	if timeout <= 0 {
+		timeout = DefaultLookupTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if !receivesEmail(ctx, v.resolver, address.domain) {
+		v.addFieldError(EmailField, fmt.Sprintf("%s must be an address that can receive email", EmailField))
+	}
+}
+
+// checkAttachments checks the number, content types and sizes of files. Their
+// content types are sniffed, whatever the client claims.
+func (v *ContactFormValidator) checkAttachments(files []api.Attachment) {
+	images := 0
+	allowed := true
+	sized := attachment.TotalSize(files) <= MaxAttachmentsBytes
+	for _, file := range files {
+		contentType := attachment.Sniff(file.Content)
+		if attachment.IsImage(contentType) {
+			images++
+		}
+		allowed = allowed && attachment.Allowed(contentType)
+		sized = sized && len(file.Content) <= MaxAttachmentBytes
+	}
+	v.checkField(len(files) <= MaxAttachments && images <= MaxImageAttachments, AttachmentsField,
+		fmt.Sprintf("%s must be at most %d files, of which at most %d images", AttachmentsField, MaxAttachments, MaxImageAttachments))
+	v.checkField(allowed, AttachmentsField,
+		fmt.Sprintf("%s must be JPEG, PNG, HEIC or PDF files", AttachmentsField))
+	v.checkField(sized, AttachmentsField,
+		fmt.Sprintf("%s must be at most %d MB each, and %d MB in total", AttachmentsField, MaxAttachmentBytes>>20, MaxAttachmentsBytes>>20))
+}
+
+func (v *ContactFormValidator) log() *slog.Logger {
+	if v.logger == nil {
+		v.logger = logging.Default()
+	}
+	return v.logger
 }
 
 func (v *ContactFormValidator) addFieldError(field, message string) {
@@ -96,9 +259,16 @@ func validMinMaxCharsErrorMsg(field string, min, max int) string {
 	return fmt.Sprintf("%s must be between %d and %d characters", field, min, max)
 }
 
-func validEmail(email string) bool {
-	_, err := mail.ParseAddress(email)
-	return err == nil
+func validCustomFields(fields map[string]string) bool {
+	if len(fields) > MaxCustomFields {
+		return false
+	}
+	for name, value := range fields {
+		if !validMinMaxChars(name, 1, MaxCustomFieldNameLength) || !validMaxChars(value, MaxCustomFieldValueLength) {
+			return false
+		}
+	}
+	return true
 }
 
 func validMailErrorMsg(field string) string {
@@ -1,11 +1,15 @@
 package validation_test
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
 	"github.com/ippoippo/ippoippophotography-com-functions-contact/validation"
 )
 
@@ -115,6 +119,38 @@ func TestContactFormRequestTypeValidation(t *testing.T) {
 	}
 }
 
+func TestContactFormRequestTypeValidationLogsType(t *testing.T) {
+	recorder := logging.NewRecorder()
+	validator := validation.NewContactFormValidator(validation.WithLogger(logging.NewWithHandler(recorder, nil)))
+	validator.Check(api.EmailFormRequest{Email: "test@example.com"})
+
+	records := recorder.Records()
+	if len(records) != 1 {
+		t.Fatalf("len(Records()) actual[%d], does not match expected[1]", len(records))
+	}
+	attrs := logging.Attrs(records[0])
+	if actual := attrs["type"].String(); actual != "api.EmailFormRequest" {
+		t.Errorf("type actual[%s], does not match expected[%s]", actual, "api.EmailFormRequest")
+	}
+	if _, ok := attrs["request"]; ok {
+		t.Error("the request SHOULD NOT be logged")
+	}
+}
+
+func TestContactFormRequestTypeValidationLogsRequestID(t *testing.T) {
+	recorder := logging.NewRecorder()
+	validator := validation.NewContactFormValidator(validation.WithLogger(logging.NewWithHandler(recorder, nil)))
+	validator.CheckContext(requestid.NewContext(context.Background(), "req-123"), api.EmailFormRequest{})
+
+	records := recorder.Records()
+	if len(records) != 1 {
+		t.Fatalf("len(Records()) actual[%d], does not match expected[1]", len(records))
+	}
+	if actual := logging.Attrs(records[0])["request_id"].String(); actual != "req-123" {
+		t.Errorf("request_id actual[%s], does not match expected[%s]", actual, "req-123")
+	}
+}
+
 func TestContactFormNameValidation(t *testing.T) {
 	type testSpec struct {
 		request          api.EmailFormRequest
@@ -285,6 +321,91 @@ func TestContactFormEmailValidation(t *testing.T) {
 	}
 }
 
+func TestContactFormCustomFieldsValidation(t *testing.T) {
+	type testSpec struct {
+		formID        string
+		fields        map[string]string
+		expectedField string
+	}
+
+	tooManyFields := make(map[string]string)
+	for i := 0; i <= validation.MaxCustomFields; i++ {
+		tooManyFields[fmt.Sprintf("field%d", i)] = "value"
+	}
+
+	testSpecs := []testSpec{
+		{formID: "", fields: nil},
+		{formID: "wedding-enquiry", fields: map[string]string{"date": "2024-06-01", "venue": "Kyoto"}},
+		{formID: generateStringWithLength(101), expectedField: "formId"},
+		{fields: tooManyFields, expectedField: "fields"},
+		{fields: map[string]string{" ": "value"}, expectedField: "fields"},
+		{fields: map[string]string{generateStringWithLength(51): "value"}, expectedField: "fields"},
+		{fields: map[string]string{"notes": generateStringWithLength(1001)}, expectedField: "fields"},
+	}
+
+	for _, test := range testSpecs {
+		validator := validation.ContactFormValidator{}
+		validator.Check(&api.EmailFormRequest{
+			Name:    "Gavin Thomas",
+			Email:   "test@example.com",
+			Message: "Valid Message",
+			FormID:  test.formID,
+			Fields:  test.fields,
+		})
+		if test.expectedField == "" && !validator.Valid() {
+			t.Errorf("Check(%s, %d fields) actual[%v], SHOULD be valid", test.formID, len(test.fields), validator.FieldErrors())
+		}
+		if _, ok := validator.FieldErrors()[test.expectedField]; test.expectedField != "" && !ok {
+			t.Errorf("Check(%s, %d fields) actual[%v], SHOULD have a %s error", test.formID, len(test.fields), validator.FieldErrors(), test.expectedField)
+		}
+	}
+}
+
+func TestContactFormAttachmentsValidation(t *testing.T) {
+	type testSpec struct {
+		name          string
+		attachments   []api.Attachment
+		expectedError string
+	}
+
+	jpeg := api.Attachment{Filename: "venue.jpg", Content: []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")}
+	pdf := api.Attachment{Filename: "brief.pdf", Content: []byte("%PDF-1.7\n")}
+	large := func(prefix string, size int) api.Attachment {
+		return api.Attachment{Filename: "large", Content: append([]byte(prefix), make([]byte, size-len(prefix))...)}
+	}
+	tooManyError := fmt.Sprintf("attachments must be at most %d files, of which at most %d images",
+		validation.MaxAttachments, validation.MaxImageAttachments)
+	typeError := "attachments must be JPEG, PNG, HEIC or PDF files"
+	sizeError := "attachments must be at most 5 MB each, and 7 MB in total"
+
+	testSpecs := []testSpec{
+		{name: "no attachments"},
+		{name: "images and a pdf", attachments: []api.Attachment{jpeg, jpeg, jpeg, jpeg, jpeg, pdf}},
+		{name: "too many images", attachments: []api.Attachment{jpeg, jpeg, jpeg, jpeg, jpeg, jpeg}, expectedError: tooManyError},
+		{name: "too many files", attachments: []api.Attachment{pdf, pdf, pdf, pdf, pdf, pdf, pdf}, expectedError: tooManyError},
+		{name: "gif", attachments: []api.Attachment{{Filename: "venue.jpg", ContentType: "image/jpeg", Content: []byte("GIF89a")}},
+			expectedError: typeError},
+		{name: "empty file", attachments: []api.Attachment{{Filename: "venue.jpg"}}, expectedError: typeError},
+		{name: "largest file", attachments: []api.Attachment{large("%PDF-", validation.MaxAttachmentBytes)}},
+		{name: "file too large", attachments: []api.Attachment{large("%PDF-", validation.MaxAttachmentBytes+1)}, expectedError: sizeError},
+		{name: "files too large", attachments: []api.Attachment{large("%PDF-", 4<<20), large("%PDF-", 4<<20)}, expectedError: sizeError},
+	}
+
+	for _, test := range testSpecs {
+		validator := validation.ContactFormValidator{}
+		validator.Check(&api.EmailFormRequest{
+			Name:        "Gavin Thomas",
+			Email:       "test@example.com",
+			Message:     "Valid Message",
+			Attachments: test.attachments,
+		})
+		actual := validator.FieldErrors()[validation.AttachmentsField]
+		if actual != test.expectedError {
+			t.Errorf("%s: attachments error actual[%s], does not match expected[%s]", test.name, actual, test.expectedError)
+		}
+	}
+}
+
 func generateStringWithLength(length int) string {
 	seededRand := rand.New(rand.NewSource(time.Now().UnixNano()))
 	charset := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -0,0 +1,336 @@
+// Package webhook receives SendGrid's Event Webhook, recording deliveries,
+// bounces, drops and spam reports on the submissions they concern.
+package webhook
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sendgrid/sendgrid-go/helpers/eventwebhook"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/metrics"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/requestid"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+)
+
+const (
+	logStageWebhook = "webhook"
+	// maxPayloadBytes bounds a batch of events. SendGrid batches up to a few
+	// hundred events in each request.
+	maxPayloadBytes = 1 << 20
+)
+
+// Signature headers, as sent by SendGrid.
+const (
+	SignatureHeader = eventwebhook.VerificationHTTPHeader
+	TimestampHeader = eventwebhook.TimestampHTTPHeader
+)
+
+var (
+	// ErrInvalidSignature is returned for payloads not signed by SendGrid.
+	ErrInvalidSignature = errors.New("invalid event webhook signature")
+	// ErrStaleTimestamp is returned for payloads signed longer ago than the
+	// configured maximum age, such as replayed requests.
+	ErrStaleTimestamp = errors.New("stale event webhook timestamp")
+	// ErrInvalidPayload is returned for payloads that are not a JSON array of events.
+	ErrInvalidPayload = errors.New("invalid event webhook payload")
+)
+
+// eventStatuses maps the events recorded on submissions to their status.
+// Other events, such as processed, deferred, open and click, are ignored.
+var eventStatuses = map[string]store.Status{
+	"delivered":  store.StatusDelivered,
+	"bounce":     store.StatusBounced,
+	"dropped":    store.StatusDropped,
+	"spamreport": store.StatusSpamReported,
+}
+
+// finalStatuses are not changed by later events. SendGrid does not send
+// events in order, so a late delivered event must not hide a bounce, drop or
+// spam report.
+var finalStatuses = map[store.Status]bool{
+	store.StatusBounced:      true,
+	store.StatusDropped:      true,
+	store.StatusSpamReported: true,
+}
+
+// Event is a SendGrid event. The custom_args set by the mailer are top level
+// fields of the event.
+type Event struct {
+	Event        string `json:"event"`
+	Timestamp    int64  `json:"timestamp"`
+	SGEventID    string `json:"sg_event_id"`
+	SGMessageID  string `json:"sg_message_id"`
+	Reason       string `json:"reason,omitempty"`
+	Type         string `json:"type,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	SubmissionID string `json:"submission_id,omitempty"`
+}
+
+// Result counts the events of a payload.
+type Result struct {
+	// Updated events changed the status of their submission.
+	Updated int
+	// Ignored events are not recorded, were already recorded, or have no known submission.
+	Ignored int
+}
+
+// Alert describes a condition needing attention.
+type Alert struct {
+	Name    string
+	Message string
+}
+
+// Alerter raises alerts, eg. by paging or posting to a chat channel.
+type Alerter interface {
+	Alert(ctx context.Context, alert Alert)
+}
+
+// LogAlerter logs alerts at error level, for log based alerting.
+type LogAlerter struct {
+	Logger *slog.Logger
+}
+
+func (a LogAlerter) Alert(ctx context.Context, alert Alert) {
+	a.Logger.ErrorContext(ctx, alert.Message, logging.KeyStage, logStageWebhook, "alert", alert.Name)
+}
+
+// Receiver verifies and records Event Webhook payloads. It is an http.Handler.
+type Receiver struct {
+	publicKey            *ecdsa.PublicKey
+	maxAge               time.Duration
+	store                store.SubmissionStore
+	bounceAlertThreshold int
+	bounceAlertWindow    time.Duration
+	alerter              Alerter
+	logger               *slog.Logger
+	meter                metrics.Meter
+	now                  func() time.Time
+}
+
+type Option func(*Receiver)
+
+// WithLogger sets the logger. Without it, a default logger redacting by the
+// configured LogPIIPolicy is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(r *Receiver) {
+		r.logger = logger
+	}
+}
+
+// WithMeter sets the meter for received events. Without it, metrics are discarded.
+func WithMeter(meter metrics.Meter) Option {
+	return func(r *Receiver) {
+		r.meter = meter
+	}
+}
+
+// WithAlerter sets the alerter for repeated bounces. Without it, alerts are logged.
+func WithAlerter(alerter Alerter) Option {
+	return func(r *Receiver) {
+		r.alerter = alerter
+	}
+}
+
+// WithClock sets the clock used to check timestamps and count recent bounces.
+func WithClock(now func() time.Time) Option {
+	return func(r *Receiver) {
+		r.now = now
+	}
+}
+
+// NewReceiver returns a Receiver verifying payloads with the configured
+// SendGridWebhookPublicKey, and recording events in submissionStore.
+func NewReceiver(cfg *configuration.ContactFormConfiguration, submissionStore store.SubmissionStore, opts ...Option) (*Receiver, error) {
+	if submissionStore == nil {
+		return nil, errors.New("event webhook requires a submission store")
+	}
+	publicKey, err := parsePublicKey(cfg.SendGridWebhookPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	r := &Receiver{
+		publicKey:            publicKey,
+		maxAge:               cfg.SendGridWebhookMaxAge,
+		store:                submissionStore,
+		bounceAlertThreshold: cfg.BounceAlertThreshold,
+		bounceAlertWindow:    cfg.BounceAlertWindow,
+		logger:               logging.ForPolicy(cfg.LogPIIPolicy),
+		meter:                metrics.Noop{},
+		now:                  time.Now,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.alerter == nil {
+		r.alerter = LogAlerter{Logger: r.logger}
+	}
+	return r, nil
+}
+
+// parsePublicKey decodes the base64 encoded, DER (PKIX) ECDSA key shown by SendGrid.
+func parsePublicKey(base64PublicKey string) (*ecdsa.PublicKey, error) {
+	if base64PublicKey == "" {
+		return nil, errors.New("SENDGRID_WEBHOOK_PUBLIC_KEY is required for the event webhook")
+	}
+	der, err := base64.StdEncoding.DecodeString(base64PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding SENDGRID_WEBHOOK_PUBLIC_KEY: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SENDGRID_WEBHOOK_PUBLIC_KEY: %w", err)
+	}
+	publicKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("SENDGRID_WEBHOOK_PUBLIC_KEY is a %T, not an ECDSA key", key)
+	}
+	return publicKey, nil
+}
+
+// ServeHTTP receives a payload. Unverified payloads are rejected with 401, and
+// store errors return 500, so SendGrid retries them.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	payload, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxPayloadBytes))
+	if err != nil {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	_, err = r.Receive(req.Context(), payload, req.Header.Get(SignatureHeader), req.Header.Get(TimestampHeader))
+	switch {
+	case errors.Is(err, ErrInvalidSignature), errors.Is(err, ErrStaleTimestamp):
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	case errors.Is(err, ErrInvalidPayload):
+		http.Error(w, "bad request", http.StatusBadRequest)
+	case err != nil:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Receive verifies payload with its signature and timestamp headers, and
+// records its events. Events are recorded at most once, so SendGrid may retry
+// a payload after an error.
+func (r *Receiver) Receive(ctx context.Context, payload []byte, signature, timestamp string) (Result, error) {
+	if err := r.verify(payload, signature, timestamp); err != nil {
+		r.logger.WarnContext(ctx, "event webhook payload rejected",
+			logging.KeyStage, logStageWebhook, logging.KeyOutcome, "rejected", logging.KeyError, err.Error())
+		return Result{}, err
+	}
+	var events []Event
+	if err := json.Unmarshal(payload, &events); err != nil {
+		return Result{}, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	var result Result
+	for _, event := range events {
+		updated, err := r.record(ctx, event)
+		if err != nil {
+			return result, err
+		}
+		if updated {
+			result.Updated++
+		} else {
+			result.Ignored++
+		}
+	}
+	return result, nil
+}
+
+func (r *Receiver) verify(payload []byte, signature, timestamp string) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	age := r.now().Sub(time.Unix(seconds, 0))
+	if age > r.maxAge || age < -r.maxAge {
+		return ErrStaleTimestamp
+	}
+	// SendGrid signs the timestamp header followed by the payload.
+	if ok, err := eventwebhook.VerifySignature(r.publicKey, payload, signature, timestamp); err != nil || !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// record updates the submission of event, reporting whether its status changed.
+func (r *Receiver) record(ctx context.Context, event Event) (bool, error) {
+	r.meter.IncCounter(ctx, metrics.MailEventsTotal, metrics.Labels{metrics.LabelEvent: event.Event})
+	status, ok := eventStatuses[event.Event]
+	if !ok || event.SubmissionID == "" {
+		return false, nil
+	}
+	if event.RequestID != "" {
+		ctx = requestid.NewContext(ctx, event.RequestID)
+	}
+	logAttrs := []any{logging.KeyStage, logStageWebhook, "submission_id", event.SubmissionID, "event", event.Event,
+		"sg_event_id", event.SGEventID}
+
+	submission, err := r.store.Get(ctx, event.SubmissionID)
+	if errors.Is(err, store.ErrNotFound) {
+		r.logger.InfoContext(ctx, "event for unknown submission ignored", append(logAttrs, logging.KeyOutcome, "ignored")...)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if submission.Status == status {
+		return false, nil
+	}
+	if finalStatuses[submission.Status] {
+		r.logger.InfoContext(ctx, "event after a final status ignored",
+			append(logAttrs, logging.KeyOutcome, "ignored", "status", string(submission.Status))...)
+		return false, nil
+	}
+	if err := r.store.UpdateStatus(ctx, submission.ID, status, event.Reason); err != nil {
+		return false, err
+	}
+	r.logger.InfoContext(ctx, "submission updated by event",
+		append(logAttrs, logging.KeyOutcome, string(status), "reason", event.Reason)...)
+	if status == store.StatusBounced {
+		return true, r.checkBounces(ctx)
+	}
+	return true, nil
+}
+
+// checkBounces alerts when BounceAlertThreshold submissions bounced within
+// BounceAlertWindow. The emails are sent to the site itself, so repeated
+// bounces mean its mailbox is not receiving them. It alerts once, as the count
+// reaches the threshold, rather than on every bounce of an outage.
+func (r *Receiver) checkBounces(ctx context.Context) error {
+	bounced, err := r.store.List(ctx, store.StatusBounced)
+	if err != nil {
+		return err
+	}
+	since := r.now().Add(-r.bounceAlertWindow)
+	recent := 0
+	for _, submission := range bounced {
+		if !submission.UpdatedAt.Before(since) {
+			recent++
+		}
+	}
+	if recent == r.bounceAlertThreshold {
+		r.alerter.Alert(ctx, Alert{
+			Name:    "repeated_bounces",
+			Message: fmt.Sprintf("%d contact emails bounced in the last %s", recent, r.bounceAlertWindow),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package webhook_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/api"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/configuration"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/logging"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/redaction"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/store"
+	"github.com/ippoippo/ippoippophotography-com-functions-contact/webhook"
+)
+
+func TestReceiveRecordsEvents(t *testing.T) {
+	ctx := context.Background()
+	key := generateKey(t)
+	submissionStore := setupStore(t, ctx, "sub-delivered", "sub-bounced", "sub-dropped", "sub-spam")
+	receiver := setupReceiver(t, key, submissionStore)
+
+	payload, err := os.ReadFile("testdata/events.json")
+	if err != nil {
+		t.Fatalf("reading fixture returned error [%v]", err)
+	}
+	signature, timestamp := sign(t, key, payload, time.Now())
+
+	result, err := receiver.Receive(ctx, payload, signature, timestamp)
+	if err != nil {
+		t.Fatalf("Receive() returned error [%v]", err)
+	}
+	if expected := (webhook.Result{Updated: 4, Ignored: 4}); result != expected {
+		t.Errorf("Receive() actual[%+v], does not match expected[%+v]", result, expected)
+	}
+
+	expectedStatuses := map[string]store.Status{
+		"sub-delivered": store.StatusDelivered,
+		"sub-bounced":   store.StatusBounced,
+		"sub-dropped":   store.StatusDropped,
+		"sub-spam":      store.StatusSpamReported,
+	}
+	for id, expected := range expectedStatuses {
+		submission, err := submissionStore.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get(%s) returned error [%v]", id, err)
+		}
+		if submission.Status != expected {
+			t.Errorf("%s status actual[%s], does not match expected[%s]", id, submission.Status, expected)
+		}
+	}
+	bounced, _ := submissionStore.Get(ctx, "sub-bounced")
+	if expected := "550 5.1.1 The email account that you tried to reach does not exist"; bounced.LastError != expected {
+		t.Errorf("bounce LastError actual[%s], does not match expected[%s]", bounced.LastError, expected)
+	}
+
+	result, err = receiver.Receive(ctx, payload, signature, timestamp)
+	if err != nil {
+		t.Fatalf("second Receive() returned error [%v]", err)
+	}
+	if expected := (webhook.Result{Ignored: 8}); result != expected {
+		t.Errorf("second Receive() actual[%+v], SHOULD NOT record events twice", result)
+	}
+	delivered, _ := submissionStore.Get(ctx, "sub-delivered")
+	if len(delivered.Transitions) != 2 {
+		t.Errorf("len(Transitions) actual[%d], does not match expected[2]", len(delivered.Transitions))
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	type testSpec struct {
+		name           string
+		method         string
+		payload        string
+		signedPayload  string
+		signedAt       time.Time
+		otherKey       bool
+		expectedStatus int
+	}
+
+	valid := `[{"event": "delivered", "submission_id": "sub-delivered"}]`
+	testSpecs := []testSpec{
+		{name: "valid", payload: valid, expectedStatus: http.StatusNoContent},
+		{name: "tampered", payload: valid, signedPayload: `[{"event": "bounce", "submission_id": "sub-delivered"}]`, expectedStatus: http.StatusUnauthorized},
+		{name: "other key", payload: valid, otherKey: true, expectedStatus: http.StatusUnauthorized},
+		{name: "stale", payload: valid, signedAt: time.Now().Add(-time.Hour), expectedStatus: http.StatusUnauthorized},
+		{name: "future", payload: valid, signedAt: time.Now().Add(time.Hour), expectedStatus: http.StatusUnauthorized},
+		{name: "not an array", payload: `{"event": "delivered"}`, expectedStatus: http.StatusBadRequest},
+		{name: "get", method: http.MethodGet, payload: valid, expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range testSpecs {
+		t.Run(test.name, func(t *testing.T) {
+			key := generateKey(t)
+			receiver := setupReceiver(t, key, setupStore(t, context.Background(), "sub-delivered"))
+
+			signingKey := key
+			if test.otherKey {
+				signingKey = generateKey(t)
+			}
+			signedPayload := test.payload
+			if test.signedPayload != "" {
+				signedPayload = test.signedPayload
+			}
+			signedAt := time.Now()
+			if !test.signedAt.IsZero() {
+				signedAt = test.signedAt
+			}
+			signature, timestamp := sign(t, signingKey, []byte(signedPayload), signedAt)
+
+			method := http.MethodPost
+			if test.method != "" {
+				method = test.method
+			}
+			req := httptest.NewRequest(method, "/events", bytes.NewBufferString(test.payload))
+			req.Header.Set(webhook.SignatureHeader, signature)
+			req.Header.Set(webhook.TimestampHeader, timestamp)
+			res := httptest.NewRecorder()
+			receiver.ServeHTTP(res, req)
+
+			if res.Code != test.expectedStatus {
+				t.Errorf("status actual[%d], does not match expected[%d]", res.Code, test.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestRepeatedBouncesAlert(t *testing.T) {
+	ctx := context.Background()
+	key := generateKey(t)
+	submissionStore := setupStore(t, ctx, "sub-1", "sub-2", "sub-3", "sub-4")
+	alerter := &MockAlerter{}
+	t.Setenv("BOUNCE_ALERT_THRESHOLD", "2")
+	receiver := setupReceiver(t, key, submissionStore, webhook.WithAlerter(alerter))
+
+	// Only reaching the threshold alerts, not every bounce after it.
+	expectedAlerts := []int{0, 1, 1, 1}
+	for i, id := range []string{"sub-1", "sub-2", "sub-3", "sub-4"} {
+		payload := []byte(`[{"event": "bounce", "reason": "550 mailbox unavailable", "submission_id": "` + id + `"}]`)
+		signature, timestamp := sign(t, key, payload, time.Now())
+		if _, err := receiver.Receive(ctx, payload, signature, timestamp); err != nil {
+			t.Fatalf("Receive() returned error [%v]", err)
+		}
+		if len(alerter.Alerts) != expectedAlerts[i] {
+			t.Errorf("alerts after %d bounces actual[%d], does not match expected[%d]", i+1, len(alerter.Alerts), expectedAlerts[i])
+		}
+	}
+	if alerter.Alerts[0].Name != "repeated_bounces" {
+		t.Errorf("alert name actual[%s], does not match expected[repeated_bounces]", alerter.Alerts[0].Name)
+	}
+}
+
+func TestLateEventsKeepFinalStatuses(t *testing.T) {
+	type testSpec struct {
+		events         []string
+		expectedStatus store.Status
+	}
+
+	testSpecs := []testSpec{
+		{events: []string{"bounce", "delivered"}, expectedStatus: store.StatusBounced},
+		{events: []string{"dropped", "delivered"}, expectedStatus: store.StatusDropped},
+		{events: []string{"spamreport", "delivered"}, expectedStatus: store.StatusSpamReported},
+		{events: []string{"bounce", "spamreport"}, expectedStatus: store.StatusBounced},
+		{events: []string{"delivered", "spamreport"}, expectedStatus: store.StatusSpamReported},
+		{events: []string{"delivered", "bounce"}, expectedStatus: store.StatusBounced},
+	}
+
+	for _, test := range testSpecs {
+		ctx := context.Background()
+		key := generateKey(t)
+		submissionStore := setupStore(t, ctx, "sub-1")
+		receiver := setupReceiver(t, key, submissionStore)
+		for _, event := range test.events {
+			payload := []byte(`[{"event": "` + event + `", "reason": "` + event + ` reason", "submission_id": "sub-1"}]`)
+			signature, timestamp := sign(t, key, payload, time.Now())
+			if _, err := receiver.Receive(ctx, payload, signature, timestamp); err != nil {
+				t.Fatalf("Receive() returned error [%v]", err)
+			}
+		}
+		submission, _ := submissionStore.Get(ctx, "sub-1")
+		if submission.Status != test.expectedStatus {
+			t.Errorf("%v: status actual[%s], does not match expected[%s]", test.events, submission.Status, test.expectedStatus)
+		}
+	}
+}
+
+func TestDeliveredEventBeforeSentIsKept(t *testing.T) {
+	ctx := context.Background()
+	key := generateKey(t)
+	submissionStore := setupStore(t, ctx, "sub-1")
+	receiver := setupReceiver(t, key, submissionStore)
+	if err := submissionStore.UpdateStatus(ctx, "sub-1", store.StatusSending, ""); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+
+	payload := []byte(`[{"event": "delivered", "submission_id": "sub-1"}]`)
+	signature, timestamp := sign(t, key, payload, time.Now())
+	if _, err := receiver.Receive(ctx, payload, signature, timestamp); err != nil {
+		t.Fatalf("Receive() returned error [%v]", err)
+	}
+	// The worker records the email sent after the event arrived.
+	if err := submissionStore.UpdateStatus(ctx, "sub-1", store.StatusSent, ""); err != nil {
+		t.Fatalf("UpdateStatus() returned error [%v]", err)
+	}
+	if submission, _ := submissionStore.Get(ctx, "sub-1"); submission.Status != store.StatusDelivered {
+		t.Errorf("status actual[%s], does not match expected[%s]", submission.Status, store.StatusDelivered)
+	}
+}
+
+func TestReceiveRedactsReasons(t *testing.T) {
+	ctx := context.Background()
+	key := generateKey(t)
+	submissionStore := setupStore(t, ctx, "sub-1")
+	recorder := logging.NewRecorder()
+	receiver := setupReceiver(t, key, submissionStore,
+		webhook.WithLogger(logging.NewWithHandler(recorder, redaction.New(redaction.PolicyNone))))
+
+	payload := []byte(`[{"event": "bounce", "reason": "550 5.1.1 <contact@ippoippophotography.com>: unknown user", "submission_id": "sub-1"}]`)
+	signature, timestamp := sign(t, key, payload, time.Now())
+	if _, err := receiver.Receive(ctx, payload, signature, timestamp); err != nil {
+		t.Fatalf("Receive() returned error [%v]", err)
+	}
+	logged := false
+	for _, record := range recorder.Records() {
+		reason, ok := logging.Attrs(record)["reason"]
+		logged = logged || ok
+		if ok && strings.Contains(reason.String(), "contact@") {
+			t.Errorf("%s: reason actual[%s], SHOULD be redacted", record.Message, reason.String())
+		}
+	}
+	if !logged {
+		t.Error("the reason SHOULD be logged")
+	}
+}
+
+func TestNewReceiverRequiresKeyAndStore(t *testing.T) {
+	submissionStore := setupStore(t, context.Background())
+	ed25519Key, _, _ := ed25519.GenerateKey(rand.Reader)
+	ed25519DER, _ := x509.MarshalPKIXPublicKey(ed25519Key)
+	invalidKeys := []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("not a key")),
+		base64.StdEncoding.EncodeToString(ed25519DER)}
+	for _, publicKey := range invalidKeys {
+		cfg := &configuration.ContactFormConfiguration{SendGridWebhookPublicKey: publicKey}
+		if _, err := webhook.NewReceiver(cfg, submissionStore); err == nil {
+			t.Errorf("NewReceiver() with public key[%s] SHOULD return an error", publicKey)
+		}
+	}
+	cfg := &configuration.ContactFormConfiguration{SendGridWebhookPublicKey: encodePublicKey(t, generateKey(t))}
+	if _, err := webhook.NewReceiver(cfg, nil); err == nil {
+		t.Errorf("NewReceiver() without a store SHOULD return an error")
+	}
+}
+
+// Support functions
+
+func generateKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() returned error [%v]", err)
+	}
+	return key
+}
+
+func encodePublicKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey() returned error [%v]", err)
+	}
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+// sign signs payload as SendGrid does: an ASN.1 ECDSA signature of the
+// SHA-256 hash of the timestamp followed by the payload.
+func sign(t *testing.T, key *ecdsa.PrivateKey, payload []byte, at time.Time) (string, string) {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	hash := sha256.Sum256(append([]byte(timestamp), payload...))
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatalf("SignASN1() returned error [%v]", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), timestamp
+}
+
+func setupReceiver(t *testing.T, key *ecdsa.PrivateKey, submissionStore store.SubmissionStore, opts ...webhook.Option) *webhook.Receiver {
+	t.Setenv("SENDGRID_WEBHOOK_PUBLIC_KEY", encodePublicKey(t, key))
+	cfg := configuration.NewContactFormConfiguration()
+	receiver, err := webhook.NewReceiver(cfg, submissionStore, append([]webhook.Option{webhook.WithLogger(logging.Discard())}, opts...)...)
+	if err != nil {
+		t.Fatalf("NewReceiver() returned error [%v]", err)
+	}
+	return receiver
+}
+
+func setupStore(t *testing.T, ctx context.Context, ids ...string) store.SubmissionStore {
+	submissionStore, err := store.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore() returned error [%v]", err)
+	}
+	for _, id := range ids {
+		submission := store.NewSubmission(&api.EmailFormRequest{Name: "Gavin Thomas", Email: "test@example.com", Message: "Hello"},
+			"req-"+id, time.Now().UTC())
+		submission.ID = id
+		if err := submissionStore.Create(ctx, submission); err != nil {
+			t.Fatalf("Create() returned error [%v]", err)
+		}
+	}
+	return submissionStore
+}
+
+// Mocks
+
+type MockAlerter struct {
+	Alerts []webhook.Alert
+}
+
+func (a *MockAlerter) Alert(_ context.Context, alert webhook.Alert) {
+	a.Alerts = append(a.Alerts, alert)
+}